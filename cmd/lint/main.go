@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Azure/moby-packaging/packages"
+	_ "github.com/Azure/moby-packaging/packages/all"
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+type allArgs struct {
+	specFile  string
+	bundleDir string
+	json      bool
+	strict    bool
+}
+
+func main() {
+	args := allArgs{}
+	flag.StringVar(&args.specFile, "spec-file", "", "path of spec file")
+	flag.StringVar(&args.bundleDir, "bundle-dir", "", "base directory of bundled files")
+	flag.BoolVar(&args.json, "json", false, "print the issues as JSON")
+	flag.BoolVar(&args.strict, "strict", false, "fail on warnings as well as errors")
+	flag.Parse()
+
+	if args.specFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	failed, err := lint(args, flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s\n", err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// lint lints the packages built from the spec, and reports whether any of
+// them failed.
+func lint(args allArgs, files []string) (bool, error) {
+	b, err := os.ReadFile(args.specFile)
+	if err != nil {
+		return false, err
+	}
+
+	var spec archive.Spec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return false, err
+	}
+
+	project, err := packages.Get(spec.Pkg)
+	if err != nil {
+		return false, err
+	}
+	archives, err := project.Archives(&spec)
+	if err != nil {
+		return false, err
+	}
+	a, ok := archives[spec.Distro]
+	if !ok {
+		return false, fmt.Errorf("%s: unsupported distro: %s", spec.Pkg, spec.Distro)
+	}
+
+	if len(files) == 0 {
+		p, err := spec.FullPath(args.bundleDir)
+		if err != nil {
+			return false, err
+		}
+		files = []string{p}
+	}
+
+	results := map[string][]archive.LintIssue{}
+	failed := false
+	for _, f := range files {
+		p, err := archive.ReadPackage(f)
+		if err != nil {
+			return false, err
+		}
+
+		issues := archive.LintPackage(p, &a, &spec)
+		results[f] = issues
+
+		for _, i := range issues {
+			if i.Severity == archive.LintError || args.strict {
+				failed = true
+			}
+			if !args.json {
+				printIssue(f, i)
+			}
+		}
+	}
+
+	if args.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return false, err
+		}
+	}
+
+	return failed, nil
+}
+
+func printIssue(file string, i archive.LintIssue) {
+	fmt.Printf("##vso[task.logissue type=%s;sourcepath=%s;]%s\n", i.Severity, file, i)
+}
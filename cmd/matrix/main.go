@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Azure/moby-packaging/packages"
+	_ "github.com/Azure/moby-packaging/packages/all"
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(s string) error {
+	for _, pat := range strings.Split(s, ",") {
+		distro, arch, _ := strings.Cut(pat, ":")
+		for _, glob := range []string{distro, arch} {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("bad pattern %q: %w", pat, err)
+			}
+		}
+		*p = append(*p, pat)
+	}
+	return nil
+}
+
+// match reports whether any pattern matches the distro/arch pair. Patterns are
+// of the form DISTRO[:ARCH], where both parts are globs and a missing ARCH
+// matches every arch.
+func (p patterns) match(distro, arch string) bool {
+	for _, pat := range p {
+		dp, ap, ok := strings.Cut(pat, ":")
+		if !ok {
+			ap = "*"
+		}
+
+		if dm, _ := path.Match(dp, distro); !dm {
+			continue
+		}
+		if ap == "*" {
+			return true
+		}
+		if am, _ := path.Match(ap, arch); am {
+			return true
+		}
+	}
+	return false
+}
+
+type allArgs struct {
+	pkg      string
+	tag      string
+	revision string
+	repo     string
+	commit   string
+	include  patterns
+	exclude  patterns
+}
+
+func main() {
+	args := allArgs{}
+	flag.StringVar(&args.pkg, "project", "", "name of project")
+	flag.StringVar(&args.tag, "tag", "", "tag for build set")
+	flag.StringVar(&args.revision, "revision", "", "revision for build set")
+	flag.StringVar(&args.repo, "repo", "", "git repo to build from (defaults to the upstream repo of the project)")
+	flag.StringVar(&args.commit, "commit", "", "commit hash of the tag")
+	flag.Var(&args.include, "include", "only build DISTRO[:ARCH] pairs matching this glob (may be repeated)")
+	flag.Var(&args.exclude, "exclude", "do not build DISTRO[:ARCH] pairs matching this glob (may be repeated)")
+	flag.Parse()
+
+	if args.pkg == "" || args.tag == "" || args.revision == "" || args.commit == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	specs, err := expand(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s\n", err)
+		os.Exit(1)
+	}
+
+	b, err := json.MarshalIndent(specs, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(b))
+}
+
+// expand returns a spec for every distro the project has a package layout
+// for, crossed with every arch built for that distro.
+func expand(args allArgs) ([]archive.Spec, error) {
+	project, err := packages.Get(args.pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := args.repo
+	if repo == "" {
+		repo = project.DefaultRepo()
+	}
+	if repo == "" {
+		return nil, fmt.Errorf("%s has no default repo, --repo is required", args.pkg)
+	}
+
+	base := archive.Spec{
+		Pkg:      args.pkg,
+		Repo:     repo,
+		Commit:   args.commit,
+		Tag:      args.tag,
+		Revision: args.revision,
+	}
+
+	archives, err := project.Archives(&base)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(archives))
+	for name := range archives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var specs []archive.Spec
+	for _, name := range names {
+		distro, err := archive.LookupDistro(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", args.pkg, err)
+		}
+
+		for _, arch := range distro.Arches {
+			if len(args.include) > 0 && !args.include.match(name, arch) {
+				continue
+			}
+			if args.exclude.match(name, arch) {
+				continue
+			}
+
+			spec := base
+			spec.Distro = name
+			spec.Arch = arch
+
+			// Make sure every spec we hand out names a package we know how
+			// to build.
+			if _, err := spec.Basename(); err != nil {
+				return nil, fmt.Errorf("%s/%s: %w", name, arch, err)
+			}
+			specs = append(specs, spec)
+		}
+	}
+
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no distro/arch pairs left for %s after filtering", args.pkg)
+	}
+
+	return specs, nil
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/Azure/moby-packaging/pkg/archive"
 )
@@ -12,19 +13,21 @@ import (
 type args struct {
 	bundleDir string
 	specFile  string
+	name      string
 }
 
 func main() {
 	a := args{}
 
 	if len(os.Args) < 2 {
-		panic("first arg must be 'dir', 'full-path', or 'basename'")
+		panic("first arg must be 'dir', 'full-path', 'basename' or 'parse'")
 	}
 
 	globFlags := flag.NewFlagSet("global", flag.ExitOnError)
 	pathFlag := flag.NewFlagSet("./cmd/path", flag.ExitOnError)
 	pathFlag.StringVar(&a.specFile, "spec-file", "", "path of spec file")
 	pathFlag.StringVar(&a.bundleDir, "bundle-dir", "", "base directory of bundled files")
+	pathFlag.StringVar(&a.name, "name", "", "basename or storage path of a package to parse")
 	globFlags.Usage = pathFlag.Usage
 	pathFlag.Parse(os.Args[2:])
 	globFlags.Parse(os.Args[1:])
@@ -35,8 +38,12 @@ func main() {
 }
 
 func do(cmd string, a args) error {
+	if cmd == "parse" {
+		return parse(a.name)
+	}
+
 	if a.specFile == "" {
-		return fmt.Errorf("all subcommands require the --spec-file argument")
+		return fmt.Errorf("all subcommands but parse require the --spec-file argument")
 	}
 
 	b, err := os.ReadFile(a.specFile)
@@ -73,3 +80,27 @@ func do(cmd string, a args) error {
 
 	return nil
 }
+
+// parse prints the spec of the package with the given basename or storage
+// path, as JSON.
+func parse(name string) error {
+	if name == "" {
+		return fmt.Errorf("the parse subcommand requires the --name argument")
+	}
+
+	parseFn := archive.ParseBasename
+	if strings.Contains(name, "/") {
+		parseFn = archive.ParseStoragePath
+	}
+	s, err := parseFn(name)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(&s, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
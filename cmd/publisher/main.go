@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/publish"
+	"github.com/Azure/moby-packaging/pkg/queue"
+	"github.com/Azure/moby-packaging/pkg/sign"
+	"github.com/Azure/moby-packaging/pkg/storage"
+)
+
+const (
+	prodAccountName   = "mobyreleases"
+	prodContainerName = "moby"
+
+	backendAzure = "azure"
+	backendLocal = "local"
+	backendS3    = "s3"
+
+	queueAzure = "azure"
+	queueDir   = "dir"
+)
+
+type publisherArgs struct {
+	queue           string
+	queueAccount    string
+	queueName       string
+	queueEndpoint   string
+	queueConnString string
+	queueDir        string
+	createQueue     bool
+	poisonQueue     string
+	indexContainer  string
+
+	// enqueue
+	specsFile   string
+	bundleDir   string
+	artifactURL string
+
+	// run
+	backend        string
+	azureAccount   string
+	azureContainer string
+	localDir       string
+	s3Endpoint     string
+	s3Bucket       string
+
+	gpgKey             string
+	gpgHomedir         string
+	fileKey            string
+	authenticodeSign   string
+	verifyKey          string
+	authenticodeVerify string
+
+	visibility      time.Duration
+	maxDequeueCount int64
+	pollInterval    time.Duration
+	once            bool
+}
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "enqueue" && os.Args[1] != "run") {
+		fmt.Fprintln(os.Stderr, "usage: go run ./cmd/publisher enqueue|run [flags]")
+		os.Exit(2)
+	}
+
+	args := publisherArgs{}
+	fs := flag.NewFlagSet("./cmd/publisher "+os.Args[1], flag.ExitOnError)
+	fs.StringVar(&args.queue, "queue", queueAzure, "kind of queue: azure, or dir for a queue kept in a local directory")
+	fs.StringVar(&args.queueAccount, "queue-account", queue.DefaultAccountName, "azure storage account of the queue")
+	fs.StringVar(&args.queueName, "queue-name", queue.DefaultQueueName, "name of the queue")
+	fs.StringVar(&args.queueEndpoint, "queue-endpoint", "", "URL of the azure queue service (default https://<queue-account>.queue.core.windows.net)")
+	fs.StringVar(&args.queueConnString, "queue-connection-string", "", "connect to the azure queue service with this connection string, e.g. UseDevelopmentStorage=true for Azurite")
+	fs.StringVar(&args.queueDir, "queue-dir", "", "directory of the queue, with --queue=dir")
+	fs.StringVar(&args.indexContainer, "index-container", "", "azure storage container of the index of the builds in the queue (default <queue-name>-index)")
+	fs.BoolVar(&args.createQueue, "create-queue", false, "create the azure queues and index container if they do not exist")
+	switch os.Args[1] {
+	case "enqueue":
+		fs.StringVar(&args.specsFile, "specs-file", "", "file containing build specs of the packages built")
+		fs.StringVar(&args.bundleDir, "bundle-dir", "", "base directory of bundled files")
+		fs.StringVar(&args.artifactURL, "artifact-url", "", "URL the bundle dir can be downloaded from by the workers, http(s) or file")
+	case "run":
+		fs.StringVar(&args.poisonQueue, "poison-queue", "", "name, or directory with --queue=dir, of the queue to move messages which cannot be handled to (default <queue-name>-poison or <queue-dir>-poison)")
+		fs.StringVar(&args.backend, "backend", backendAzure, "where to upload to: azure, local or s3")
+		fs.StringVar(&args.azureAccount, "azure-account", prodAccountName, "azure storage account to upload to")
+		fs.StringVar(&args.azureContainer, "azure-container", prodContainerName, "azure storage container to upload to")
+		fs.StringVar(&args.localDir, "local-dir", "", "directory to upload to, with --backend=local")
+		fs.StringVar(&args.s3Endpoint, "s3-endpoint", "", "base URL of the S3 compatible service to upload to, with --backend=s3")
+		fs.StringVar(&args.s3Bucket, "s3-bucket", "", "bucket to upload to, with --backend=s3")
+		fs.StringVar(&args.gpgKey, "gpg-key", "", "sign with this key from the local gpg keyring")
+		fs.StringVar(&args.gpgHomedir, "gpg-homedir", "", "gpg home directory holding --gpg-key")
+		fs.StringVar(&args.fileKey, "file-key", "", "sign with the PEM encoded private key in this file instead of gpg")
+		fs.StringVar(&args.authenticodeSign, "authenticode-sign", "", "command signing the windows executable {in} into {out}")
+		fs.StringVar(&args.verifyKey, "verify-key", "", "public key (gpg, or PEM for a file key) to verify the package signatures with before uploading")
+		fs.StringVar(&args.authenticodeVerify, "authenticode-verify", "", "command verifying the signature of the windows executable {in}")
+		fs.DurationVar(&args.visibility, "visibility", publish.DefaultVisibility, "how long a message is hidden from other workers at a time while it is handled")
+		fs.Int64Var(&args.maxDequeueCount, "max-dequeue-count", publish.DefaultMaxDequeueCount, "how many times a message is tried before it is moved to the poison queue")
+		fs.DurationVar(&args.pollInterval, "poll-interval", publish.DefaultPollInterval, "how long to wait before polling an empty queue again")
+		fs.BoolVar(&args.once, "once", false, "exit once the queue is empty, instead of waiting for more messages")
+	}
+	fs.Parse(os.Args[2:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	if os.Args[1] == "enqueue" {
+		err = enqueue(ctx, args)
+	} else {
+		err = run(ctx, args)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s\n", err)
+		os.Exit(1)
+	}
+}
+
+// enqueue announces the packages of the specs, built in the bundle dir, to
+// the workers.
+func enqueue(ctx context.Context, args publisherArgs) error {
+	if args.specsFile == "" {
+		return fmt.Errorf("you must provide a spec file")
+	}
+	if args.bundleDir == "" {
+		return fmt.Errorf("you must provide a bundle directory")
+	}
+	if args.artifactURL == "" {
+		return fmt.Errorf("you must provide the URL of the bundle directory")
+	}
+
+	b, err := os.ReadFile(args.specsFile)
+	if err != nil {
+		return err
+	}
+	var specs []archive.Spec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return err
+	}
+
+	q, err := newQueue(ctx, args, args.queueName, args.queueDir)
+	if err != nil {
+		return err
+	}
+	idx, err := newIndex(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		p, err := spec.FullPath(args.bundleDir)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(args.bundleDir, p)
+		if err != nil {
+			return err
+		}
+		uri := strings.TrimSuffix(args.artifactURL, "/") + "/" + filepath.ToSlash(rel)
+
+		m, err := publish.NewMessage(spec, p, uri)
+		if err != nil {
+			return err
+		}
+		added, err := queue.EnqueueOnce(ctx, q, idx, m)
+		if err != nil {
+			return fmt.Errorf("error enqueuing %s: %w", m.Artifact.Name, err)
+		}
+		if !added {
+			fmt.Fprintf(os.Stderr, "%s is already in %s, skipping\n", m.Artifact.Name, q)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "enqueued %s to %s\n", m.Artifact.Name, q)
+	}
+	return nil
+}
+
+// run handles the messages in the queue until interrupted, or until the
+// queue is empty with --once.
+func run(ctx context.Context, args publisherArgs) error {
+	w := &publish.Worker{
+		Visibility:      args.visibility,
+		MaxDequeueCount: args.maxDequeueCount,
+		PollInterval:    args.pollInterval,
+		Retries:         storage.DefaultRetries,
+		RetryDelay:      storage.DefaultRetryDelay,
+	}
+
+	var err error
+	if w.Queue, err = newQueue(ctx, args, args.queueName, args.queueDir); err != nil {
+		return err
+	}
+	poisonName, poisonDir := args.poisonQueue, args.poisonQueue
+	if args.poisonQueue == "" {
+		poisonName, poisonDir = args.queueName+"-poison", strings.TrimRight(args.queueDir, `/\`)+"-poison"
+	}
+	if w.Poison, err = newQueue(ctx, args, poisonName, poisonDir); err != nil {
+		return err
+	}
+	if w.Index, err = newIndex(ctx, args); err != nil {
+		return err
+	}
+	if w.Backend, err = newBackend(args); err != nil {
+		return err
+	}
+	if w.Sign, err = signOptions(args); err != nil {
+		return err
+	}
+
+	if !args.once {
+		err := w.Run(ctx)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}
+
+	failed := false
+	for {
+		n, err := w.Poll(ctx)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s\n", err)
+		}
+		if n == 0 || ctx.Err() != nil {
+			break
+		}
+	}
+	if failed {
+		return fmt.Errorf("some messages failed to be handled")
+	}
+	return nil
+}
+
+func signOptions(args publisherArgs) (sign.Options, error) {
+	opts := sign.Options{}
+	switch {
+	case args.fileKey != "" && args.gpgKey != "":
+		return opts, fmt.Errorf("--file-key and --gpg-key cannot both be given")
+	case args.fileKey != "":
+		k, err := sign.LoadFileKey(args.fileKey)
+		if err != nil {
+			return opts, err
+		}
+		opts.Signer = k
+	case args.gpgKey != "":
+		opts.Signer = &sign.GPG{KeyID: args.gpgKey, Homedir: args.gpgHomedir}
+	default:
+		return opts, fmt.Errorf("you must provide --gpg-key or --file-key to sign with")
+	}
+
+	if args.authenticodeSign != "" || args.authenticodeVerify != "" {
+		opts.Authenticode = &sign.Authenticode{
+			Sign:   strings.Fields(args.authenticodeSign),
+			Verify: strings.Fields(args.authenticodeVerify),
+		}
+	}
+	if args.verifyKey != "" {
+		v, err := sign.LoadVerifier(args.verifyKey)
+		if err != nil {
+			return opts, err
+		}
+		opts.Verifier = v
+	}
+	return opts, nil
+}
+
+// newQueue returns the azure queue with the given name, or with --queue=dir
+// the queue kept in dir.
+func newQueue(ctx context.Context, args publisherArgs, name, dir string) (queue.Queue, error) {
+	switch args.queue {
+	case queueAzure:
+		q, err := queue.NewAzureQueue(args.queueAccount, name, queue.AzureOptions{
+			ConnectionString: args.queueConnString,
+			Endpoint:         args.queueEndpoint,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if args.createQueue {
+			if err := q.Create(ctx); err != nil {
+				return nil, fmt.Errorf("error creating %s: %w", q, err)
+			}
+		}
+		return q, nil
+	case queueDir:
+		if args.queueDir == "" {
+			return nil, fmt.Errorf("you must provide --queue-dir with --queue=dir")
+		}
+		return queue.NewDir(dir)
+	default:
+		return nil, fmt.Errorf("unknown queue: %q", args.queue)
+	}
+}
+
+// newIndex returns the index of the builds in the queue, which keeps a build
+// from being enqueued while it already has a message.
+func newIndex(ctx context.Context, args publisherArgs) (queue.Index, error) {
+	switch args.queue {
+	case queueAzure:
+		container := args.indexContainer
+		if container == "" {
+			container = args.queueName + "-index"
+		}
+		idx, err := queue.NewBlobIndex(args.queueAccount, container, "", queue.AzureOptions{ConnectionString: args.queueConnString})
+		if err != nil {
+			return nil, err
+		}
+		if args.createQueue {
+			if err := idx.Create(ctx); err != nil {
+				return nil, fmt.Errorf("error creating index container %s: %w", container, err)
+			}
+		}
+		return idx, nil
+	case queueDir:
+		if args.queueDir == "" {
+			return nil, fmt.Errorf("you must provide --queue-dir with --queue=dir")
+		}
+		return queue.NewDirIndex(strings.TrimRight(args.queueDir, `/\`) + "-index")
+	default:
+		return nil, fmt.Errorf("unknown queue: %q", args.queue)
+	}
+}
+
+func newBackend(args publisherArgs) (storage.Backend, error) {
+	switch args.backend {
+	case backendAzure:
+		return storage.NewAzureBlob(args.azureAccount, args.azureContainer)
+	case backendLocal:
+		return storage.NewLocalDir(args.localDir)
+	case backendS3:
+		// Credentials and region come from the AWS_* environment variables.
+		return storage.NewS3(storage.S3ConfigFromEnv(args.s3Endpoint, args.s3Bucket))
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %q", args.backend)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/repo"
+	"github.com/Azure/moby-packaging/pkg/sign"
+)
+
+type repoArgs struct {
+	specsFile  string
+	bundleDir  string
+	outDir     string
+	gpgKey     string
+	gpgHomedir string
+}
+
+func main() {
+	args := repoArgs{}
+	flag.StringVar(&args.specsFile, "specs-file", "", "file containing build specs of the packages to publish")
+	flag.StringVar(&args.bundleDir, "bundle-dir", "", "base directory of bundled files")
+	flag.StringVar(&args.outDir, "out-dir", "repos", "directory to write the repositories to")
+	flag.StringVar(&args.gpgKey, "gpg-key", "", "sign the repositories with this key from the local gpg keyring")
+	flag.StringVar(&args.gpgHomedir, "gpg-homedir", "", "gpg home directory holding --gpg-key")
+	flag.Parse()
+
+	if err := do(args); err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func do(args repoArgs) error {
+	if args.specsFile == "" {
+		return fmt.Errorf("you must provide a spec file")
+	}
+	if args.bundleDir == "" {
+		return fmt.Errorf("you must provide a bundle directory")
+	}
+
+	b, err := os.ReadFile(args.specsFile)
+	if err != nil {
+		return err
+	}
+	var specs []archive.Spec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return err
+	}
+
+	opts := repo.Options{}
+	if args.gpgKey != "" {
+		opts.Signer = &sign.GPG{KeyID: args.gpgKey, Homedir: args.gpgHomedir}
+	} else {
+		fmt.Fprintln(os.Stderr, "##vso[task.logissue type=warning;]no --gpg-key given, the repositories will not be signed")
+	}
+	if opts.Time, err = sourceDateEpoch(); err != nil {
+		return err
+	}
+
+	var (
+		debs []repo.AptPackage
+		// "<distro>/<arch>" -> rpms
+		rpms = map[string][]string{}
+	)
+	for _, spec := range specs {
+		d, err := archive.LookupDistro(spec.Distro)
+		if err != nil {
+			return err
+		}
+		p, err := spec.FullPath(args.bundleDir)
+		if err != nil {
+			return err
+		}
+
+		switch d.Kind {
+		case archive.PkgKindDeb:
+			debs = append(debs, repo.AptPackage{Codename: d.Name, Path: p})
+		case archive.PkgKindRPM:
+			arch, err := archive.RpmArch(spec.Arch)
+			if err != nil {
+				return err
+			}
+			key := d.Name + "/" + arch
+			rpms[key] = append(rpms[key], p)
+		default:
+			fmt.Fprintf(os.Stderr, "%s has no package repository, skipping %s\n", spec.Distro, filepath.Base(p))
+		}
+	}
+
+	if len(debs) > 0 {
+		dir := filepath.Join(args.outDir, "apt")
+		if err := repo.WriteApt(dir, debs, opts); err != nil {
+			return err
+		}
+		fmt.Println(dir)
+	}
+
+	keys := make([]string, 0, len(rpms))
+	for k := range rpms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		dir := filepath.Join(args.outDir, "yum", filepath.FromSlash(k))
+		if err := repo.WriteYum(dir, rpms[k], opts); err != nil {
+			return fmt.Errorf("error writing %s repository: %w", k, err)
+		}
+		fmt.Println(dir)
+	}
+
+	return nil
+}
+
+// sourceDateEpoch returns the time in SOURCE_DATE_EPOCH, so the metadata of
+// the same packages can be generated reproducibly. It is zero, meaning now,
+// if the variable is not set.
+func sourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", v, err)
+	}
+	return time.Unix(sec, 0), nil
+}
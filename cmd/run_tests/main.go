@@ -1,113 +1,359 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"dagger.io/dagger"
 	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/testresults"
+	"github.com/Azure/moby-packaging/testutil"
 )
 
 const (
-	debian  = "debian"
-	ubuntu  = "ubuntu"
 	makebin = "make"
+
+	runnerDagger = "dagger"
+	runnerMake   = "make"
 )
 
+type specFiles []string
+
+func (s *specFiles) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *specFiles) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 type Args struct {
+	SpecPaths     specFiles
 	SpecPath      string
 	BundleDirPath string
+	Runner        string
+	TestsDirPath  string
+	ReportDirPath string
+	SummaryPath   string
+	Timeout       time.Duration
+
+	// Upgrade scenario, see upgrade.go.
+	PreviousTag      string
+	PreviousRevision string
+	ReleaseDirPath   string
 }
 
 func main() {
 	args := Args{}
-	flag.StringVar(&args.SpecPath, "spec-file", "", "path of the pipeline instructions file to be used")
+	flag.Var(&args.SpecPaths, "spec-file", "path of the pipeline instructions file to be used (may be repeated)")
 	flag.StringVar(&args.BundleDirPath, "bundle-dir", "", "path of the bundle dir to test")
+	flag.StringVar(&args.Runner, "runner", "", "how to run the tests: dagger (in a qemu vm) or make (with docker); defaults to dagger for amd64, make otherwise")
+	flag.StringVar(&args.TestsDirPath, "tests-dir", "tests", "path of the tests directory of this repo")
+	flag.StringVar(&args.ReportDirPath, "report-dir", "", "where to write the test reports (default <tests-dir>/.test/<distro>)")
+	flag.StringVar(&args.SummaryPath, "summary", "", "where to write the summary of all specs tested (default <tests-dir>/.test/summary.json)")
+	flag.DurationVar(&args.Timeout, "timeout", testutil.DefaultVMTimeout, "how long the test vm may run, with the dagger runner")
+	flag.StringVar(&args.PreviousTag, "upgrade-from-tag", "", "test upgrading from the release with this tag instead of a fresh install")
+	flag.StringVar(&args.PreviousRevision, "upgrade-from-revision", "", "revision of the release to upgrade from")
+	flag.StringVar(&args.ReleaseDirPath, "release-dir", "", "directory laid out like the release storage container, holding the release to upgrade from")
 	flag.Parse()
 
-	if err := runTest(args); err != nil {
-		panic(err)
+	if len(args.SpecPaths) == 0 {
+		fmt.Fprintln(os.Stderr, "##vso[task.logissue type=error;]--spec-file is required")
+		os.Exit(2)
+	}
+
+	run := runTest
+	if args.PreviousTag != "" {
+		run = runUpgradeTest
+	}
+
+	// Every spec is tested even if an earlier one fails, so the summary
+	// covers them all.
+	var (
+		reports []*testresults.Report
+		failed  bool
+	)
+	for _, p := range args.SpecPaths {
+		specArgs := args
+		specArgs.SpecPath = p
+
+		r, err := run(specArgs)
+		if r != nil {
+			reports = append(reports, r)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;sourcepath=%s]%s\n", p, err)
+			failed = true
+		}
 	}
 
+	summaryPath := args.SummaryPath
+	if summaryPath == "" {
+		summaryPath = filepath.Join(args.TestsDirPath, ".test", "summary.json")
+	}
+	sum := testresults.Summarize(reports)
+	if err := os.MkdirAll(filepath.Dir(summaryPath), 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]error writing summary: %s\n", err)
+		os.Exit(1)
+	}
+	if err := sum.WriteFile(summaryPath); err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]error writing summary: %s\n", err)
+		os.Exit(1)
+	}
+	printSummary(sum)
+
+	if failed || sum.Failed > 0 {
+		os.Exit(1)
+	}
 }
 
-func runTest(args Args) error {
-	b, err := os.ReadFile(args.SpecPath)
+func printSummary(sum *testresults.Summary) {
+	fmt.Printf("\n%d passed, %d failed, %d skipped\n", sum.Passed, sum.Failed, sum.Skipped)
+	for _, ss := range sum.Specs {
+		fmt.Printf("  %s %s/%s %s: %d passed, %d failed, %d skipped\n",
+			ss.Spec.Pkg, ss.Spec.Distro, ss.Spec.Arch, ss.Suite, ss.Passed, ss.Failed, ss.Skipped)
+		for _, name := range ss.Failures {
+			fmt.Printf("    FAIL %s\n", name)
+		}
+		if ss.Error != "" {
+			fmt.Printf("    ERROR %s\n", ss.Error)
+		}
+	}
+}
+
+// suite is a bats suite from the tests directory, run against the packages
+// built from a spec.
+type suite struct {
+	spec archive.Spec
+	// name of the bats file.
+	name string
+	// install the packages from the bundle dir before running the suite.
+	install bool
+	env     map[string]string
+	// dirs are host directories made available to the suite, keyed by
+	// their path on the test machine.
+	dirs map[string]string
+
+	// How to run the suite through tests/Makefile.
+	makeTarget string
+	makeArgs   []string
+}
+
+// runSuite runs the suite and turns the TAP output of bats into a report,
+// which is written to the report dir as JUnit XML and JSON. A report is
+// returned whenever the suite was started, even if it failed.
+func runSuite(args Args, su *suite) (*testresults.Report, error) {
+	runner := args.Runner
+	if runner == "" {
+		runner = runnerMake
+		if su.spec.Arch == "amd64" {
+			runner = runnerDagger
+		}
+	}
+
+	reportDir := args.ReportDirPath
+	if reportDir == "" {
+		reportDir = filepath.Join(args.TestsDirPath, ".test", su.spec.Distro)
+	}
+
+	// tests/Makefile always writes the TAP output to its own test dir.
+	tapDir := reportDir
+	var run func() error
+	switch runner {
+	case runnerDagger:
+		run = func() error { return runDagger(args, su, reportDir) }
+	case runnerMake:
+		tapDir = filepath.Join(args.TestsDirPath, ".test", su.spec.Distro)
+		run = func() error { return runMake(su) }
+	default:
+		return nil, fmt.Errorf("unknown runner: %q", runner)
+	}
+
+	r := &testresults.Report{
+		Spec:    su.spec,
+		Suite:   su.name,
+		Runner:  runner,
+		Started: time.Now().UTC(),
+	}
+	runErr := run()
+	r.Duration = time.Since(r.Started)
+
+	results, err := readTAP(filepath.Join(tapDir, r.Basename()+".tap"))
+	switch {
+	case err != nil:
+		r.Error = fmt.Sprintf("no test results: %v", err)
+	case runErr != nil && !hasFailure(results):
+		// bats exits non-zero when a test fails, which the results already
+		// show; anything else is worth reporting on its own.
+		r.Error = runErr.Error()
+	}
+	r.Results = results
+
+	if _, err := r.WriteFiles(reportDir); err != nil {
+		return r, fmt.Errorf("error writing test reports: %w", err)
+	}
+	return r, runErr
+}
+
+func readTAP(path string) ([]testresults.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return testresults.ParseTAP(f)
+}
+
+func hasFailure(results []testresults.Result) bool {
+	for _, res := range results {
+		if res.Status == testresults.StatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// runDagger boots a vm from the distro's test image and runs the suite in
+// it, then copies the TAP output to the report dir.
+func runDagger(args Args, su *suite, reportDir string) error {
+	ctx := context.Background()
+
+	client, err := dagger.Connect(ctx, dagger.WithLogOutput(os.Stderr))
 	if err != nil {
 		return err
 	}
+	defer client.Close()
 
-	var s archive.Spec
-	if err := json.Unmarshal(b, &s); err != nil {
+	t := &testutil.VMTest{
+		Spec:    &su.spec,
+		Tests:   client.Host().Directory(args.TestsDirPath, dagger.HostDirectoryOpts{Exclude: []string{".test"}}),
+		Suite:   su.name,
+		Install: su.install,
+		Env:     su.env,
+		Dirs:    map[string]*dagger.Directory{},
+		Timeout: args.Timeout,
+	}
+	if su.install {
+		t.Packages = client.Host().Directory(su.spec.Dir(args.BundleDirPath))
+	}
+	for p, dir := range su.dirs {
+		t.Dirs[p] = client.Host().Directory(dir)
+	}
+
+	res, err := t.Run(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	if _, err := res.Reports.Export(ctx, reportDir); err != nil {
+		return fmt.Errorf("error exporting test reports: %w", err)
+	}
+
+	if res.ExitCode != 0 {
+		return fmt.Errorf("%s failed on %s with exit code %d", su.name, su.spec.Distro, res.ExitCode)
+	}
+	return nil
+}
+
+func runMake(su *suite) error {
+	runMake, err := exec.LookPath(makebin)
+	if err != nil {
 		return err
 	}
 
+	cmd := exec.Command(runMake, append([]string{su.makeTarget}, su.makeArgs...)...)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("DISTRO=%s", su.spec.Distro))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("TARGETARCH=%s", su.spec.Arch))
+	for k, v := range su.env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+func readSpec(path string) (archive.Spec, error) {
+	var s archive.Spec
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
+// packageVersion returns the version the package manager reports for the
+// package built from s.
+func packageVersion(s *archive.Spec, distro archive.Distro) string {
+	if distro.Kind == archive.PkgKindDeb {
+		return fmt.Sprintf("%[1]s-%[2]su%[3]s",
+			/* 1 */ s.Tag,
+			/* 2 */ distro.Tag,
+			/* 3 */ s.Revision,
+		)
+	}
+
+	return fmt.Sprintf("%s-%s.%s", s.Tag, s.Revision, distro.Tag)
+}
+
+func runTest(args Args) (*testresults.Report, error) {
+	s, err := readSpec(args.SpecPath)
+	if err != nil {
+		return nil, err
+	}
+
 	transformed := strings.TrimPrefix(s.Pkg, "moby-")
 	transformed = strings.ToUpper(transformed)
 	transformed = strings.ReplaceAll(transformed, "-", "_")
 
-	pkgOs, ok := archive.OSMap[s.Distro]
-	if !ok {
-		return fmt.Errorf("unrecognized distro: %s", pkgOs)
+	distro, err := archive.LookupDistro(s.Distro)
+	if err != nil {
+		return nil, err
 	}
 
-	pv, ok := archive.VersionMap[s.Distro]
-	if !ok {
-		return fmt.Errorf("unrecognized distro: %s", pkgOs)
-	}
+	tagRevision := fmt.Sprintf("%s-%s", s.Tag, s.Revision)
+	pkgVer := packageVersion(&s, distro)
 
-	fmt.Fprintf(os.Stderr, "%+v\n%s", s, pv)
+	fmt.Fprintf(os.Stderr, "%+v\n%s", s, distro.Tag)
 
 	fmt.Printf(`
 DISTRO=%[1]s
 TARGETARCH=%[2]s
 INCLUDE_TESTING=[0]
 TEST_%[3]s_COMMIT=%[4]s
-TEST_%[3]s_VERSION=%[5]s-%[6]s
-TEST_%[3]s_PACKAGE_VERSION=%[5]s-%[6]s.%[7]s
+TEST_%[3]s_VERSION=%[5]s
+TEST_%[3]s_PACKAGE_VERSION=%[6]s
 `,
 		/* 1 */ s.Distro,
 		/* 2 */ s.Arch,
 		/* 3 */ transformed,
 		/* 4 */ s.Commit,
-		/* 5 */ s.Tag,
-		/* 6 */ s.Revision,
-		/* 7 */ pv,
+		/* 5 */ tagRevision,
+		/* 6 */ pkgVer,
 	)
 
-	tagRevision := fmt.Sprintf("%s-%s", s.Tag, s.Revision)
-	pkgVer := fmt.Sprintf("%s.%s", tagRevision, pv)
-
-	if pkgOs == debian || pkgOs == ubuntu {
-		pkgVer = fmt.Sprintf("%[1]s-%[2]s%[3]su%[4]s",
-			/* 1 */ s.Tag,
-			/* 2 */ pkgOs,
-			/* 3 */ pv,
-			/* 4 */ s.Revision,
-		)
-	}
-
-	runMake, err := exec.LookPath(makebin)
-	if err != nil {
-		return err
-	}
-
-	cmd := exec.Command(runMake, "test", fmt.Sprintf("OUTPUT=%s", args.BundleDirPath))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("DISTRO=%s", s.Distro))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TARGETARCH=%s", s.Arch))
-	cmd.Env = append(cmd.Env, "INCLUDE_TESTING=0")
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TEST_%s_COMMIT=%s", transformed, s.Commit))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TEST_%s_VERSION=%s", transformed, tagRevision))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TEST_%s_PACKAGE_VERSION=%s", transformed, pkgVer))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-
-	return nil
+	return runSuite(args, &suite{
+		spec:    s,
+		name:    "test.sh",
+		install: true,
+		env: map[string]string{
+			"INCLUDE_TESTING":                                   "0",
+			fmt.Sprintf("TEST_%s_COMMIT", transformed):          s.Commit,
+			fmt.Sprintf("TEST_%s_VERSION", transformed):         tagRevision,
+			fmt.Sprintf("TEST_%s_PACKAGE_VERSION", transformed): pkgVer,
+		},
+		makeTarget: "test",
+		makeArgs:   []string{fmt.Sprintf("OUTPUT=%s", args.BundleDirPath)},
+	})
 }
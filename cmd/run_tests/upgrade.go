@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/moby-packaging/packages"
+	_ "github.com/Azure/moby-packaging/packages/all"
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/testresults"
+)
+
+// runUpgradeTest installs the previous release of the package, then upgrades
+// it to the package built from the spec and checks the maintainer scripts
+// did their job: services restarted, config kept and no files left behind.
+// See tests/upgrade.sh.
+//
+// The previous release is looked up in the release dir at the path it is
+// stored at in the release storage container (see Spec.StoragePath), so a
+// local copy of the container, or just the one package, can stand in for it.
+func runUpgradeTest(args Args) (*testresults.Report, error) {
+	if args.PreviousRevision == "" || args.ReleaseDirPath == "" {
+		return nil, fmt.Errorf("--upgrade-from-tag requires --upgrade-from-revision and --release-dir")
+	}
+
+	s, err := readSpec(args.SpecPath)
+	if err != nil {
+		return nil, err
+	}
+
+	distro, err := archive.LookupDistro(s.Distro)
+	if err != nil {
+		return nil, err
+	}
+	if distro.Kind == archive.PkgKindWin {
+		return nil, fmt.Errorf("upgrade tests are not supported for %s", s.Distro)
+	}
+
+	prev := s
+	prev.Tag = args.PreviousTag
+	prev.Revision = args.PreviousRevision
+
+	storagePath, err := prev.StoragePath()
+	if err != nil {
+		return nil, err
+	}
+	candidatePath, err := s.FullPath(args.BundleDirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "moby-upgrade-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	for name, src := range map[string]string{
+		"previous":  filepath.Join(args.ReleaseDirPath, filepath.FromSlash(storagePath)),
+		"candidate": candidatePath,
+	} {
+		if err := copyInto(filepath.Join(dir, name), src); err != nil {
+			return nil, fmt.Errorf("error staging %s package: %w", name, err)
+		}
+	}
+
+	project, err := packages.Get(s.Pkg)
+	if err != nil {
+		return nil, err
+	}
+	archives, err := project.Archives(&s)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := archives[s.Distro]
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported distro: %s", s.Pkg, s.Distro)
+	}
+	units, conffiles, confdirs := upgradeChecks(&a, distro.Kind)
+
+	return runSuite(args, &suite{
+		spec: s,
+		name: "upgrade.sh",
+		env: map[string]string{
+			"UPGRADE_PACKAGE":           s.Pkg,
+			"UPGRADE_PREVIOUS_VERSION":  packageVersion(&prev, distro),
+			"UPGRADE_CANDIDATE_VERSION": packageVersion(&s, distro),
+			"UPGRADE_UNITS":             strings.Join(units, " "),
+			"UPGRADE_CONFFILES":         strings.Join(conffiles, " "),
+			"UPGRADE_CONFDIRS":          strings.Join(confdirs, " "),
+		},
+		dirs:       map[string]string{"/var/upgrade": dir},
+		makeTarget: "test-upgrade",
+		makeArgs:   []string{fmt.Sprintf("UPGRADE_DIR=%s", dir)},
+	})
+}
+
+// upgradeChecks returns what the upgrade tests should check for the archive:
+// the systemd services it ships, and the config files and directories which
+// must survive an upgrade. For debs every file under /etc is a conffile; rpms
+// only treat files marked as config that way.
+func upgradeChecks(a *archive.Archive, kind archive.PkgKind) (units, conffiles, confdirs []string) {
+	isService := func(dest string) bool {
+		return path.Ext(dest) == ".service" && strings.Contains(dest, "systemd/system/")
+	}
+
+	for _, sd := range a.Systemd {
+		if isService(sd.Dest) {
+			units = append(units, path.Base(sd.Dest))
+		}
+	}
+
+	for _, f := range a.Files {
+		dest := path.Clean("/" + f.Dest)
+		switch {
+		case f.IsDir:
+			if strings.HasPrefix(dest, "/etc/") {
+				confdirs = append(confdirs, dest)
+			}
+		case isService(dest):
+			units = append(units, path.Base(dest))
+		case kind == archive.PkgKindDeb && strings.HasPrefix(dest, "/etc/"),
+			kind == archive.PkgKindRPM && (f.Config || f.NoReplace):
+			conffiles = append(conffiles, dest)
+		}
+	}
+
+	return units, conffiles, confdirs
+}
+
+// copyInto copies the file at src into dir, creating dir.
+func copyInto(dir, src string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(filepath.Join(dir, filepath.Base(src)))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/provenance"
+	"github.com/Azure/moby-packaging/pkg/sign"
+)
+
+type signArgs struct {
+	specsFile        string
+	bundleDir        string
+	signedDir        string
+	gpgKey           string
+	gpgHomedir       string
+	fileKey          string
+	authenticodeSign string
+	detached         bool
+}
+
+func main() {
+	args := signArgs{}
+	flag.StringVar(&args.specsFile, "specs-file", "", "file containing build specs of the packages to sign")
+	flag.StringVar(&args.bundleDir, "bundle-dir", "", "base directory of bundled files")
+	flag.StringVar(&args.signedDir, "signed-dir", "", "directory to write the signed files to")
+	flag.StringVar(&args.gpgKey, "gpg-key", "", "sign with this key from the local gpg keyring")
+	flag.StringVar(&args.gpgHomedir, "gpg-homedir", "", "gpg home directory holding --gpg-key")
+	flag.StringVar(&args.fileKey, "file-key", "", "sign with the PEM encoded private key in this file instead of gpg")
+	flag.StringVar(&args.authenticodeSign, "authenticode-sign", "", "command signing the windows executable {in} into {out}")
+	flag.BoolVar(&args.detached, "detached", false, "also write a detached signature of each package and provenance")
+	flag.Parse()
+
+	if err := do(args); err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func do(args signArgs) error {
+	if args.specsFile == "" {
+		return fmt.Errorf("you must provide a spec file")
+	}
+	if args.bundleDir == "" {
+		return fmt.Errorf("you must provide a bundle directory")
+	}
+	if args.signedDir == "" {
+		return fmt.Errorf("you must provide a directory for the signed packages")
+	}
+
+	b, err := os.ReadFile(args.specsFile)
+	if err != nil {
+		return err
+	}
+	var specs []archive.Spec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return err
+	}
+
+	opts := sign.Options{}
+	switch {
+	case args.fileKey != "" && args.gpgKey != "":
+		return fmt.Errorf("--file-key and --gpg-key cannot both be given")
+	case args.fileKey != "":
+		k, err := sign.LoadFileKey(args.fileKey)
+		if err != nil {
+			return err
+		}
+		opts.Signer = k
+	case args.gpgKey != "":
+		opts.Signer = &sign.GPG{KeyID: args.gpgKey, Homedir: args.gpgHomedir}
+	}
+	if args.authenticodeSign != "" {
+		opts.Authenticode = &sign.Authenticode{Sign: strings.Fields(args.authenticodeSign)}
+	}
+
+	for _, spec := range specs {
+		if err := signSpec(spec, args, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signSpec copies the package of the spec and its provenance from the bundle
+// dir to the signed dir, and signs the copy.
+func signSpec(spec archive.Spec, args signArgs, opts sign.Options) error {
+	src, err := spec.FullPath(args.bundleDir)
+	if err != nil {
+		return err
+	}
+	dest, err := spec.FullPath(args.signedDir)
+	if err != nil {
+		return err
+	}
+
+	if err := copyFile(src, dest); err != nil {
+		return err
+	}
+	if err := copyFile(src+provenance.Extension, dest+provenance.Extension); err != nil {
+		return err
+	}
+
+	if filepath.Ext(dest) == ".zip" && opts.Authenticode == nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=warning;]no --authenticode-sign given, %s is not signed\n", filepath.Base(dest))
+	} else if err := sign.SignPackage(dest, opts); err != nil {
+		return err
+	}
+
+	if !args.detached {
+		return nil
+	}
+	if opts.Signer == nil {
+		return fmt.Errorf("--detached needs --gpg-key or --file-key")
+	}
+	for _, p := range []string{dest, dest + provenance.Extension} {
+		if err := sign.SignFile(p, opts.Signer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -1,34 +1,78 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/provenance"
+	"github.com/Azure/moby-packaging/pkg/sign"
+	"github.com/Azure/moby-packaging/pkg/storage"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
 	prodAccountName   = "mobyreleases"
 	prodContainerName = "moby"
 
-	sha256Key = "sha256"
+	backendAzure = "azure"
+	backendLocal = "local"
+	backendS3    = "s3"
 )
 
 type uploadArgs struct {
-	signedDir string
-	specsFile string
+	signedDir         string
+	bundleDir         string
+	specsFile         string
+	requireProvenance bool
+
+	backend        string
+	azureAccount   string
+	azureContainer string
+	localDir       string
+	s3Endpoint     string
+	s3Bucket       string
+
+	verifyKey          string
+	authenticodeVerify string
+	// verify is set from verifyKey and authenticodeVerify.
+	verify *sign.Options
+
+	force  bool
+	dryRun bool
+
+	parallel   int
+	retries    int
+	retryDelay time.Duration
 }
 
 func main() {
 	upArgs := uploadArgs{}
 	flag.StringVar(&upArgs.signedDir, "signed-dir", "", "directory containing signed files to upload")
+	flag.StringVar(&upArgs.bundleDir, "bundle-dir", "", "directory containing the unsigned packages as built, to check the signed ones against")
 	flag.StringVar(&upArgs.specsFile, "specs-file", "", "file containing build specs of files to upload")
+	flag.BoolVar(&upArgs.requireProvenance, "require-provenance", false, "fail the upload of packages without a provenance file")
+	flag.StringVar(&upArgs.backend, "backend", backendAzure, "where to upload to: azure, local or s3")
+	flag.StringVar(&upArgs.azureAccount, "azure-account", prodAccountName, "azure storage account to upload to")
+	flag.StringVar(&upArgs.azureContainer, "azure-container", prodContainerName, "azure storage container to upload to")
+	flag.StringVar(&upArgs.localDir, "local-dir", "", "directory to upload to, with --backend=local")
+	flag.StringVar(&upArgs.s3Endpoint, "s3-endpoint", "", "base URL of the S3 compatible service to upload to, with --backend=s3")
+	flag.StringVar(&upArgs.s3Bucket, "s3-bucket", "", "bucket to upload to, with --backend=s3")
+	flag.StringVar(&upArgs.verifyKey, "verify-key", "", "public key (gpg, or PEM for a file key) to verify the package signatures with before uploading")
+	flag.StringVar(&upArgs.authenticodeVerify, "authenticode-verify", "", "command verifying the signature of the windows executable {in}")
+	flag.BoolVar(&upArgs.force, "force", false, "replace files already stored with a different sha256 sum")
+	flag.BoolVar(&upArgs.dryRun, "dry-run", false, "print what would be uploaded, without uploading anything")
+	flag.IntVar(&upArgs.parallel, "parallel", 4, "how many specs to upload at once")
+	flag.IntVar(&upArgs.retries, "retries", storage.DefaultRetries, "how many times to retry a failed upload")
+	flag.DurationVar(&upArgs.retryDelay, "retry-delay", storage.DefaultRetryDelay, "how long to wait before retrying a failed upload; doubled for each retry")
 	flag.Parse()
 
 	if err := do(upArgs); err != nil {
@@ -46,8 +90,27 @@ func do(args uploadArgs) error {
 		return fmt.Errorf("you must provide a directory for the signed packages")
 	}
 
+	if args.parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+
+	if args.verifyKey != "" {
+		v, err := sign.LoadVerifier(args.verifyKey)
+		if err != nil {
+			return err
+		}
+		args.verify = &sign.Options{Verifier: v}
+		if args.authenticodeVerify != "" {
+			args.verify.Authenticode = &sign.Authenticode{Verify: strings.Fields(args.authenticodeVerify)}
+		}
+	} else if args.authenticodeVerify != "" {
+		return fmt.Errorf("--authenticode-verify needs --verify-key")
+	} else if args.bundleDir != "" {
+		fmt.Fprintln(os.Stderr, "##vso[task.logissue type=warning;]no --verify-key given, the signatures will not be verified")
+	}
+
 	ctx := context.Background()
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	backend, err := newBackend(args)
 	if err != nil {
 		return err
 	}
@@ -62,49 +125,35 @@ func do(args uploadArgs) error {
 		return err
 	}
 
-	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net", prodAccountName)
-	client, err := azblob.NewClient(serviceURL, cred, nil)
-	if err != nil {
-		return err
-	}
-
 	failed := make([]archive.Spec, 0, len(allSpecs))
 	successful := make([]archive.Spec, 0, len(allSpecs))
 	errs := make([]error, 0, len(allSpecs))
 
-	fail := func(e error, s archive.Spec) {
-		failed = append(failed, s)
-		errs = append(errs, e)
-	}
+	// Specs are uploaded in parallel, but the results, and the plan with
+	// --dry-run, are reported in the order of the specs file.
+	results := make([]specResult, len(allSpecs))
 
-	for _, spec := range allSpecs {
-		signedPkgPath, err := spec.FullPath(args.signedDir)
-		if err != nil {
-			fail(err, spec)
-			continue
-		}
-
-		storagePath, err := spec.StoragePath()
-		if err != nil {
-			fail(err, spec)
-			continue
-		}
+	var eg errgroup.Group
+	eg.SetLimit(args.parallel)
+	for i, spec := range allSpecs {
+		i, spec := i, spec
+		eg.Go(func() error {
+			results[i] = uploadSpec(ctx, backend, spec, args)
+			return nil
+		})
+	}
+	eg.Wait()
 
-		b, err := os.ReadFile(signedPkgPath)
-		if err != nil {
-			fail(err, spec)
-			continue
+	for i, r := range results {
+		for _, line := range r.plan {
+			fmt.Println(line)
 		}
-
-		signedSha256Sum := fmt.Sprintf("%x", sha256.Sum256(b))
-		if _, err := client.UploadBuffer(ctx, prodContainerName, storagePath, b, &azblob.UploadFileOptions{
-			Metadata: map[string]*string{sha256Key: &signedSha256Sum},
-		}); err != nil {
-			fail(err, spec)
+		if r.err != nil {
+			failed = append(failed, allSpecs[i])
+			errs = append(errs, r.err)
 			continue
 		}
-
-		successful = append(successful, spec)
+		successful = append(successful, allSpecs[i])
 	}
 
 	if len(errs) != 0 {
@@ -117,6 +166,11 @@ func do(args uploadArgs) error {
 		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s %s-%s for %s/%s failed to upload\n", f.Pkg, f.Tag, f.Revision, f.Distro, f.Arch)
 	}
 
+	// The plan has been printed instead.
+	if args.dryRun {
+		return nil
+	}
+
 	// After completion, print the downloaded array to stdout as JSON
 	s, err := json.MarshalIndent(&successful, "", "    ")
 	if err != nil {
@@ -126,3 +180,217 @@ func do(args uploadArgs) error {
 	fmt.Println(string(s))
 	return nil
 }
+
+func newBackend(args uploadArgs) (storage.Backend, error) {
+	switch args.backend {
+	case backendAzure:
+		return storage.NewAzureBlob(args.azureAccount, args.azureContainer)
+	case backendLocal:
+		return storage.NewLocalDir(args.localDir)
+	case backendS3:
+		// Credentials and region come from the AWS_* environment variables.
+		return storage.NewS3(storage.S3ConfigFromEnv(args.s3Endpoint, args.s3Bucket))
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %q", args.backend)
+	}
+}
+
+type specResult struct {
+	err  error
+	plan []string
+}
+
+// uploadSpec uploads the signed package of the spec and its provenance.
+func uploadSpec(ctx context.Context, backend storage.Backend, spec archive.Spec, args uploadArgs) specResult {
+	signedPkgPath, err := spec.FullPath(args.signedDir)
+	if err != nil {
+		return specResult{err: err}
+	}
+
+	storagePath, err := spec.StoragePath()
+	if err != nil {
+		return specResult{err: err}
+	}
+
+	files := []*uploadFile{{storagePath: storagePath, path: signedPkgPath}}
+
+	// The provenance describes the package as it was built, before
+	// signing, and is stored next to it. Packages built before provenance
+	// was written are uploaded alone, unless it is required or the packages
+	// are checked against the build.
+	provenancePath := signedPkgPath + provenance.Extension
+	_, err = os.Stat(provenancePath)
+	switch {
+	case err == nil:
+		files = append(files, &uploadFile{storagePath: storagePath + provenance.Extension, path: provenancePath})
+	case errors.Is(err, os.ErrNotExist) && !args.requireProvenance && args.bundleDir == "":
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=warning;]no provenance for %s, uploading the package alone\n", storagePath)
+	default:
+		return specResult{err: fmt.Errorf("missing provenance: %w", err)}
+	}
+
+	if args.bundleDir != "" {
+		if err := checkBuild(spec, signedPkgPath, args.bundleDir); err != nil {
+			return specResult{err: err}
+		}
+	}
+	if args.verify != nil {
+		if err := verifySignatures(signedPkgPath, *args.verify); err != nil {
+			return specResult{err: err}
+		}
+	}
+
+	// Detached signatures, if the files were signed with them, are stored
+	// next to the files too.
+	for _, f := range files {
+		if _, err := os.Stat(f.path + sign.DetachedExtension); err == nil {
+			files = append(files, &uploadFile{storagePath: f.storagePath + sign.DetachedExtension, path: f.path + sign.DetachedExtension})
+		}
+	}
+	for _, f := range files {
+		f.sha256, f.size, err = storage.HashFile(f.path)
+		if err != nil {
+			return specResult{err: err}
+		}
+	}
+
+	plan, err := uploadFiles(ctx, backend, files, args)
+	return specResult{err: err, plan: plan}
+}
+
+// checkBuild checks that the signed package at p is the package of the spec
+// built in bundleDir with nothing but signatures added, and that its
+// provenance is the one written for that build.
+func checkBuild(spec archive.Spec, p, bundleDir string) error {
+	unsigned, err := spec.FullPath(bundleDir)
+	if err != nil {
+		return err
+	}
+	if err := sign.CompareSigned(unsigned, p); err != nil {
+		return err
+	}
+	if err := provenance.CheckSubject(unsigned); err != nil {
+		return err
+	}
+
+	built, err := os.ReadFile(unsigned + provenance.Extension)
+	if err != nil {
+		return err
+	}
+	signed, err := os.ReadFile(p + provenance.Extension)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(built, signed) {
+		return fmt.Errorf("provenance of %s does not match the one built, %s", p, unsigned+provenance.Extension)
+	}
+	return nil
+}
+
+// verifySignatures checks the signature of the package at p, and the detached
+// signatures of it and its provenance if there are any.
+func verifySignatures(p string, opts sign.Options) error {
+	if filepath.Ext(p) == ".zip" && opts.Authenticode == nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=warning;]no --authenticode-verify given, not verifying %s\n", filepath.Base(p))
+	} else if err := sign.VerifyPackage(p, opts); err != nil {
+		return err
+	}
+
+	for _, f := range []string{p, p + provenance.Extension} {
+		if _, err := os.Stat(f + sign.DetachedExtension); err != nil {
+			continue
+		}
+		if err := sign.VerifyFile(f, opts.Verifier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type uploadFile struct {
+	storagePath string
+	path        string
+	sha256      string
+	size        int64
+}
+
+// uploadFiles uploads the files of one spec. What is already stored is
+// checked for all of them first, so that nothing is uploaded if any of them
+// conflicts with a stored file. Files already stored with the same sha256
+// sum are skipped, and every file uploaded is checked afterwards. With
+// --dry-run, the plan is returned instead.
+func uploadFiles(ctx context.Context, backend storage.Backend, files []*uploadFile, args uploadArgs) ([]string, error) {
+	var (
+		plan      []string
+		actions   = make([]storage.Action, len(files))
+		conflicts []error
+	)
+	for i, f := range files {
+		action, props, err := storage.Plan(ctx, backend, f.storagePath, f.sha256, args.force)
+		if err != nil {
+			return plan, err
+		}
+		actions[i] = action
+
+		if args.dryRun {
+			plan = append(plan, fmt.Sprintf("%-9s %s sha256:%s", action, f.storagePath, f.sha256))
+		}
+		if action == storage.ActionConflict {
+			conflicts = append(conflicts, fmt.Errorf("%s: %w: stored %q, have %s; use --force to replace it",
+				f.storagePath, storage.ErrConflict, props.Metadata[storage.Sha256Key], f.sha256))
+		}
+	}
+	if len(conflicts) > 0 {
+		return plan, errors.Join(conflicts...)
+	}
+	if args.dryRun {
+		return plan, nil
+	}
+
+	for i, f := range files {
+		if actions[i] == storage.ActionSkip {
+			fmt.Fprintf(os.Stderr, "%s is already stored with sha256 %s, skipping\n", f.storagePath, f.sha256)
+			continue
+		}
+
+		start := time.Now()
+		if err := storage.PutFile(ctx, backend, f.storagePath, f.path, f.sha256, storage.UploadOptions{
+			Retries:    args.retries,
+			RetryDelay: args.retryDelay,
+			Progress:   progressPrinter(f.storagePath),
+		}); err != nil {
+			return nil, err
+		}
+		if err := storage.Verify(ctx, backend, f.storagePath, f.sha256, f.size); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "uploaded %s (%s) in %s\n", f.storagePath, formatSize(f.size), time.Since(start).Round(time.Millisecond))
+	}
+	return nil, nil
+}
+
+// progressPrinter returns a progress callback which prints a line for every
+// quarter of the file uploaded. With several uploads running at once, a
+// line per update would be unreadable.
+func progressPrinter(name string) func(done, total int64) {
+	var last int64 = -1
+	return func(done, total int64) {
+		if total == 0 {
+			return
+		}
+		quarter := done * 4 / total
+		if quarter == last {
+			return
+		}
+		last = quarter
+		fmt.Fprintf(os.Stderr, "%s: %d%% of %s\n", name, quarter*25, formatSize(total))
+	}
+}
+
+func formatSize(n int64) string {
+	const mib = 1024 * 1024
+	if n < mib {
+		return fmt.Sprintf("%d KiB", (n+1023)/1024)
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/mib)
+}
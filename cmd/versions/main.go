@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Azure/moby-packaging/pkg/index"
+	"github.com/Azure/moby-packaging/pkg/storage"
+)
+
+const (
+	prodContainerName = "moby"
+	cdnURL            = "https://mobyartifacts.azureedge.net"
+
+	backendAzure = "azure"
+	backendLocal = "local"
+	backendS3    = "s3"
+)
+
+type versionsArgs struct {
+	backend        string
+	azureAccount   string
+	azureContainer string
+	localDir       string
+	s3Endpoint     string
+	s3Bucket       string
+
+	prefix      string
+	urlPrefix   string
+	indexURL    string
+	minVersions string
+	outDir      string
+}
+
+func main() {
+	args := versionsArgs{}
+	flag.StringVar(&args.backend, "backend", backendAzure, "where packages are stored: azure, local or s3")
+	flag.StringVar(&args.azureAccount, "azure-account", os.Getenv("AZURE_STORAGE_ACCOUNT"), "azure storage account packages are stored in")
+	flag.StringVar(&args.azureContainer, "azure-container", prodContainerName, "azure storage container packages are stored in")
+	flag.StringVar(&args.localDir, "local-dir", "", "directory packages are stored in, with --backend=local")
+	flag.StringVar(&args.s3Endpoint, "s3-endpoint", "", "base URL of the S3 compatible service packages are stored in, with --backend=s3")
+	flag.StringVar(&args.s3Bucket, "s3-bucket", "", "bucket packages are stored in, with --backend=s3")
+	flag.StringVar(&args.prefix, "prefix", "", "only index packages stored under this prefix, e.g. moby-runc/")
+	flag.StringVar(&args.urlPrefix, "url-prefix", "", "URL packages are downloaded from (default "+cdnURL+"/<azure-container>)")
+	flag.StringVar(&args.indexURL, "index-url", cdnURL+"/index", "URL the index is served from")
+	flag.StringVar(&args.minVersions, "min-versions", "", "JSON file with the oldest version of each package to index (default: the versions built in)")
+	flag.StringVar(&args.outDir, "out-dir", "_versions", "directory to write the index to")
+	flag.Parse()
+
+	if err := do(args); err != nil {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=error;]%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func do(args versionsArgs) error {
+	backend, err := newBackend(args)
+	if err != nil {
+		return err
+	}
+
+	opts := index.Options{
+		URLPrefix:   args.urlPrefix,
+		IndexURL:    args.indexURL,
+		MinVersions: index.DefaultMinVersions(),
+	}
+	if opts.URLPrefix == "" {
+		opts.URLPrefix = cdnURL + "/" + args.azureContainer
+	}
+	if args.minVersions != "" {
+		b, err := os.ReadFile(args.minVersions)
+		if err != nil {
+			return err
+		}
+		opts.MinVersions = map[string]string{}
+		if err := json.Unmarshal(b, &opts.MinVersions); err != nil {
+			return fmt.Errorf("error reading %s: %w", args.minVersions, err)
+		}
+	}
+
+	objs, err := backend.List(context.Background(), args.prefix)
+	if err != nil {
+		return err
+	}
+
+	idx := index.New(objs, opts)
+	for _, err := range idx.Skipped {
+		fmt.Fprintf(os.Stderr, "##vso[task.logissue type=warning;]not indexing %v\n", err)
+	}
+
+	if err := idx.Write(args.outDir); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "indexed %d packages from %s in %s\n", len(idx.Entries), backend, args.outDir)
+	return nil
+}
+
+func newBackend(args versionsArgs) (storage.Backend, error) {
+	switch args.backend {
+	case backendAzure:
+		if args.azureAccount == "" {
+			return nil, fmt.Errorf("you must provide a storage account")
+		}
+		return storage.NewAzureBlob(args.azureAccount, args.azureContainer)
+	case backendLocal:
+		return storage.NewLocalDir(args.localDir)
+	case backendS3:
+		// Credentials and region come from the AWS_* environment variables.
+		return storage.NewS3(storage.S3ConfigFromEnv(args.s3Endpoint, args.s3Bucket))
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %q", args.backend)
+	}
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"embed"
+	"errors"
 	"io/fs"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"dagger.io/dagger"
+	"github.com/Azure/moby-packaging/pkg/provenance"
 )
 
 var (
@@ -85,3 +89,32 @@ func hackCrossDir(client *dagger.Client) *dagger.Directory {
 	}
 	return root
 }
+
+// readPatches returns the patches applied to the source of a package, in the
+// order they are listed in patches/series.
+func readPatches(name string) ([]provenance.Patch, error) {
+	dir := path.Join("packages", name, "patches")
+
+	series, err := fs.ReadFile(packagesFS, path.Join(dir, "series"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var patches []provenance.Patch
+	for _, line := range strings.Split(string(series), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		data, err := fs.ReadFile(packagesFS, path.Join(dir, line))
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, provenance.Patch{Name: path.Join("patches", line), Data: data})
+	}
+	return patches, nil
+}
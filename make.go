@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
@@ -9,22 +10,35 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
 	"dagger.io/dagger"
+	"github.com/Azure/moby-packaging/packages"
+	_ "github.com/Azure/moby-packaging/packages/all"
 	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/provenance"
 	"github.com/Azure/moby-packaging/targets"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/sys/unix"
 )
 
 func main() {
 	outDir := flag.String("output", "bundles", "Output directory for built packages (note the distro name will be appended to this path)")
-	buildSpec := flag.String("build-spec", "", "Location of the build spec json file")
+	buildSpec := flag.String("build-spec", "", "Location of the build spec json file, either a single spec or a list of specs")
+	parallel := flag.Int("parallel", 4, "Maximum number of specs to build at the same time")
+	summaryFile := flag.String("summary", "", "Write a json summary of the build results to this file instead of stdout")
+	verify := flag.Bool("verify-reproducible", false, "Build every spec twice with independent caches and fail if the packages differ")
 
 	flag.Parse()
 
-	spec, err := readBuildSpec(*buildSpec)
+	specs, err := readBuildSpecs(*buildSpec)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "could not read or parse build spec file")
+		fmt.Fprintf(os.Stderr, "could not read or parse build spec file: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *parallel < 1 {
+		fmt.Fprintln(os.Stderr, "--parallel must be at least 1")
 		os.Exit(1)
 	}
 
@@ -43,19 +57,22 @@ func main() {
 		client.Close()
 	}()
 
-	out, err := do(ctx, client, spec)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(3)
-	}
+	summary := buildAll(ctx, client, specs, buildOpts{outDir: *outDir, parallel: *parallel, verify: *verify})
 
-	if _, err := out.Export(ctx, spec.Dir(*outDir)); err != nil {
+	if err := writeSummary(*summaryFile, summary); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(4)
 	}
+
+	if summary.Failed > 0 {
+		os.Exit(3)
+	}
 }
 
-func readBuildSpec(filename string) (*archive.Spec, error) {
+// readBuildSpecs reads a build spec file. For compatibility with existing
+// pipelines the file may hold either a single spec or a list of specs, as
+// consumed by cmd/validate and cmd/upload.
+func readBuildSpecs(filename string) ([]*archive.Spec, error) {
 	if filename == "" {
 		return nil, fmt.Errorf("no build spec file specified")
 	}
@@ -65,24 +82,164 @@ func readBuildSpec(filename string) (*archive.Spec, error) {
 		return nil, err
 	}
 
-	var spec archive.Spec
-	if err := json.Unmarshal(b, &spec); err != nil {
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] != '[' {
+		var spec archive.Spec
+		if err := json.Unmarshal(b, &spec); err != nil {
+			return nil, err
+		}
+		return []*archive.Spec{&spec}, nil
+	}
+
+	var specs []*archive.Spec
+	if err := json.Unmarshal(b, &specs); err != nil {
 		return nil, err
 	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no build specs in %s", filename)
+	}
+
+	return specs, nil
+}
+
+type buildOpts struct {
+	outDir   string
+	parallel int
+	verify   bool
+}
+
+type buildResult struct {
+	Spec     *archive.Spec `json:"spec"`
+	Dir      string        `json:"dir,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration string        `json:"duration"`
+	// Differences is only set when verifying reproducibility, and lists
+	// everything that differed between the two builds.
+	Differences []archive.Difference `json:"differences,omitempty"`
+}
+
+type buildSummary struct {
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []buildResult `json:"results"`
+}
+
+// buildAll builds every spec over the same dagger session, so that cache
+// volumes and layers are shared between builds. A failed build does not stop
+// the others; the outcome of each is recorded in the summary, in the same
+// order as specs.
+func buildAll(ctx context.Context, client *dagger.Client, specs []*archive.Spec, opts buildOpts) *buildSummary {
+	results := make([]buildResult, len(specs))
+
+	var eg errgroup.Group
+	eg.SetLimit(opts.parallel)
+
+	for i, spec := range specs {
+		i, spec := i, spec
+		eg.Go(func() error {
+			start := time.Now()
+
+			var (
+				dir   string
+				diffs []archive.Difference
+				err   error
+			)
+			if opts.verify {
+				dir, diffs, err = buildReproducible(ctx, client, spec, opts.outDir)
+			} else {
+				dir, err = build(ctx, client, spec, opts.outDir, "")
+			}
+
+			results[i] = buildResult{Spec: spec, Dir: dir, Duration: time.Since(start).Round(time.Second).String(), Differences: diffs}
+			if err != nil {
+				results[i].Error = err.Error()
+				fmt.Fprintf(os.Stderr, "build failed: %s %s/%s: %v\n", spec.Pkg, spec.Distro, spec.Arch, err)
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+
+	summary := &buildSummary{Results: results}
+	for _, r := range results {
+		if r.Error != "" {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+	}
+	return summary
+}
+
+func build(ctx context.Context, client *dagger.Client, spec *archive.Spec, outDir, cacheID string) (string, error) {
+	start := time.Now()
+
+	out, target, err := do(ctx, client, spec, cacheID)
+	if err != nil {
+		return "", err
+	}
 
-	return &spec, nil
+	dir := spec.Dir(outDir)
+	if _, err := out.Export(ctx, dir); err != nil {
+		return "", fmt.Errorf("error exporting packages: %w", err)
+	}
+
+	if err := writeProvenance(ctx, target, spec, dir, start); err != nil {
+		return "", fmt.Errorf("error writing provenance: %w", err)
+	}
+	return dir, nil
 }
 
-func do(ctx context.Context, client *dagger.Client, cfg *archive.Spec) (*dagger.Directory, error) {
+// writeProvenance records how the packages in dir were built, in a file next
+// to each package.
+func writeProvenance(ctx context.Context, target *targets.Target, spec *archive.Spec, dir string, start time.Time) error {
+	images, err := target.Images(ctx)
+	if err != nil {
+		return err
+	}
+
+	patches, err := readPatches(spec.Pkg)
+	if err != nil {
+		return err
+	}
+
+	b := provenance.Build{
+		Spec:       *spec,
+		GoVersion:  target.GoVersion(),
+		Images:     images,
+		Patches:    patches,
+		StartedOn:  start,
+		FinishedOn: time.Now(),
+	}
+	_, err = b.WriteFiles(dir)
+	return err
+}
+
+func writeSummary(filename string, summary *buildSummary) error {
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if filename == "" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(filename, b, 0o644)
+}
+
+// do builds the spec. A non-empty cacheID isolates the build from the caches
+// of every build with a different id; see Target.WithIsolatedCache.
+func do(ctx context.Context, client *dagger.Client, cfg *archive.Spec, cacheID string) (*dagger.Directory, *targets.Target, error) {
 	if cfg.Arch == "" {
 		p, err := client.DefaultPlatform(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("could not determine default platform: %w", err)
+			return nil, nil, fmt.Errorf("could not determine default platform: %w", err)
 		}
 
 		_, a, ok := strings.Cut(string(p), "/")
 		if !ok {
-			return nil, fmt.Errorf("unexpected platform format: %q", p)
+			return nil, nil, fmt.Errorf("unexpected platform format: %q", p)
 		}
 		cfg.Arch = a
 	}
@@ -93,15 +250,18 @@ func do(ctx context.Context, client *dagger.Client, cfg *archive.Spec) (*dagger.
 	}
 	platform := dagger.Platform(fmt.Sprintf("%s/%s", targetOs, cfg.Arch))
 
-	getGoVersion, ok := targets.GetGoVersionForPackage[cfg.Pkg]
-	if !ok {
-		return nil, fmt.Errorf("unknown package: %q", cfg.Pkg)
+	project, err := packages.Get(cfg.Pkg)
+	if err != nil {
+		return nil, nil, err
 	}
-	goVersion := getGoVersion(cfg)
 
-	target, err := targets.GetTarget(ctx, cfg.Distro, client, platform, goVersion)
+	target, err := targets.GetTarget(ctx, cfg.Distro, client, platform, project.GoVersion(cfg))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if cacheID != "" {
+		target = target.WithIsolatedCache(cacheID)
 	}
-	return target.Make(cfg, packageDir(client, cfg.Pkg), hackCrossDir(client))
+	out, err := target.Make(cfg, packageDir(client, cfg.Pkg), hackCrossDir(client))
+	return out, target, err
 }
@@ -0,0 +1,7 @@
+// Package all registers every in-tree project defined in Go. Import it for
+// its side effects from any command that needs to look projects up by name.
+package all
+
+import (
+	_ "github.com/Azure/moby-packaging/packages/moby-containerd"
+)
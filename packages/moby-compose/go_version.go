@@ -1,10 +0,0 @@
-package compose
-
-import (
-	"github.com/Azure/moby-packaging/pkg/archive"
-	"github.com/Azure/moby-packaging/pkg/goversion"
-)
-
-func GoVersion(s *archive.Spec) string {
-	return goversion.OneTwentyFour
-}
@@ -1,31 +1,18 @@
 package containerd
 
 import (
-	_ "embed"
 	"fmt"
 	"strings"
 
-	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/packages"
+	"github.com/Azure/moby-packaging/pkg/manifest"
 	"github.com/Masterminds/semver/v3"
 )
 
-var (
-	//go:embed postinstall/deb/postinstall
-	debPostInstall string
-	//go:embed postinstall/deb/prerm
-	debPreRm string
-	//go:embed postinstall/deb/postrm
-	debPostRm string
-
-	//go:embed postinstall/rpm/postinstall
-	rpmPostInstall string
-	//go:embed postinstall/rpm/prerm
-	rpmPreRm string
-	//go:embed postinstall/rpm/upgrade
-	rpmUpgrade string
-)
-
-func Archives(version string) (map[string]archive.Archive, error) {
+// Manifest returns the manifest for the version of containerd being built.
+// The package layout changed between containerd 1.x and 2.x, so 1.x has a
+// manifest of its own next to package.json.
+func Manifest(version string) (*manifest.Manifest, error) {
 	// We use `~` in packaging to indicate that the version is a pre-release version.
 	// semver does not recognize `~`.
 	// We only really care about major/minor version here, so we can just cut off the pre-release part.
@@ -37,9 +24,9 @@ func Archives(version string) (map[string]archive.Archive, error) {
 
 	switch v.Major() {
 	case 1:
-		return Archives_1_X, nil
+		return manifest.LoadFile(packages.FS, "moby-containerd", "package-1.x.json")
 	case 2:
-		return Archives_2_0, nil
+		return manifest.LoadFile(packages.FS, "moby-containerd", manifest.Filename)
 	default:
 		return nil, fmt.Errorf("unsupported version: %s", version)
 	}
@@ -0,0 +1,84 @@
+package containerd
+
+import (
+	"context"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/Azure/moby-packaging/packages"
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/goversion"
+	"github.com/Azure/moby-packaging/pkg/mirror"
+)
+
+const (
+	defaultRepo    = "https://github.com/containerd/containerd.git"
+	hcsShimGitRepo = "https://github.com/Microsoft/hcsshim.git"
+)
+
+func init() {
+	packages.Register(project{})
+}
+
+type project struct{}
+
+func (project) Name() string {
+	return "moby-containerd"
+}
+
+func (project) DefaultRepo() string {
+	return defaultRepo
+}
+
+// The package layout changed between containerd 1.x and 2.x, so the
+// mappings depend on the version being built.
+func (project) Archives(spec *archive.Spec) (map[string]archive.Archive, error) {
+	m, err := Manifest(spec.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return m.Archives()
+}
+
+func (project) GoVersion(spec *archive.Spec) string {
+	m, err := Manifest(spec.Tag)
+	if err != nil || m.GoVersion == "" {
+		return goversion.DefaultVersion
+	}
+	return m.GoVersion
+}
+
+func (p project) Source(client *dagger.Client, spec *archive.Spec) (*dagger.Directory, error) {
+	src := packages.GitSource(client, p, spec)
+	if spec.Distro == "windows" {
+		return injectHCSShimSource(client, src)
+	}
+
+	return src, nil
+}
+
+// Windows builds need the hcsshim source at the version pinned in
+// containerd's go.mod.
+func injectHCSShimSource(client *dagger.Client, src *dagger.Directory) (*dagger.Directory, error) {
+	c := client.Container().
+		From(mirror.Prefix()+"/buildpack-deps:buster").
+		WithDirectory("/src", src)
+
+	commit, err := c.
+		WithDirectory("/out", client.Directory()).
+		WithWorkdir("/src").
+		WithExec([]string{"awk", `/Microsoft\/hcsshim/{ print $2 >"/out/COMMIT" }`, "go.mod"}).
+		File("/out/COMMIT").
+		Contents(context.TODO())
+
+	if err != nil {
+		return nil, err
+	}
+
+	commit = strings.Trim(commit, " \n\t\r")
+
+	hcsShimSourceDir := packages.FetchRef(client, hcsShimGitRepo, commit).Tree()
+	dir := c.WithDirectory("/src/hcs-shim", hcsShimSourceDir).Directory("/src")
+
+	return dir, nil
+}
@@ -0,0 +1,17 @@
+package packages
+
+import (
+	"embed"
+
+	"github.com/Azure/moby-packaging/pkg/manifest"
+)
+
+//go:embed moby-*
+var FS embed.FS
+
+// Manifest loads the declarative definition of a package from
+// packages/<name>/package.json. Packages which are still defined in Go do not
+// have one, in which case the returned error wraps fs.ErrNotExist.
+func Manifest(name string) (*manifest.Manifest, error) {
+	return manifest.Load(FS, name)
+}
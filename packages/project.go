@@ -0,0 +1,141 @@
+package packages
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+
+	"dagger.io/dagger"
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/goversion"
+	"github.com/Azure/moby-packaging/pkg/manifest"
+)
+
+// Project describes how to fetch and package one of the projects we build.
+// Projects defined in Go register themselves with Register from an init
+// function; see packages/all for the in-tree ones. Projects defined by a
+// package.json manifest do not need to register.
+type Project interface {
+	// Name is the name of the package, e.g. "moby-engine".
+	Name() string
+	// DefaultRepo is the git repository the source is fetched from when the
+	// build spec does not set one.
+	DefaultRepo() string
+	// Archives returns the package layout for every supported distro. The
+	// spec is supplied so that the layout can depend on the version being
+	// built.
+	Archives(*archive.Spec) (map[string]archive.Archive, error)
+	// GoVersion returns the Go toolchain version to build the spec with.
+	GoVersion(*archive.Spec) string
+	// Source returns the source tree to build.
+	Source(*dagger.Client, *archive.Spec) (*dagger.Directory, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Project{}
+)
+
+// Register makes a project available by name. It panics if a project with
+// the same name is already registered.
+func Register(p Project) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[p.Name()]; ok {
+		panic("project registered twice: " + p.Name())
+	}
+	registry[p.Name()] = p
+}
+
+// Get returns the project with the given name, looking first at registered
+// projects and then at package manifests.
+func Get(name string) (Project, error) {
+	registryMu.RLock()
+	p, ok := registry[name]
+	registryMu.RUnlock()
+	if ok {
+		return p, nil
+	}
+
+	m, err := Manifest(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unknown package: %q", name)
+		}
+		return nil, err
+	}
+
+	return &manifestProject{m: m}, nil
+}
+
+// Names returns the names of all known projects, sorted.
+func Names() ([]string, error) {
+	registryMu.RLock()
+	seen := make(map[string]struct{}, len(registry))
+	for name := range registry {
+		seen[name] = struct{}{}
+	}
+	registryMu.RUnlock()
+
+	manifests, err := fs.Glob(FS, "*/"+manifest.Filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range manifests {
+		seen[path.Dir(m)] = struct{}{}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// FetchRef returns the given commit of a git repository.
+func FetchRef(client *dagger.Client, repo, commit string) *dagger.GitRef {
+	return client.Git(repo, dagger.GitOpts{KeepGitDir: true}).Commit(commit)
+}
+
+// GitSource fetches the commit named in the spec, falling back to the
+// default repo of the project if the spec does not name one. It is the
+// Source implementation used by most projects.
+func GitSource(client *dagger.Client, p Project, spec *archive.Spec) *dagger.Directory {
+	repo := spec.Repo
+	if repo == "" {
+		repo = p.DefaultRepo()
+	}
+	return FetchRef(client, repo, spec.Commit).Tree()
+}
+
+type manifestProject struct {
+	m *manifest.Manifest
+}
+
+func (p *manifestProject) Name() string {
+	return p.m.Name
+}
+
+func (p *manifestProject) DefaultRepo() string {
+	return p.m.Repo
+}
+
+func (p *manifestProject) Archives(*archive.Spec) (map[string]archive.Archive, error) {
+	return p.m.Archives()
+}
+
+func (p *manifestProject) GoVersion(*archive.Spec) string {
+	if p.m.GoVersion != "" {
+		return p.m.GoVersion
+	}
+	return goversion.DefaultVersion
+}
+
+func (p *manifestProject) Source(client *dagger.Client, spec *archive.Spec) (*dagger.Directory, error) {
+	return GitSource(client, p, spec), nil
+}
@@ -12,12 +12,7 @@ const (
 )
 
 const (
-	flagPostInstall     = "--after-install"
-	flagUpgrade         = "--after-upgrade"
-	flagPreRm           = "--before-remove"
-	flagPostRm          = "--after-remove"
 	filenamePostInstall = "postinst"
-	filenamePostUpgrade = "postup"
 	filenamePreRm       = "prerm"
 	filenamePostRm      = "postrm"
 )
@@ -34,6 +29,23 @@ type InstallScript struct {
 	Script string
 }
 
+type TriggerKind int
+
+const (
+	TriggerInstall TriggerKind = iota
+	TriggerUninstall
+	TriggerPostUninstall
+)
+
+// Trigger is an rpm trigger script which runs when another package is
+// installed or removed. Package is a dependency such as "firewalld" or
+// "containerd.io >= 1.6".
+type Trigger struct {
+	When    TriggerKind
+	Package string
+	Script  string
+}
+
 type Archive struct {
 	Name    string
 	Distro  string
@@ -53,5 +65,12 @@ type Archive struct {
 	BuildDeps      []string
 	RuntimeDeps    []string
 	InstallScripts []InstallScript
-	Description    string
+	// rpm only
+	Triggers    []Trigger
+	Description string
+	// Compression used for the package payload. Defaults to gzip.
+	Compression Compression
+	// EmbedSBOM installs the SBOM of the package under /usr/share/doc/<pkg>/
+	// in addition to writing it next to the package.
+	EmbedSBOM bool
 }
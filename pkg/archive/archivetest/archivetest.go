@@ -0,0 +1,56 @@
+// Package archivetest builds small packages with the writers of package
+// archive, for the tests of the packages which read, sign or publish them.
+package archivetest
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+// WritePackages writes a deb and an rpm of moby-runc 1.1.12, each installing
+// /usr/bin/runc, to a temporary directory and returns their paths.
+func WritePackages(t testing.TB) (deb, rpm string) {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr/bin/runc"), []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	for _, w := range []struct {
+		name  string
+		write func(io.Writer, string) error
+		dst   *string
+	}{
+		{"moby-runc_1.1.12-ubuntu22.04u1_amd64.deb", (&archive.DebWriter{
+			Control: "Package: moby-runc\nVersion: 1.1.12-ubuntu22.04u1\nArchitecture: amd64\nDepends: libc6, libseccomp2\nDescription: runc\n CLI tool.\n",
+			ModTime: time.Unix(1700000000, 0),
+		}).Write, &deb},
+		{"moby-runc-1.1.12-1.cm2.x86_64.rpm", (&archive.RpmWriter{
+			Name: "moby-runc", Version: "1.1.12", Release: "1", Dist: "cm2", Arch: "x86_64",
+			Summary: "runc", Description: "CLI tool.", License: "Apache-2.0",
+			Requires: []string{"libseccomp >= 2.5", "/bin/sh"},
+			ModTime:  time.Unix(1700000000, 0),
+		}).Write, &rpm},
+	} {
+		*w.dst = filepath.Join(out, w.name)
+		f, err := os.Create(*w.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.write(f, root); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	return deb, rpm
+}
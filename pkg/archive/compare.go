@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Difference is a single property that differs between two builds of the
+// same package.
+type Difference struct {
+	// Member is the archive member or installed file the difference was
+	// found in, or "fields"/"scripts" for package metadata.
+	Member string `json:"member"`
+	Field  string `json:"field"`
+	A      string `json:"a"`
+	B      string `json:"b"`
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s: %q != %q", d.Member, d.Field, d.A, d.B)
+}
+
+// ComparePackages compares two builds of a package member by member and
+// returns every difference found, sorted by member and field. Identical
+// packages produce no differences.
+func ComparePackages(a, b *PackageContents) []Difference {
+	var diffs []Difference
+	add := func(member, field, va, vb string) {
+		if va != vb {
+			diffs = append(diffs, Difference{Member: member, Field: field, A: va, B: vb})
+		}
+	}
+
+	add("package", "kind", string(a.Kind), string(b.Kind))
+	compareMaps("fields", a.Fields, b.Fields, add)
+	compareMaps("scripts", a.Scripts, b.Scripts, add)
+	compareMembers(a.Parts, b.Parts, add)
+	compareMembers(a.Files, b.Files, add)
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Member != diffs[j].Member {
+			return diffs[i].Member < diffs[j].Member
+		}
+		return diffs[i].Field < diffs[j].Field
+	})
+	return diffs
+}
+
+func compareMaps(member string, a, b map[string]string, add func(member, field, a, b string)) {
+	keys := map[string]struct{}{}
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	for k := range keys {
+		add(member, k, a[k], b[k])
+	}
+}
+
+func compareMembers(a, b []Member, add func(member, field, a, b string)) {
+	byName := func(ms []Member) map[string]Member {
+		m := make(map[string]Member, len(ms))
+		for _, v := range ms {
+			m[v.Name] = v
+		}
+		return m
+	}
+	ma, mb := byName(a), byName(b)
+
+	for name, x := range ma {
+		y, ok := mb[name]
+		if !ok {
+			add(name, "present", "yes", "no")
+			continue
+		}
+		add(name, "mode", x.Mode.String(), y.Mode.String())
+		add(name, "mtime", x.ModTime.Format(time.RFC3339), y.ModTime.Format(time.RFC3339))
+		add(name, "size", fmt.Sprint(x.Size), fmt.Sprint(y.Size))
+		add(name, "sha256", x.Sha256, y.Sha256)
+		add(name, "link", x.Link, y.Link)
+		add(name, "owner", x.Owner, y.Owner)
+		add(name, "group", x.Group, y.Group)
+	}
+	for name := range mb {
+		if _, ok := ma[name]; !ok {
+			add(name, "present", "no", "yes")
+		}
+	}
+}
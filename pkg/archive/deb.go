@@ -2,10 +2,15 @@ package archive
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"dagger.io/dagger"
 )
@@ -36,32 +41,80 @@ Provides: {{ join .Provides }}
 Description: {{ .Description }}
 `
 
-var (
-	DebDistroMap = map[string]string{
-		"xenial":  "ubuntu16.04",
-		"yakkety": "ubuntu16.10",
-		"zesty":   "ubuntu17.04",
-		"artful":  "ubuntu17.10",
-		"bionic":  "ubuntu18.04",
-		"cosmic":  "ubuntu18.10",
-		"disco":   "ubuntu19.04",
-		"eoan":    "ubuntu19.10",
-		"focal":   "ubuntu20.04",
-		"groovy":  "ubuntu20.10",
-		"hirsute": "ubuntu21.04",
-		"impish":  "ubuntu21.10",
-		"jammy":   "ubuntu22.04",
-		"kinetic": "ubuntu22.10",
-		"noble":   "ubuntu24.04",
-		"lunar":   "ubuntu23.04",
-
-		"buster":   "debian10",
-		"bullseye": "debian11",
-		"bookworm": "debian12",
-		"trixie":   "debian13",
-		"forky":    "debian14",
-	}
-)
+const debPostinstTemplate = `#!/bin/sh
+
+after_upgrade() {
+  {{ replace .AfterUpgrade "\n" "\n  " }}
+{{- range .Units }}
+  systemctl --system daemon-reload >/dev/null || true
+  if ! systemctl is-enabled {{ . }} >/dev/null; then
+    systemctl enable {{ . }} >/dev/null || true
+    systemctl start {{ . }} >/dev/null || true
+  else
+    systemctl restart {{ . }} >/dev/null || true
+  fi
+{{- end }}
+  :
+}
+
+after_install() {
+  {{ replace .AfterInstall "\n" "\n  " }}
+{{- range .Units }}
+  systemctl --system daemon-reload >/dev/null || true
+  systemctl enable {{ . }} >/dev/null || true
+  systemctl start {{ . }} >/dev/null || true
+{{- end }}
+  :
+}
+
+if [ "${1}" = "configure" -a -z "${2}" ] || [ "${1}" = "abort-remove" ]; then
+  after_install "$@"
+elif [ "${1}" = "configure" -a -n "${2}" ]; then
+  after_upgrade "$@"
+elif echo "${1}" | grep -E -q "(abort|fail)"; then
+  echo "Failed to install before the post-installation script was run." >&2
+  exit 1
+fi
+`
+
+const debPrermTemplate = `#!/bin/sh
+
+before_remove() {
+{{- range .Units }}
+  systemctl stop {{ . }} >/dev/null || true
+  systemctl disable {{ . }} >/dev/null || true
+  systemctl --system daemon-reload >/dev/null || true
+{{- end }}
+  {{ replace .BeforeRemove "\n" "\n  " }}
+  :
+}
+
+if [ "${1}" = "remove" -a -z "${2}" ]; then
+  before_remove "$@"
+elif echo "${1}" | grep -E -q "(fail|abort)"; then
+  echo "Failed to install before the pre-removal script was run." >&2
+  exit 1
+fi
+`
+
+const debPostrmTemplate = `#!/bin/sh
+
+after_remove() {
+  {{ replace .AfterRemove "\n" "\n  " }}
+  :
+}
+
+if [ "${1}" = "remove" -o "${1}" = "abort-install" ]; then
+  after_remove "$@"
+elif [ "${1}" = "purge" -a -z "${2}" ]; then
+  :
+elif [ "${1}" = "upgrade" ]; then
+  :
+elif echo "${1}" | grep -E -q "(fail|abort)"; then
+  echo "Failed to install before the post-removal script was run." >&2
+  exit 1
+fi
+`
 
 type DebPackager struct {
 	a            Archive
@@ -79,113 +132,208 @@ func NewDebPackager(a *Archive, mp string) *DebPackager {
 	}
 }
 
-func (d *DebPackager) Package(client *dagger.Client, c *dagger.Container, project *Spec) *dagger.Directory {
+func (d *DebPackager) Package(client *dagger.Client, c *dagger.Container, project *Spec) (*dagger.Directory, error) {
+	ctx := context.TODO()
 	dir := client.Directory()
 	rootDir := "/package"
 
-	version := fmt.Sprintf("%s-%su%s", project.Tag, DebDistroMap[project.Distro], project.Revision)
+	distro, err := LookupDistro(project.Distro)
+	if err != nil {
+		return nil, err
+	}
+
+	version := fmt.Sprintf("%s-%su%s", project.Tag, distro.Tag, project.Revision)
 	c = c.WithDirectory(rootDir, dir)
 	c = d.moveStaticFiles(c, rootDir)
 	c = d.withControlFile(c, version, project)
 
-	pkgDir := c.Directory(rootDir)
+	control, err := c.File("/build/control").Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error generating control file: %w", err)
+	}
+
+	scripts, err := d.maintainerScripts()
+	if err != nil {
+		return nil, err
+	}
+
+	modTime, err := sourceDateEpoch(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	stage, err := os.MkdirTemp("", "moby-deb-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	pkgRoot := filepath.Join(stage, "package")
+	if _, err := c.Directory(rootDir).Export(ctx, pkgRoot); err != nil {
+		return nil, fmt.Errorf("error exporting package root: %w", err)
+	}
+
+	conffiles, err := defaultConffiles(pkgRoot)
+	if err != nil {
+		return nil, err
+	}
 
-	fpmArgs := []string{"fpm",
-		"-s", "dir",
-		"-t", "deb",
-		"-n", project.Pkg,
-		"--version", version,
-		"--architecture", strings.Replace(project.Arch, "/", "", -1),
-		"--deb-custom-control", "/build/control",
+	outDir := filepath.Join(stage, "out")
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, err
 	}
 
-	var newArgs []string
-	c, newArgs = d.withInstallScripts(c)
+	filename := fmt.Sprintf("%s_%s_%s.deb", project.Pkg, version, strings.Replace(project.Arch, "/", "", -1))
+	if err := d.a.writeSBOM(ctx, c, project, version, d.a.installedBinaries(), pkgRoot, outDir, filename, modTime); err != nil {
+		return nil, err
+	}
 
-	fpmArgs = append(fpmArgs, d.systemdArgs()...)
-	fpmArgs = append(fpmArgs, newArgs...)
-	fpmArgs = append(fpmArgs, ".")
+	f, err := os.Create(filepath.Join(outDir, filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	w := DebWriter{
+		Control:     control,
+		Scripts:     scripts,
+		Conffiles:   conffiles,
+		Compression: d.a.Compression,
+		ModTime:     modTime,
+	}
+	if err := w.Write(f, pkgRoot); err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", filename, err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
 
-	fpm := fpmContainer(client, d.mirrorPrefix)
-	return fpm.WithDirectory("/package", pkgDir).
-		WithDirectory("/build", c.Directory("/build")).
-		WithWorkdir("/package").
-		WithExec(fpmArgs).
-		WithExec([]string{"bash", "-ec", `mkdir -vp /out; mv *.deb /out`}).
-		Directory("/out")
+	// The staging directory is removed when we return, so make sure the
+	// engine has loaded it before then.
+	return client.Host().Directory(outDir).Sync(ctx)
 }
 
 func (d *DebPackager) moveStaticFiles(c *dagger.Container, rootdir string) *dagger.Container {
-	for i := range d.a.Files {
-		f := d.a.Files[i]
+	files := d.a.Files
+	for i := range d.a.Systemd {
+		sd := d.a.Systemd[i]
+		files = append(files, File{
+			Source: sd.Source,
+			Dest:   sd.Dest,
+		})
+	}
+
+	for i := range files {
+		f := files[i]
 		c = f.MoveStaticFile(c, rootdir)
 	}
 
 	return c
 }
 
-func (d *DebPackager) withInstallScripts(c *dagger.Container) (*dagger.Container, []string) {
-	newArgs := []string{}
+// maintainerScripts renders the postinst, prerm and postrm scripts for the
+// package. The dispatch on the script arguments follows what fpm used to
+// generate, so packages built before and after the switch upgrade into each
+// other cleanly.
+func (d *DebPackager) maintainerScripts() (map[string]string, error) {
+	var units []string
+	for _, sd := range d.a.Systemd {
+		units = append(units, filepath.Base(sd.Dest))
+	}
 
-	for i := range d.a.InstallScripts {
-		script := d.a.InstallScripts[i]
-		var a []string
-		c, a = d.installScript(&script, c)
-		newArgs = append(newArgs, a...)
+	data := struct {
+		Units        []string
+		AfterInstall string
+		AfterUpgrade string
+		BeforeRemove string
+		AfterRemove  string
+	}{Units: units}
+
+	for _, script := range d.a.InstallScripts {
+		switch script.When {
+		case PkgActionPostInstall:
+			data.AfterInstall += script.Script + "\n"
+		case PkgActionUpgrade:
+			data.AfterUpgrade += script.Script + "\n"
+		case PkgActionPreRemoval:
+			data.BeforeRemove += script.Script + "\n"
+		case PkgActionPostRemoval:
+			data.AfterRemove += script.Script + "\n"
+		default:
+			return nil, fmt.Errorf("unrecognized package action: %d", script.When)
+		}
 	}
 
-	return c, newArgs
+	templates := map[string]string{
+		filenamePostInstall: debPostinstTemplate,
+		filenamePreRm:       debPrermTemplate,
+		filenamePostRm:      debPostrmTemplate,
+	}
+
+	scripts := make(map[string]string, len(templates))
+	for name, t := range templates {
+		tpl, err := template.New(name).Funcs(template.FuncMap{"replace": strings.ReplaceAll}).Parse(t)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := new(bytes.Buffer)
+		if err := tpl.Execute(buf, data); err != nil {
+			return nil, err
+		}
+		scripts[name] = buf.String()
+	}
+
+	return scripts, nil
 }
 
-func (d *DebPackager) installScript(script *InstallScript, c *dagger.Container) (*dagger.Container, []string) {
-	newArgs := []string{}
-
-	var templateStr, filename, flag string
-	switch script.When {
-	case PkgActionPostInstall:
-		filename = filenamePostInstall
-		flag = flagPostInstall
-		templateStr = `
-{{ replace .Script "\n" "\n  " }}
-            `
-	case PkgActionUpgrade:
-		filename = filenamePostUpgrade
-		flag = flagUpgrade
-		templateStr = `
-{{ replace .Script "\n" "\n  " }}
-            `
-	case PkgActionPreRemoval:
-		filename = filenamePreRm
-		flag = flagPreRm
-		templateStr = `
-{{ replace .Script "\n" "\n  " }}
-            `
-	case PkgActionPostRemoval:
-		filename = filenamePostRm
-		flag = flagPostRm
-		templateStr = `
-{{ replace .Script "\n" "\n  " }}
-            `
-	default:
-		panic("unrecognized package action: " + fmt.Sprintf("%d", script.When))
-	}
-
-	filename = filepath.Join("/build", filename)
-
-	tpl, err := template.New("installScript").Funcs(template.FuncMap{"replace": strings.ReplaceAll}).Parse(templateStr)
+// defaultConffiles marks every regular file under /etc as a conffile so dpkg
+// does not clobber local changes on upgrade.
+func defaultConffiles(root string) ([]string, error) {
+	var conffiles []string
+
+	etc := filepath.Join(root, "etc")
+	if _, err := os.Stat(etc); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	err := filepath.WalkDir(etc, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		conffiles = append(conffiles, "/"+filepath.ToSlash(rel))
+		return nil
+	})
+
+	return conffiles, err
+}
+
+// sourceDateEpoch returns the time set in SOURCE_DATE_EPOCH on the build
+// container, or the zero time if it is not set.
+func sourceDateEpoch(ctx context.Context, c *dagger.Container) (time.Time, error) {
+	v, err := c.EnvVariable(ctx, "SOURCE_DATE_EPOCH")
 	if err != nil {
-		panic(err)
+		return time.Time{}, err
 	}
 
-	buf := new(bytes.Buffer)
-	err = tpl.Execute(buf, script)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	sec, err := strconv.ParseInt(v, 10, 64)
 	if err != nil {
-		panic(err)
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", v, err)
 	}
 
-	c = c.WithNewFile(filename, buf.String())
-	newArgs = append(newArgs, flag, filename)
-	return c, newArgs
+	return time.Unix(sec, 0).UTC(), nil
 }
 
 func (d *DebPackager) withControlFile(c *dagger.Container, version string, project *Spec) *dagger.Container {
@@ -235,21 +383,3 @@ EOF
         `,
 		})
 }
-
-func (d *DebPackager) systemdArgs() []string {
-	args := []string{}
-
-	for i := range d.a.Systemd {
-		sd := d.a.Systemd[i]
-		args = append(args, "--deb-systemd", sd.Source)
-	}
-
-	// this could change
-	args = append(args,
-		"--deb-systemd-enable",
-		"--deb-systemd-auto-start",
-		"--deb-systemd-restart-after-upgrade",
-	)
-
-	return args
-}
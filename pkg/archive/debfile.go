@@ -0,0 +1,396 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	CompressionXz   Compression = "xz"
+	CompressionZstd Compression = "zstd"
+	CompressionNone Compression = "none"
+)
+
+const (
+	debBinaryVersion = "2.0\n"
+	arMagic          = "!<arch>\n"
+)
+
+// Extension returns the file extension used for a tarball compressed with
+// this method, including the leading dot. An empty Compression is treated as
+// gzip.
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionXz:
+		return ".xz"
+	case CompressionZstd:
+		return ".zst"
+	case CompressionNone:
+		return ""
+	default:
+		return ".gz"
+	}
+}
+
+// compress returns the compressed form of b. The compressors are all pure Go,
+// so the output does not depend on the tools installed on the host, and are
+// run single-threaded to keep it reproducible.
+func (c Compression) compress(b []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	var zw io.WriteCloser
+	switch c {
+	case "", CompressionGzip:
+		// gzip.NewWriter leaves the name and mtime fields of the header
+		// empty, which is what we want for reproducible output.
+		w, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		zw = w
+	case CompressionNone:
+		return b, nil
+	case CompressionXz:
+		w, err := xz.NewWriter(buf)
+		if err != nil {
+			return nil, err
+		}
+		zw = w
+	case CompressionZstd:
+		w, err := zstd.NewWriter(buf, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		zw = w
+	default:
+		return nil, fmt.Errorf("unsupported compression: %q", c)
+	}
+
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DebWriter assembles a binary debian package from a staged root directory
+// without relying on dpkg-deb or fpm. The output only depends on the contents
+// of the root directory and the fields below, so two runs with the same
+// ModTime produce byte-identical packages.
+type DebWriter struct {
+	// Control is the contents of the DEBIAN/control file.
+	Control string
+	// Scripts maps maintainer script names (preinst, postinst, prerm,
+	// postrm) to their contents.
+	Scripts map[string]string
+	// Conffiles is a list of absolute paths to mark as configuration files.
+	Conffiles []string
+	// Compression is used for data.tar. control.tar is always gzipped so
+	// that every supported dpkg can read it.
+	Compression Compression
+	// ModTime is used as the timestamp of every archive member. If it is
+	// zero, the modification times from the root directory are used.
+	ModTime time.Time
+}
+
+// Write writes the package for the contents of root to w.
+func (d *DebWriter) Write(w io.Writer, root string) error {
+	sums := new(bytes.Buffer)
+
+	data, err := d.dataTar(root, sums)
+	if err != nil {
+		return fmt.Errorf("error creating data.tar: %w", err)
+	}
+
+	control, err := d.controlTar(sums.Bytes())
+	if err != nil {
+		return fmt.Errorf("error creating control.tar: %w", err)
+	}
+
+	if _, err := io.WriteString(w, arMagic); err != nil {
+		return err
+	}
+
+	members := []struct {
+		name string
+		b    []byte
+	}{
+		{"debian-binary", []byte(debBinaryVersion)},
+		{"control.tar.gz", control},
+		{"data.tar" + d.Compression.Extension(), data},
+	}
+
+	for _, m := range members {
+		if err := d.writeArMember(w, m.name, m.b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DebWriter) mtime(fi fs.FileInfo) time.Time {
+	if d.ModTime.IsZero() {
+		return fi.ModTime().UTC().Truncate(time.Second)
+	}
+	return d.ModTime.UTC().Truncate(time.Second)
+}
+
+func (d *DebWriter) writeArMember(w io.Writer, name string, b []byte) error {
+	return WriteArMember(w, ArMember{Name: name, ModTime: d.ModTime, Data: b})
+}
+
+// ArMember is a member of an ar archive, such as the parts of a deb.
+type ArMember struct {
+	Name    string
+	ModTime time.Time
+	Mode    fs.FileMode
+	Data    []byte
+}
+
+// WriteArMember writes the header and data of m to w, which must be an ar
+// archive at the end of a member, or just after its magic. A zero ModTime is
+// written as the epoch and a zero Mode as 0644.
+func WriteArMember(w io.Writer, m ArMember) error {
+	var mtime int64
+	if !m.ModTime.IsZero() {
+		mtime = m.ModTime.Unix()
+	}
+	mode := m.Mode.Perm()
+	if mode == 0 {
+		mode = 0o644
+	}
+
+	hdr := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8s%-10d`\n", m.Name, mtime, 0, 0, fmt.Sprintf("100%o", mode), len(m.Data))
+	if len(hdr) != 60 {
+		return fmt.Errorf("invalid ar header for %s", m.Name)
+	}
+
+	if _, err := io.WriteString(w, hdr); err != nil {
+		return err
+	}
+	if _, err := w.Write(m.Data); err != nil {
+		return err
+	}
+	if len(m.Data)%2 != 0 {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadAr returns the members of the ar archive in b, in order. The data of
+// each member is a slice of b.
+func ReadAr(b []byte) ([]ArMember, error) {
+	if !bytes.HasPrefix(b, []byte(arMagic)) {
+		return nil, errors.New("not an ar archive")
+	}
+
+	var members []ArMember
+	rest := b[len(arMagic):]
+	for len(rest) > 0 {
+		if len(rest) < 60 {
+			return nil, errors.New("truncated ar header")
+		}
+		hdr := rest[:60]
+		name := strings.TrimSuffix(strings.TrimSpace(string(hdr[0:16])), "/")
+		mtime, _ := strconv.ParseInt(strings.TrimSpace(string(hdr[16:28])), 10, 64)
+		mode, _ := strconv.ParseUint(strings.TrimSpace(string(hdr[40:48])), 8, 32)
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || size < 0 || int64(len(rest)-60) < size {
+			return nil, fmt.Errorf("bad ar member size for %s", name)
+		}
+		members = append(members, ArMember{
+			Name:    name,
+			ModTime: time.Unix(mtime, 0).UTC(),
+			Mode:    fs.FileMode(mode).Perm(),
+			Data:    rest[60 : 60+size],
+		})
+
+		rest = rest[60+size:]
+		if size%2 != 0 && len(rest) > 0 {
+			rest = rest[1:]
+		}
+	}
+	return members, nil
+}
+
+func (d *DebWriter) dataTar(root string, sums io.Writer) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	// WalkDir visits entries in lexical order, which keeps the member order
+	// stable between builds.
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Name:    "./",
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: d.mtime(info),
+			Uname:   "root",
+			Gname:   "root",
+			Format:  tar.FormatGNU,
+		}
+		if rel != "." {
+			hdr.Name = "./" + rel
+		}
+
+		switch {
+		case info.IsDir():
+			hdr.Typeflag = tar.TypeDir
+			if rel != "." {
+				hdr.Name += "/"
+			}
+			return tw.WriteHeader(hdr)
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = target
+			hdr.Mode = 0o777
+			return tw.WriteHeader(hdr)
+		case info.Mode().IsRegular():
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = info.Size()
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			h := md5.New()
+			if _, err := io.Copy(io.MultiWriter(tw, h), f); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(sums, "%x  %s\n", h.Sum(nil), rel)
+			return err
+		default:
+			return fmt.Errorf("unsupported file type for %s: %s", rel, info.Mode().Type())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return d.Compression.compress(buf.Bytes())
+}
+
+func (d *DebWriter) controlTar(md5sums []byte) ([]byte, error) {
+	type member struct {
+		name string
+		mode int64
+		b    []byte
+	}
+
+	control := d.Control
+	if !strings.HasSuffix(control, "\n") {
+		control += "\n"
+	}
+
+	members := []member{
+		{"control", 0o644, []byte(strings.TrimLeft(control, "\n"))},
+		{"md5sums", 0o644, md5sums},
+	}
+
+	if len(d.Conffiles) > 0 {
+		conffiles := append([]string{}, d.Conffiles...)
+		sort.Strings(conffiles)
+		members = append(members, member{"conffiles", 0o644, []byte(strings.Join(conffiles, "\n") + "\n")})
+	}
+
+	names := make([]string, 0, len(d.Scripts))
+	for name := range d.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		members = append(members, member{name, 0o755, []byte(d.Scripts[name])})
+	}
+
+	var mtime time.Time
+	if !d.ModTime.IsZero() {
+		mtime = d.ModTime.UTC().Truncate(time.Second)
+	}
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     "./",
+		Mode:     0o755,
+		ModTime:  mtime,
+		Uname:    "root",
+		Gname:    "root",
+		Format:   tar.FormatGNU,
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, m := range members {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     "./" + m.name,
+			Mode:     m.mode,
+			Size:     int64(len(m.b)),
+			ModTime:  mtime,
+			Uname:    "root",
+			Gname:    "root",
+			Format:   tar.FormatGNU,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(m.b); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return CompressionGzip.compress(buf.Bytes())
+}
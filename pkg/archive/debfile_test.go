@@ -0,0 +1,143 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAr(t *testing.T, b []byte) map[string][]byte {
+	t.Helper()
+
+	if !bytes.HasPrefix(b, []byte(arMagic)) {
+		t.Fatal("missing ar magic")
+	}
+	b = b[len(arMagic):]
+
+	members := map[string][]byte{}
+	for len(b) > 0 {
+		hdr := string(b[:60])
+		name := strings.TrimSpace(hdr[:16])
+		size, err := strconv.Atoi(strings.TrimSpace(hdr[48:58]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = b[60:]
+		members[name] = b[:size]
+		b = b[size+size%2:]
+	}
+	return members
+}
+
+func readTarGz(t *testing.T, b []byte) map[string]*tar.Header {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdrs := map[string]*tar.Header{}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdrs[hdr.Name] = hdr
+	}
+	return hdrs
+}
+
+func TestDebWriter(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr/bin/runc"), []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("runc", filepath.Join(root, "usr/bin/runc-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := DebWriter{
+		Control:   "Package: moby-runc\nVersion: 1.0.0-ubuntu22.04u1\n",
+		Scripts:   map[string]string{"postinst": "#!/bin/sh\n"},
+		Conffiles: []string{"/etc/docker/daemon.json"},
+		ModTime:   time.Unix(1700000000, 0),
+	}
+
+	var first, second bytes.Buffer
+	if err := w.Write(&first, root); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&second, root); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("output is not reproducible")
+	}
+
+	members := readAr(t, first.Bytes())
+	if v := string(members["debian-binary"]); v != debBinaryVersion {
+		t.Fatalf("unexpected debian-binary: %q", v)
+	}
+
+	control := readTarGz(t, members["control.tar.gz"])
+	for _, name := range []string{"./control", "./md5sums", "./conffiles", "./postinst"} {
+		if _, ok := control[name]; !ok {
+			t.Errorf("missing %s in control.tar", name)
+		}
+	}
+	if mode := control["./postinst"].Mode; mode != 0o755 {
+		t.Errorf("unexpected postinst mode: %o", mode)
+	}
+
+	data := readTarGz(t, members["data.tar.gz"])
+	bin, ok := data["./usr/bin/runc"]
+	if !ok {
+		t.Fatal("missing ./usr/bin/runc in data.tar")
+	}
+	if bin.Mode != 0o755 || bin.Uname != "root" || !bin.ModTime.Equal(w.ModTime) {
+		t.Errorf("unexpected header for runc: %+v", bin)
+	}
+	if link := data["./usr/bin/runc-link"]; link == nil || link.Linkname != "runc" {
+		t.Errorf("unexpected symlink header: %+v", link)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	b := bytes.Repeat([]byte("moby-packaging "), 1000)
+	for _, c := range []Compression{CompressionGzip, CompressionXz, CompressionZstd, CompressionNone} {
+		first, err := c.compress(b)
+		if err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+		second, err := c.compress(b)
+		if err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+		if !bytes.Equal(first, second) {
+			t.Errorf("%s: output is not reproducible", c)
+		}
+
+		out, err := c.decompress(first)
+		if err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+		if !bytes.Equal(out, b) {
+			t.Errorf("%s: round trip changed the data", c)
+		}
+	}
+}
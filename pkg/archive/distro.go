@@ -0,0 +1,317 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+type PackageManager string
+
+const (
+	PackageManagerApt  PackageManager = "apt"
+	PackageManagerYum  PackageManager = "yum"
+	PackageManagerTdnf PackageManager = "tdnf"
+)
+
+// Distro describes one of the distros we build packages for. Everything that
+// varies between distros (filenames, package versions, the build container)
+// is derived from here, so adding a distro means adding an entry to
+// distros and a build target in the targets package.
+type Distro struct {
+	// Name is the codename used in build specs, e.g. "jammy".
+	Name string
+	// Family is the distribution the codename belongs to, e.g. "ubuntu".
+	Family string
+	// Version is the release version of the distro, e.g. "22.04".
+	Version string
+	// Tag identifies the distro in package versions and filenames, e.g.
+	// "ubuntu22.04" or "el9". It is empty for windows.
+	Tag  string
+	Kind PkgKind
+	// Arches lists the architectures packages are built for, in the format
+	// used by build specs, e.g. "arm/v7".
+	Arches []string
+	// Image is the base image of the build container. Images without a
+	// registry host are pulled from the mirror, see ImageRef.
+	Image          string
+	BasePackages   []string
+	PackageManager PackageManager
+}
+
+var (
+	debBasePackages = []string{
+		"build-essential",
+		"cmake",
+		"dh-make",
+		"devscripts",
+		"dh-apparmor",
+		"dpkg-dev",
+		"equivs",
+		"fakeroot",
+		"libbtrfs-dev",
+		"libdevmapper-dev",
+		"libltdl-dev",
+		"libseccomp-dev",
+		"quilt",
+	}
+
+	bionicBasePackages = []string{
+		"bash",
+		"build-essential",
+		"cmake",
+		"dh-make",
+		"devscripts",
+		"dh-apparmor",
+		"dpkg-dev",
+		"equivs",
+		"fakeroot",
+		"libdevmapper-dev",
+		"libltdl-dev",
+		"libseccomp-dev",
+		"quilt",
+	}
+
+	rpmBasePackages = []string{
+		"bash",
+		"ca-certificates",
+		"cmake",
+		"device-mapper-devel",
+		"gcc",
+		"git",
+		"glibc-static",
+		"libseccomp-devel",
+		"libtool",
+		"libtool-ltdl-devel",
+		"make",
+		"make",
+		"patch",
+		"pkgconfig",
+		"pkgconfig(systemd)",
+		"rpmdevtools",
+		"selinux-policy-devel",
+		"systemd-devel",
+		"tar",
+		"which",
+		"yum-utils",
+	}
+
+	marinerBasePackages = []string{
+		"bash",
+		"binutils",
+		"build-essential",
+		"ca-certificates",
+		"cmake",
+		"device-mapper-devel",
+		"diffutils",
+		"dnf-utils",
+		"file",
+		"gcc",
+		"git",
+		"glibc-static",
+		"libffi-devel",
+		"libseccomp-devel",
+		"libtool",
+		"libtool-ltdl-devel",
+		"make",
+		"patch",
+		"pkgconfig",
+		"pkgconfig(systemd)",
+		"rpm-build",
+		"rpmdevtools",
+		"selinux-policy-devel",
+		"systemd-devel",
+		"tar",
+		"which",
+		"yum-utils",
+	}
+
+	winBasePackages = []string{
+		"binutils-mingw-w64",
+		"g++-mingw-w64-x86-64",
+		"gcc",
+		"git",
+		"make",
+		"pkg-config",
+		"quilt",
+		"zip",
+	}
+
+	debArches = []string{"amd64", "arm64", "arm/v7"}
+	rpmArches = []string{"amd64", "arm64"}
+
+	distros = map[string]Distro{
+		"bionic":   debDistro("bionic", "ubuntu", "18.04", bionicBasePackages),
+		"focal":    debDistro("focal", "ubuntu", "20.04", debBasePackages),
+		"jammy":    debDistro("jammy", "ubuntu", "22.04", debBasePackages),
+		"noble":    debDistro("noble", "ubuntu", "24.04", debBasePackages),
+		"buster":   debDistro("buster", "debian", "10", debBasePackages),
+		"bullseye": debDistro("bullseye", "debian", "11", debBasePackages),
+		"bookworm": debDistro("bookworm", "debian", "12", debBasePackages),
+		"rhel8": {
+			Name:           "rhel8",
+			Family:         "rhel",
+			Version:        "8",
+			Tag:            "el8",
+			Kind:           PkgKindRPM,
+			Arches:         rpmArches,
+			Image:          "almalinux:8",
+			BasePackages:   rpmBasePackages,
+			PackageManager: PackageManagerYum,
+		},
+		"rhel9": {
+			Name:           "rhel9",
+			Family:         "rhel",
+			Version:        "9",
+			Tag:            "el9",
+			Kind:           PkgKindRPM,
+			Arches:         rpmArches,
+			Image:          "almalinux:9",
+			BasePackages:   rpmBasePackages,
+			PackageManager: PackageManagerYum,
+		},
+		"mariner2": {
+			Name:           "mariner2",
+			Family:         "mariner",
+			Version:        "2.0",
+			Tag:            "cm2",
+			Kind:           PkgKindRPM,
+			Arches:         rpmArches,
+			Image:          "mcr.microsoft.com/cbl-mariner/base/core:2.0",
+			BasePackages:   marinerBasePackages,
+			PackageManager: PackageManagerTdnf,
+		},
+		"windows": {
+			Name:   "windows",
+			Family: "windows",
+			Kind:   PkgKindWin,
+			Arches: []string{"amd64"},
+			// Windows binaries are cross compiled on debian.
+			Image:          "buildpack-deps:bullseye",
+			BasePackages:   winBasePackages,
+			PackageManager: PackageManagerApt,
+		},
+	}
+
+	rpmArchMap = map[string]string{
+		"amd64": "x86_64",
+		"arm64": "aarch64",
+	}
+)
+
+func init() {
+	if err := validateDistros(); err != nil {
+		panic(err)
+	}
+}
+
+func debDistro(name, family, version string, pkgs []string) Distro {
+	return Distro{
+		Name:           name,
+		Family:         family,
+		Version:        version,
+		Tag:            family + version,
+		Kind:           PkgKindDeb,
+		Arches:         debArches,
+		Image:          "buildpack-deps:" + name,
+		BasePackages:   pkgs,
+		PackageManager: PackageManagerApt,
+	}
+}
+
+func validateDistros() error {
+	var errs []error
+	for name, d := range distros {
+		missing := func(field string) {
+			errs = append(errs, fmt.Errorf("distro %s: missing %s", name, field))
+		}
+
+		if d.Name != name {
+			errs = append(errs, fmt.Errorf("distro %s: name does not match key %q", name, d.Name))
+		}
+		if d.Family == "" {
+			missing("family")
+		}
+		if d.Image == "" {
+			missing("image")
+		}
+		if len(d.BasePackages) == 0 {
+			missing("base packages")
+		}
+		if d.PackageManager == "" {
+			missing("package manager")
+		}
+		if len(d.Arches) == 0 {
+			missing("arches")
+		}
+		if d.Kind == PkgKindRPM {
+			for _, arch := range d.Arches {
+				if _, err := RpmArch(arch); err != nil {
+					errs = append(errs, fmt.Errorf("distro %s: %w", name, err))
+				}
+			}
+		}
+
+		switch d.Kind {
+		case PkgKindDeb, PkgKindRPM:
+			if d.Version == "" {
+				missing("version")
+			}
+			if d.Tag == "" {
+				missing("tag")
+			}
+		case PkgKindWin:
+		default:
+			errs = append(errs, fmt.Errorf("distro %s: unknown package kind %q", name, d.Kind))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LookupDistro returns the descriptor for the named distro.
+func LookupDistro(name string) (Distro, error) {
+	d, ok := distros[name]
+	if !ok {
+		return Distro{}, fmt.Errorf("unknown distro: %q", name)
+	}
+	return d, nil
+}
+
+// Distros returns every known distro, sorted by name.
+func Distros() []Distro {
+	ls := make([]Distro, 0, len(distros))
+	for _, d := range distros {
+		ls = append(ls, d)
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].Name < ls[j].Name })
+	return ls
+}
+
+// Extension is the file extension of the packages built for the distro.
+func (d Distro) Extension() string {
+	if d.Kind == PkgKindWin {
+		return "zip"
+	}
+	return string(d.Kind)
+}
+
+// ImageRef returns the reference of the build container base image, pulling
+// images without a registry host from mirrorPrefix.
+func (d Distro) ImageRef(mirrorPrefix string) string {
+	host, _, ok := strings.Cut(d.Image, "/")
+	if ok && strings.ContainsAny(host, ".:") {
+		return d.Image
+	}
+	return path.Join(mirrorPrefix, d.Image)
+}
+
+// RpmArch maps a go architecture to the name rpm uses for it.
+func RpmArch(arch string) (string, error) {
+	a, ok := rpmArchMap[arch]
+	if !ok {
+		return "", fmt.Errorf("unsupported rpm architecture: %q", arch)
+	}
+	return a, nil
+}
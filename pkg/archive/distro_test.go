@@ -0,0 +1,14 @@
+package archive
+
+import "testing"
+
+func TestBasenameUnknown(t *testing.T) {
+	for name, s := range map[string]Spec{
+		"distro":   {Pkg: "moby-runc", Distro: "hardy", Arch: "amd64", Tag: "1.1.12", Revision: "1"},
+		"rpm arch": {Pkg: "moby-runc", Distro: "rhel9", Arch: "arm/v7", Tag: "1.1.12", Revision: "1"},
+	} {
+		if b, err := s.Basename(); err == nil {
+			t.Errorf("%s: expected an error, got %q", name, b)
+		}
+	}
+}
@@ -7,10 +7,26 @@ import (
 )
 
 type File struct {
-	Source   string
-	Dest     string
-	IsDir    bool
-	Compress bool
+	Source   string `json:"source,omitempty"`
+	Dest     string `json:"dest"`
+	IsDir    bool   `json:"isDir,omitempty"`
+	Compress bool   `json:"compress,omitempty"`
+	// Config marks the file as %config in rpms. NoReplace additionally keeps
+	// locally modified copies on upgrade, i.e. %config(noreplace). Debs
+	// always treat files under /etc as conffiles.
+	Config    bool `json:"config,omitempty"`
+	NoReplace bool `json:"noReplace,omitempty"`
+}
+
+func (f *File) rpmFlags() RpmFileFlag {
+	var flags RpmFileFlag
+	if f.Config || f.NoReplace {
+		flags |= RpmFileConfig
+	}
+	if f.NoReplace {
+		flags |= RpmFileNoReplace
+	}
+	return flags
 }
 
 func (f *File) MoveStaticFile(c *dagger.Container, rootdir string) *dagger.Container {
@@ -0,0 +1,257 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// LintIssue is a single problem found in a built package.
+type LintIssue struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	// Member is the installed file the issue was found in, or empty for
+	// issues with the package as a whole.
+	Member  string `json:"member,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	if i.Member == "" {
+		return fmt.Sprintf("%s: %s: %s", i.Severity, i.Rule, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", i.Severity, i.Rule, i.Member, i.Message)
+}
+
+// BuildPathPrefix is the directory the sources are built in. It should not
+// show up in anything we ship.
+const BuildPathPrefix = "/build/src"
+
+var (
+	systemdUnitDirs = []string{"/lib/systemd/system", "/usr/lib/systemd/system", "/etc/systemd/system"}
+	systemdUnitExts = []string{".service", ".socket", ".timer", ".mount", ".path", ".target"}
+	binDirs         = []string{"/bin", "/sbin", "/usr/bin", "/usr/sbin"}
+)
+
+// LintPackage checks the contents of a package built for spec against the
+// archive definition it was built from, and against a set of general rules
+// in the spirit of lintian and rpmlint. Issues are sorted by member and rule.
+func LintPackage(p *PackageContents, a *Archive, spec *Spec) []LintIssue {
+	l := &linter{p: p, a: a, spec: spec}
+
+	if p.Kind == PkgKindWin {
+		l.lintWin()
+	} else {
+		l.lintArchive()
+		l.lintFiles()
+		l.lintMetadata()
+	}
+
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		if l.issues[i].Member != l.issues[j].Member {
+			return l.issues[i].Member < l.issues[j].Member
+		}
+		return l.issues[i].Rule < l.issues[j].Rule
+	})
+	return l.issues
+}
+
+type linter struct {
+	p      *PackageContents
+	a      *Archive
+	spec   *Spec
+	issues []LintIssue
+}
+
+func (l *linter) add(sev LintSeverity, rule, member, format string, args ...interface{}) {
+	l.issues = append(l.issues, LintIssue{Rule: rule, Severity: sev, Member: member, Message: fmt.Sprintf(format, args...)})
+}
+
+func installedName(dest string) string {
+	return path.Clean("/" + dest)
+}
+
+// lintArchive checks that everything the archive definition asks for ended
+// up in the package.
+func (l *linter) lintArchive() {
+	for _, f := range l.a.Files {
+		dest := installedName(f.Dest)
+		m, ok := l.p.File(dest)
+		switch {
+		case !ok:
+			l.add(LintError, "file-missing", dest, "not in package (source %q)", f.Source)
+		case f.IsDir && !m.Mode.IsDir():
+			l.add(LintError, "file-type", dest, "expected a directory, got mode %s", m.Mode)
+		}
+	}
+
+	for _, sd := range l.a.Systemd {
+		dest := installedName(sd.Dest)
+		if _, ok := l.p.File(dest); !ok {
+			l.add(LintError, "file-missing", dest, "systemd unit not in package (source %q)", sd.Source)
+		}
+	}
+
+	for bin, dest := range l.a.installedBinaries() {
+		if bin == dest {
+			// Only used for dependency resolution.
+			continue
+		}
+		m, ok := l.p.File(dest)
+		if !ok {
+			continue
+		}
+		if m.Mode&0o111 == 0 {
+			l.add(LintError, "binary-not-executable", dest, "mode %s", m.Mode)
+		}
+		if data, ok := l.p.Data(dest); ok && bytes.Contains(data, []byte(BuildPathPrefix)) {
+			l.add(LintError, "build-path-leak", dest, "contains the build path %s", BuildPathPrefix)
+		}
+	}
+
+	docDir := "/usr/share/doc/" + l.spec.Pkg
+	for _, name := range []string{"LICENSE", "NOTICE"} {
+		if !l.hasFilePrefix(docDir + "/" + name) {
+			l.add(LintError, "missing-"+strings.ToLower(name), "", "no %s file in %s", name, docDir)
+		}
+	}
+}
+
+func (l *linter) hasFilePrefix(prefix string) bool {
+	for _, f := range l.p.Files {
+		if strings.HasPrefix(f.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintFiles applies the general rules to every installed file.
+func (l *linter) lintFiles() {
+	for _, f := range l.p.Files {
+		isLink := f.Mode&fs.ModeSymlink != 0
+
+		if !isLink && f.Mode.Perm()&0o002 != 0 {
+			l.add(LintError, "world-writable", f.Name, "mode %s", f.Mode)
+		}
+		if f.Mode&(fs.ModeSetuid|fs.ModeSetgid) != 0 {
+			l.add(LintWarning, "setuid-setgid", f.Name, "mode %s", f.Mode)
+		}
+		if f.Owner != "" && f.Owner != "root" && f.Owner != "0" || f.Group != "" && f.Group != "root" && f.Group != "0" {
+			l.add(LintError, "non-root-owner", f.Name, "owned by %s:%s", f.Owner, f.Group)
+		}
+
+		switch {
+		case underDir(f.Name, "/usr/local"):
+			l.add(LintError, "dir-in-usr-local", f.Name, "packages must not install into /usr/local")
+		case underDir(f.Name, "/tmp"), underDir(f.Name, "/var/tmp"):
+			l.add(LintError, "file-in-tmp", f.Name, "packages must not install into temporary directories")
+		}
+
+		if isLink || f.Mode.IsDir() {
+			continue
+		}
+
+		if ext := path.Ext(f.Name); contains(systemdUnitExts, ext) && underDir(f.Name, "/lib/systemd", "/usr/lib/systemd", "/etc/systemd") {
+			if !contains(systemdUnitDirs, path.Dir(f.Name)) {
+				l.add(LintError, "systemd-unit-location", f.Name, "units belong in one of %s", strings.Join(systemdUnitDirs, ", "))
+			}
+		}
+
+		if contains(binDirs, path.Dir(f.Name)) {
+			if f.Mode&0o111 == 0 {
+				l.add(LintError, "binary-not-executable", f.Name, "mode %s", f.Mode)
+			}
+			if !l.hasManPage(path.Base(f.Name)) {
+				l.add(LintWarning, "no-manual-page", f.Name, "no man page in /usr/share/man")
+			}
+		}
+
+		if underDir(f.Name, "/usr/share/doc") && f.Size == 0 {
+			l.add(LintWarning, "zero-byte-file-in-doc-directory", f.Name, "empty file")
+		}
+	}
+}
+
+func (l *linter) hasManPage(name string) bool {
+	for _, f := range l.p.Files {
+		if !underDir(f.Name, "/usr/share/man") {
+			continue
+		}
+		base := path.Base(f.Name)
+		base = strings.TrimSuffix(base, ".gz")
+		if strings.TrimSuffix(base, path.Ext(base)) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lintMetadata checks the control fields or rpm header, and the maintainer
+// scripts.
+func (l *linter) lintMetadata() {
+	var required []string
+	switch l.p.Kind {
+	case PkgKindDeb:
+		required = []string{"Package", "Version", "Architecture", "Maintainer", "Description"}
+		for name, script := range l.p.Scripts {
+			if !strings.HasPrefix(script, "#!") {
+				l.add(LintError, "maintainer-script-lacks-shebang", "", "%s has no #! line", name)
+			}
+		}
+	case PkgKindRPM:
+		required = []string{"Name", "Version", "Release", "Arch", "Summary", "Description", "License", "URL"}
+	}
+
+	for _, field := range required {
+		if strings.TrimSpace(l.p.Fields[field]) == "" {
+			l.add(LintError, "missing-field", "", "%s is missing or empty", field)
+		}
+	}
+
+	name := l.p.Fields["Package"]
+	if l.p.Kind == PkgKindRPM {
+		name = l.p.Fields["Name"]
+	}
+	if name != "" && name != l.spec.Pkg {
+		l.add(LintError, "package-name", "", "expected %s, got %s", l.spec.Pkg, name)
+	}
+}
+
+// lintWin checks that a windows zip contains the windows binaries.
+func (l *linter) lintWin() {
+	for _, bin := range l.a.WinBinaries {
+		name := "/" + path.Base(bin)
+		if _, ok := l.p.File(name); !ok {
+			l.add(LintError, "file-missing", name, "not in package (source %q)", bin)
+		}
+	}
+}
+
+func underDir(name string, dirs ...string) bool {
+	for _, d := range dirs {
+		if name == d || strings.HasPrefix(name, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLintPackage(t *testing.T) {
+	root := t.TempDir()
+	for name, mode := range map[string]os.FileMode{
+		"usr/bin/runc":                      0o644,
+		"usr/share/doc/moby-runc/LICENSE":   0o644,
+		"usr/share/man/man8/runc.8.gz":      0o644,
+		"lib/systemd/user/runc.service":     0o644,
+		"lib/systemd/system/runc.socket":    0o644,
+		"usr/share/doc/moby-runc/NOTICE.gz": 0o644,
+	} {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("built in /build/src/runc"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &Archive{
+		Files: []File{
+			{Source: "/build/src/runc", Dest: "usr/bin/runc"},
+			{Source: "/build/src/runc.service", Dest: "lib/systemd/user/runc.service"},
+			{Source: "", Dest: "/usr/share/man/man1/runc.1"},
+		},
+		Systemd:  []Systemd{{Source: "/build/src/runc.socket", Dest: "/lib/systemd/system/runc.socket"}},
+		Binaries: []string{"/build/src/runc"},
+	}
+	spec := &Spec{Pkg: "moby-runc", Distro: "jammy", Arch: "amd64", Tag: "1.1.12", Revision: "1"}
+
+	filename := filepath.Join(t.TempDir(), "moby-runc.deb")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := DebWriter{
+		Control: "Package: moby-runc\nVersion: 1.1.12\nArchitecture: amd64\nDescription: runc\n",
+		Scripts: map[string]string{"postinst": "echo hi\n"},
+		ModTime: time.Unix(1700000000, 0),
+	}
+	if err := w.Write(f, root); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	p, err := ReadPackage(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, i := range LintPackage(p, a, spec) {
+		found[i.Rule+" "+i.Member] = true
+	}
+
+	for _, want := range []string{
+		"binary-not-executable /usr/bin/runc",
+		"build-path-leak /usr/bin/runc",
+		"file-missing /usr/share/man/man1/runc.1",
+		"systemd-unit-location /lib/systemd/user/runc.service",
+		"maintainer-script-lacks-shebang ",
+		"missing-field ",
+	} {
+		if !found[want] {
+			t.Errorf("expected issue %q, got %v", want, found)
+		}
+	}
+
+	for _, unwanted := range []string{
+		"missing-license ",
+		"missing-notice ",
+		"no-manual-page /usr/bin/runc",
+		"systemd-unit-location /lib/systemd/system/runc.socket",
+		"non-root-owner /usr/bin/runc",
+	} {
+		if found[unwanted] {
+			t.Errorf("unexpected issue %q", unwanted)
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Member is a single entry of a built package, either a file installed on
+// the target system or one of the archive members the package is made of.
+type Member struct {
+	Name    string      `json:"name"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	Size    int64       `json:"size"`
+	Sha256  string      `json:"sha256,omitempty"`
+	Link    string      `json:"link,omitempty"`
+	Owner   string      `json:"owner,omitempty"`
+	Group   string      `json:"group,omitempty"`
+}
+
+// PackageContents is the parsed form of a deb, rpm or windows zip.
+type PackageContents struct {
+	Kind PkgKind
+	// Fields holds the control fields of a deb, or the header tags of an
+	// rpm. Multi-valued rpm tags are joined with ", ".
+	Fields map[string]string
+	// Scripts holds the maintainer scripts, keyed by the name dpkg uses for
+	// them (preinst, postinst, prerm, postrm).
+	Scripts map[string]string
+	// Parts are the members the package file itself consists of: the ar
+	// members of a deb, the control.tar members, or the header and payload
+	// of an rpm.
+	Parts []Member
+	// Files are the files installed by the package, with absolute paths.
+	Files []Member
+
+	data map[string][]byte
+}
+
+// File returns the installed file with the given absolute path.
+func (p *PackageContents) File(name string) (Member, bool) {
+	for _, f := range p.Files {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Member{}, false
+}
+
+// Data returns the contents of the installed regular file with the given
+// absolute path.
+func (p *PackageContents) Data(name string) ([]byte, bool) {
+	b, ok := p.data[name]
+	return b, ok
+}
+
+// ReadPackage parses the package at filename. The format is determined by
+// the file extension.
+func ReadPackage(filename string) (*PackageContents, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var p *PackageContents
+	switch filepath.Ext(filename) {
+	case ".deb":
+		p, err = readDeb(b)
+	case ".rpm":
+		p, err = readRpm(b)
+	case ".zip":
+		p, err = readZip(b)
+	default:
+		return nil, fmt.Errorf("unsupported package format: %s", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filename, err)
+	}
+	return p, nil
+}
+
+func sha256Hex(b []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// decompress reverses Compression.compress.
+func (c Compression) decompress(b []byte) ([]byte, error) {
+	switch c {
+	case "", CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case CompressionNone:
+		return b, nil
+	case CompressionXz:
+		zr, err := xz.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case CompressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(b), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported compression: %q", c)
+	}
+}
+
+func compressionFromExt(name string) (Compression, error) {
+	switch path.Ext(name) {
+	case ".gz":
+		return CompressionGzip, nil
+	case ".xz":
+		return CompressionXz, nil
+	case ".zst":
+		return CompressionZstd, nil
+	case ".tar":
+		return CompressionNone, nil
+	default:
+		return "", fmt.Errorf("unsupported compression for %s", name)
+	}
+}
+
+func readDeb(b []byte) (*PackageContents, error) {
+	members, err := ReadAr(b)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PackageContents{Kind: PkgKindDeb, Fields: map[string]string{}, Scripts: map[string]string{}, data: map[string][]byte{}}
+
+	for _, m := range members {
+		name, data := m.Name, m.Data
+		p.Parts = append(p.Parts, Member{
+			Name:    name,
+			Mode:    m.Mode,
+			ModTime: m.ModTime,
+			Size:    int64(len(data)),
+			Sha256:  sha256Hex(data),
+		})
+
+		switch {
+		case strings.HasPrefix(name, "control.tar"):
+			if err := readDebControl(p, name, data); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(name, "data.tar"):
+			c, err := compressionFromExt(name)
+			if err != nil {
+				return nil, err
+			}
+			raw, err := c.decompress(data)
+			if err != nil {
+				return nil, err
+			}
+			p.Files, err = readTar(raw, p.data)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", name, err)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+func readDebControl(p *PackageContents, name string, data []byte) error {
+	c, err := compressionFromExt(name)
+	if err != nil {
+		return err
+	}
+	raw, err := c.decompress(data)
+	if err != nil {
+		return err
+	}
+
+	contents := map[string][]byte{}
+	members, err := readTar(raw, contents)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+	for _, m := range members {
+		m.Name = name + ":" + m.Name
+		p.Parts = append(p.Parts, m)
+	}
+
+	for _, script := range []string{"preinst", "postinst", "prerm", "postrm"} {
+		if s, ok := contents["/"+script]; ok {
+			p.Scripts[script] = string(s)
+		}
+	}
+
+	control, ok := contents["/control"]
+	if !ok {
+		return errors.New("control.tar has no control file")
+	}
+	p.Fields = parseControl(control)
+	return nil
+}
+
+// parseControl parses a deb822 paragraph. Continuation lines are kept, so
+// multi-line fields such as Description round trip.
+func parseControl(b []byte) map[string]string {
+	fields := map[string]string{}
+	var last string
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			fields[last] += "\n" + line
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		last = strings.TrimSpace(k)
+		fields[last] = strings.TrimSpace(v)
+	}
+	return fields
+}
+
+// readTar lists the entries of a tar archive. Names are normalized to
+// absolute paths. If contents is not nil the data of every regular file is
+// stored in it.
+func readTar(b []byte, contents map[string][]byte) ([]Member, error) {
+	var members []Member
+
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+
+		m := Member{
+			Name:    name,
+			Mode:    hdr.FileInfo().Mode(),
+			ModTime: hdr.ModTime.UTC(),
+			Size:    hdr.Size,
+			Link:    hdr.Linkname,
+			Owner:   hdr.Uname,
+			Group:   hdr.Gname,
+		}
+		if m.Owner == "" {
+			m.Owner = strconv.Itoa(hdr.Uid)
+		}
+		if m.Group == "" {
+			m.Group = strconv.Itoa(hdr.Gid)
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			m.Sha256 = sha256Hex(data)
+			if contents != nil {
+				contents[name] = data
+			}
+		}
+
+		members = append(members, m)
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+type rpmHeaderEntry struct {
+	typ   int32
+	count int32
+	data  []byte
+}
+
+// parseRpmHeader parses the header structure at the start of b, returning
+// the entries by tag and the length of the header.
+func parseRpmHeader(b []byte) (map[int32]rpmHeaderEntry, int, error) {
+	if len(b) < 16 || !bytes.HasPrefix(b, rpmHeaderMagic) {
+		return nil, 0, errors.New("missing rpm header magic")
+	}
+
+	nindex := int(binary.BigEndian.Uint32(b[8:]))
+	hsize := int(binary.BigEndian.Uint32(b[12:]))
+	length := 16 + nindex*16 + hsize
+	if len(b) < length {
+		return nil, 0, errors.New("truncated rpm header")
+	}
+	store := b[16+nindex*16 : length]
+
+	type index struct{ Tag, Typ, Offset, Count int32 }
+	indexes := make([]index, nindex)
+	if err := binary.Read(bytes.NewReader(b[16:]), binary.BigEndian, indexes); err != nil {
+		return nil, 0, err
+	}
+
+	// Entries are delimited by the offset of the next entry in the store.
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Offset < indexes[j].Offset })
+
+	entries := map[int32]rpmHeaderEntry{}
+	for i, e := range indexes {
+		if e.Offset < 0 || int(e.Offset) > len(store) {
+			continue
+		}
+		end := len(store)
+		if i+1 < len(indexes) {
+			end = int(indexes[i+1].Offset)
+		}
+		entries[e.Tag] = rpmHeaderEntry{typ: e.Typ, count: e.Count, data: store[e.Offset:end]}
+	}
+
+	return entries, length, nil
+}
+
+func (e rpmHeaderEntry) strings() []string {
+	switch e.typ {
+	case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+		ss := strings.SplitN(string(e.data), "\x00", int(e.count)+1)
+		if len(ss) > int(e.count) {
+			ss = ss[:e.count]
+		}
+		return ss
+	case rpmTypeInt16:
+		var vs []string
+		for i := 0; i < int(e.count) && 2*i+2 <= len(e.data); i++ {
+			vs = append(vs, strconv.Itoa(int(int16(binary.BigEndian.Uint16(e.data[2*i:])))))
+		}
+		return vs
+	case rpmTypeInt32:
+		var vs []string
+		for i := 0; i < int(e.count) && 4*i+4 <= len(e.data); i++ {
+			vs = append(vs, strconv.Itoa(int(int32(binary.BigEndian.Uint32(e.data[4*i:])))))
+		}
+		return vs
+	default:
+		n := int(e.count)
+		if n > len(e.data) {
+			n = len(e.data)
+		}
+		return []string{fmt.Sprintf("%x", e.data[:n])}
+	}
+}
+
+var rpmTagNames = map[int32]string{
+	rpmTagName:              "Name",
+	rpmTagVersion:           "Version",
+	rpmTagRelease:           "Release",
+	rpmTagSummary:           "Summary",
+	rpmTagDescription:       "Description",
+	rpmTagBuildTime:         "BuildTime",
+	rpmTagBuildHost:         "BuildHost",
+	rpmTagSize:              "Size",
+	rpmTagLicense:           "License",
+	rpmTagGroup:             "Group",
+	rpmTagURL:               "URL",
+	rpmTagArch:              "Arch",
+	rpmTagSourceRPM:         "SourceRPM",
+	rpmTagProvideName:       "Provides",
+	rpmTagProvideVersion:    "ProvideVersion",
+	rpmTagProvideFlags:      "ProvideFlags",
+	rpmTagRequireName:       "Requires",
+	rpmTagRequireVersion:    "RequireVersion",
+	rpmTagRequireFlags:      "RequireFlags",
+	rpmTagConflictName:      "Conflicts",
+	rpmTagConflictVersion:   "ConflictVersion",
+	rpmTagConflictFlags:     "ConflictFlags",
+	rpmTagObsoleteName:      "Obsoletes",
+	rpmTagObsoleteVersion:   "ObsoleteVersion",
+	rpmTagObsoleteFlags:     "ObsoleteFlags",
+	rpmTagRecommendName:     "Recommends",
+	rpmTagSuggestName:       "Suggests",
+	rpmTagTriggerName:       "Triggers",
+	rpmTagTriggerScripts:    "TriggerScripts",
+	rpmTagPayloadCompressor: "PayloadCompressor",
+	rpmTagDistTag:           "DistTag",
+	rpmTagPayloadDigest:     "PayloadDigest",
+}
+
+var rpmScriptTags = map[int32]string{
+	rpmTagPreIn:  "preinst",
+	rpmTagPostIn: "postinst",
+	rpmTagPreUn:  "prerm",
+	rpmTagPostUn: "postrm",
+}
+
+func readRpm(b []byte) (*PackageContents, error) {
+	if len(b) < 96 || !bytes.HasPrefix(b, rpmLeadMagic) {
+		return nil, errors.New("missing rpm lead magic")
+	}
+	rest := b[96:]
+
+	sigTags, sigLen, err := parseRpmHeader(rest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signature header: %w", err)
+	}
+	rest = rest[sigLen+(8-sigLen%8)%8:]
+
+	tags, hdrLen, err := parseRpmHeader(rest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	payload := rest[hdrLen:]
+
+	p := &PackageContents{Kind: PkgKindRPM, Fields: map[string]string{}, Scripts: map[string]string{}, data: map[string][]byte{}}
+	p.Parts = []Member{
+		{Name: "lead", Size: 96, Sha256: sha256Hex(b[:96])},
+		{Name: "header", Size: int64(hdrLen), Sha256: sha256Hex(rest[:hdrLen])},
+		{Name: "payload", Size: int64(len(payload)), Sha256: sha256Hex(payload)},
+	}
+
+	for tag, e := range tags {
+		if name, ok := rpmTagNames[tag]; ok {
+			p.Fields[name] = strings.Join(e.strings(), ", ")
+		}
+		if name, ok := rpmScriptTags[tag]; ok {
+			p.Scripts[name] = strings.Join(e.strings(), "")
+		}
+	}
+
+	if e, ok := sigTags[rpmSigTagPayloadSize]; ok {
+		p.Fields["PayloadSize"] = strings.Join(e.strings(), "")
+	}
+
+	compressor := CompressionGzip
+	if e, ok := tags[rpmTagPayloadCompressor]; ok {
+		compressor = Compression(e.strings()[0])
+	}
+	raw, err := compressor.decompress(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing payload: %w", err)
+	}
+
+	p.Files, err = readCpio(raw, p.data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading payload: %w", err)
+	}
+
+	return p, nil
+}
+
+// readCpio lists the entries of a cpio archive in the newc format. As with
+// readTar, the data of regular files is stored in contents if it is not nil.
+func readCpio(b []byte, contents map[string][]byte) ([]Member, error) {
+	var members []Member
+
+	pos := 0
+	align := func() { pos += (4 - pos%4) % 4 }
+	for {
+		if len(b)-pos < 110 {
+			return nil, errors.New("truncated cpio header")
+		}
+		hdr := b[pos : pos+110]
+		if string(hdr[:6]) != "070701" {
+			return nil, fmt.Errorf("bad cpio magic at offset %d", pos)
+		}
+
+		field := func(i int) int64 {
+			v, _ := strconv.ParseInt(string(hdr[6+8*i:14+8*i]), 16, 64)
+			return v
+		}
+		mode, uid, gid, mtime, size, namesize := field(1), field(2), field(3), field(5), field(6), field(11)
+
+		pos += 110
+		if int64(len(b)-pos) < namesize {
+			return nil, errors.New("truncated cpio name")
+		}
+		name := strings.TrimSuffix(string(b[pos:pos+int(namesize)]), "\x00")
+		pos += int(namesize)
+		align()
+
+		if name == "TRAILER!!!" {
+			break
+		}
+
+		if int64(len(b)-pos) < size {
+			return nil, fmt.Errorf("truncated cpio data for %s", name)
+		}
+		data := b[pos : pos+int(size)]
+		pos += int(size)
+		align()
+
+		m := Member{
+			Name:    path.Clean("/" + name),
+			Mode:    cpioMode(mode),
+			ModTime: time.Unix(mtime, 0).UTC(),
+			Size:    size,
+			Owner:   strconv.FormatInt(uid, 10),
+			Group:   strconv.FormatInt(gid, 10),
+		}
+		switch mode & 0o170000 {
+		case 0o100000:
+			m.Sha256 = sha256Hex(data)
+			if contents != nil {
+				contents[m.Name] = data
+			}
+		case 0o120000:
+			m.Link = string(data)
+		}
+		members = append(members, m)
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+func cpioMode(mode int64) fs.FileMode {
+	m := fs.FileMode(mode).Perm()
+	switch mode & 0o170000 {
+	case 0o040000:
+		m |= fs.ModeDir
+	case 0o120000:
+		m |= fs.ModeSymlink
+	}
+	return m
+}
+
+func readZip(b []byte) (*PackageContents, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PackageContents{Kind: PkgKindWin, Fields: map[string]string{}, Scripts: map[string]string{}, data: map[string][]byte{}}
+	for _, f := range zr.File {
+		m := Member{
+			Name:    path.Clean("/" + f.Name),
+			Mode:    f.Mode(),
+			ModTime: f.Modified.UTC(),
+			Size:    int64(f.UncompressedSize64),
+		}
+		if !f.FileInfo().IsDir() {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			m.Sha256 = sha256Hex(data)
+			p.data[m.Name] = data
+		}
+		p.Files = append(p.Files, m)
+	}
+
+	sort.Slice(p.Files, func(i, j int) bool { return p.Files[i].Name < p.Files[j].Name })
+	return p, nil
+}
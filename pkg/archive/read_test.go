@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComparePackages(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(root, "usr/bin/runc")
+	if err := os.WriteFile(bin, []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	deb := DebWriter{
+		Control: "Package: moby-runc\nVersion: 1.1.12\nArchitecture: amd64\nDescription: runc\n CLI tool.\n",
+		Scripts: map[string]string{"postinst": "#!/bin/sh\necho hi\n"},
+		ModTime: time.Unix(1700000000, 0),
+	}
+	rpm := RpmWriter{Name: "moby-runc", Version: "1.1.12", Release: "1", Dist: "cm2", Arch: "x86_64", Description: "runc", ModTime: time.Unix(1700000000, 0)}
+
+	build := func(name string) map[string]*PackageContents {
+		t.Helper()
+		out := map[string]*PackageContents{}
+		for ext, fn := range map[string]func(*os.File) error{
+			".deb": func(f *os.File) error { return deb.Write(f, root) },
+			".rpm": func(f *os.File) error { return rpm.Write(f, root) },
+		} {
+			filename := filepath.Join(t.TempDir(), name+ext)
+			f, err := os.Create(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fn(f); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			p, err := ReadPackage(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[ext] = p
+		}
+		return out
+	}
+
+	first := build("first")
+	if p := first[".deb"]; p.Fields["Package"] != "moby-runc" || p.Scripts["postinst"] == "" {
+		t.Errorf("unexpected deb contents: %+v", p)
+	}
+	if f, ok := first[".rpm"].File("/usr/bin/runc"); !ok || f.Mode.Perm() != 0o755 || f.Size != 6 {
+		t.Errorf("unexpected rpm file: %+v", f)
+	}
+
+	for ext, p := range build("second") {
+		if diffs := ComparePackages(first[ext], p); len(diffs) != 0 {
+			t.Errorf("%s: expected identical packages, got %v", ext, diffs)
+		}
+	}
+
+	if err := os.WriteFile(bin, []byte("changed"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	deb.ModTime = deb.ModTime.Add(time.Second)
+
+	changed := build("changed")
+	found := map[string]bool{}
+	for _, d := range ComparePackages(first[".deb"], changed[".deb"]) {
+		found[d.Member+" "+d.Field] = true
+	}
+	for _, want := range []string{"/usr/bin/runc sha256", "/usr/bin/runc mtime", "data.tar.gz sha256"} {
+		if !found[want] {
+			t.Errorf("expected difference %q, got %v", want, found)
+		}
+	}
+	if diffs := ComparePackages(first[".rpm"], changed[".rpm"]); len(diffs) == 0 {
+		t.Error("expected rpm differences")
+	}
+}
@@ -2,7 +2,9 @@ package archive
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"text/template"
@@ -13,17 +15,6 @@ import (
 var (
 	nothing empty
 
-	rpmDistroMap = map[string]string{
-		"rhel8":    "el8",
-		"rhel9":    "el9",
-		"mariner2": "cm2",
-	}
-
-	rpmArchMap = map[string]string{
-		"amd64": "x86_64",
-		"arm64": "aarch64",
-	}
-
 	rpmPkgBlacklist = mapSet{
 		"rhel9": {
 			"libcgroup": nothing,
@@ -61,120 +52,216 @@ func NewRPMPackager(a *Archive, mp string) *RpmPackager {
 	}
 }
 
-func (r *RpmPackager) Package(client *dagger.Client, c *dagger.Container, project *Spec) *dagger.Directory {
+func (r *RpmPackager) Package(client *dagger.Client, c *dagger.Container, project *Spec) (*dagger.Directory, error) {
+	ctx := context.TODO()
 	dir := client.Directory()
 	rootDir := "/package"
 
 	c = c.WithDirectory(rootDir, dir)
 	c = r.moveStaticFiles(c, rootDir)
 
-	pkgDir := c.Directory(rootDir)
-	fpm := fpmContainer(client, r.mirrorPrefix)
-
-	filename := fmt.Sprintf("%s-%s-%s.%s.%s.rpm", project.Pkg, project.Tag, project.Revision, rpmDistroMap[project.Distro], rpmArchMap[project.Arch])
+	distro, err := LookupDistro(project.Distro)
+	if err != nil {
+		return nil, err
+	}
 
-	fpmArgs := []string{"fpm",
-		"-s", "dir",
-		"-t", "rpm",
-		"-n", project.Pkg,
-		"--version", project.Tag,
-		"--iteration", project.Revision,
-		"--rpm-dist", rpmDistroMap[project.Distro],
-		"--architecture", strings.Replace(project.Arch, "/", "", -1),
-		"--description", r.a.Description,
-		"--url", r.a.Webpage,
+	arch, err := RpmArch(project.Arch)
+	if err != nil {
+		return nil, err
 	}
 
+	var requires []string
 	for i := range r.a.RuntimeDeps {
 		dep := r.a.RuntimeDeps[i]
 		if rpmPkgBlacklist.contains(project.Distro, dep) {
 			continue
 		}
 
-		fpmArgs = append(fpmArgs, "-d", dep)
+		requires = append(requires, dep)
+	}
+
+	w := RpmWriter{
+		Name:        project.Pkg,
+		Version:     project.Tag,
+		Release:     project.Revision,
+		Arch:        arch,
+		Dist:        distro.Tag,
+		Description: r.a.Description,
+		URL:         r.a.Webpage,
+		Requires:    requires,
+		Provides:    r.a.Provides,
+		Conflicts:   r.a.Conflicts,
+		Obsoletes:   r.a.Replaces,
+		Recommends:  r.a.Recommends,
+		Suggests:    r.a.Suggests,
+		Triggers:    r.a.Triggers,
+		FileFlags:   r.fileFlags(),
+		Compression: r.a.Compression,
+	}
+
+	if err := r.withInstallScripts(&w); err != nil {
+		return nil, err
+	}
+
+	modTime, err := sourceDateEpoch(ctx, c)
+	if err != nil {
+		return nil, err
 	}
+	w.ModTime = modTime
 
-	for i := range r.a.Conflicts {
-		conf := r.a.Conflicts[i]
-		fpmArgs = append(fpmArgs, "--conflicts", conf)
+	stage, err := os.MkdirTemp("", "moby-rpm-")
+	if err != nil {
+		return nil, err
 	}
+	defer os.RemoveAll(stage)
 
-	var args []string
-	c, args = r.withInstallScripts(c)
+	pkgRoot := filepath.Join(stage, "package")
+	if _, err := c.Directory(rootDir).Export(ctx, pkgRoot); err != nil {
+		return nil, fmt.Errorf("error exporting package root: %w", err)
+	}
 
-	fpmArgs = append(fpmArgs, args...)
-	fpmArgs = append(fpmArgs, ".")
+	outDir := filepath.Join(stage, "out")
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	filename := w.Filename()
+	if err := r.a.writeSBOM(ctx, c, project, w.Version+"-"+w.fullRelease(), r.a.installedBinaries(), pkgRoot, outDir, filename, modTime); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filepath.Join(outDir, filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := w.Write(f, pkgRoot); err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", filename, err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
 
-	return fpm.WithDirectory("/package", pkgDir).
-		WithDirectory("/build", c.Directory("/build")).
-		WithWorkdir("/package").
-		WithEnvVariable("OUTPUT_FILENAME", filename).
-		WithExec(fpmArgs).
-		WithExec([]string{"bash", "-c", `mkdir -vp /out; mv *.rpm "/out/${OUTPUT_FILENAME}"`}).
-		Directory("/out")
+	// The staging directory is removed when we return, so make sure the
+	// engine has loaded it before then.
+	return client.Host().Directory(outDir).Sync(ctx)
 }
 
-func (r *RpmPackager) withInstallScripts(c *dagger.Container) (*dagger.Container, []string) {
-	newArgs := []string{}
+// withInstallScripts fills in the scriptlets of the rpm. As with fpm, when an
+// upgrade script is supplied %post dispatches on the install count so that
+// only one of the install and upgrade scripts runs.
+func (r *RpmPackager) withInstallScripts(w *RpmWriter) error {
+	var postInstall, upgrade, preRm, postRm []string
 
 	for i := range r.a.InstallScripts {
 		script := r.a.InstallScripts[i]
-		var a []string
-		c, a = r.installScript(&script, c)
-		newArgs = append(newArgs, a...)
+		switch script.When {
+		case PkgActionPostInstall:
+			postInstall = append(postInstall, script.Script)
+		case PkgActionUpgrade:
+			upgrade = append(upgrade, script.Script)
+		case PkgActionPreRemoval:
+			preRm = append(preRm, script.Script)
+		case PkgActionPostRemoval:
+			postRm = append(postRm, script.Script)
+		default:
+			return fmt.Errorf("unrecognized package action: %d", script.When)
+		}
+	}
+
+	data := struct {
+		PostInstall string
+		Upgrade     string
+		PreRm       string
+		PostRm      string
+	}{
+		PostInstall: strings.Join(postInstall, "\n"),
+		Upgrade:     strings.Join(upgrade, "\n"),
+		PreRm:       strings.Join(preRm, "\n"),
+		PostRm:      strings.Join(postRm, "\n"),
 	}
 
-	return c, newArgs
+	render := func(templateStr string) (string, error) {
+		tpl, err := template.New("installScript").Funcs(template.FuncMap{"replace": strings.ReplaceAll}).Parse(templateStr)
+		if err != nil {
+			return "", err
+		}
+
+		buf := new(bytes.Buffer)
+		if err := tpl.Execute(buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	var err error
+	switch {
+	case data.Upgrade != "":
+		w.PostIn, err = render(`
+_install() {
+  {{ replace .PostInstall "\n" "\n  " }}
+  :
+}
+
+upgrade() {
+  {{ replace .Upgrade "\n" "\n  " }}
+  :
 }
 
-func (r *RpmPackager) installScript(script *InstallScript, c *dagger.Container) (*dagger.Container, []string) {
-	newArgs := []string{}
-
-	var templateStr, filename, flag string
-	switch script.When {
-	case PkgActionPostInstall:
-		filename = filenamePostInstall
-		flag = flagPostInstall
-		templateStr = `
-{{ replace .Script "\n" "\n  " }}
-            `
-	case PkgActionUpgrade:
-		filename = filenamePostUpgrade
-		flag = flagUpgrade
-		templateStr = `
-if [ $1 -ge 1 ]; then
-  {{ replace .Script "\n" "\n  " }}
+if [ "${1}" -eq 1 ]; then
+  _install
+elif [ "${1}" -gt 1 ]; then
+  upgrade
 fi
-            `
-	case PkgActionPreRemoval, PkgActionPostRemoval:
-		filename = filenamePreRm
-		flag = flagPreRm
-		templateStr = `
+`)
+	case data.PostInstall != "":
+		w.PostIn, err = render(`
+{{ replace .PostInstall "\n" "\n  " }}
+`)
+	}
+	if err != nil {
+		return err
+	}
+
+	if data.PreRm != "" {
+		w.PreUn, err = render(`
 if [ $1 -eq 0 ]; then
-  {{ replace .Script "\n" "\n  " }}
+  {{ replace .PreRm "\n" "\n  " }}
 fi
-            `
-	default:
-		panic("unrecognized package action: " + fmt.Sprintf("%d", script.When))
+`)
+		if err != nil {
+			return err
+		}
 	}
 
-	filename = filepath.Join("/build", filename)
-
-	tpl, err := template.New("installScript").Funcs(template.FuncMap{"replace": strings.ReplaceAll}).Parse(templateStr)
-	if err != nil {
-		panic(err)
+	if data.PostRm != "" {
+		w.PostUn, err = render(`
+if [ $1 -eq 0 ]; then
+  {{ replace .PostRm "\n" "\n  " }}
+fi
+`)
+		if err != nil {
+			return err
+		}
 	}
 
-	buf := new(bytes.Buffer)
-	err = tpl.Execute(buf, script)
-	if err != nil {
-		panic(err)
-	}
+	return nil
+}
 
-	c = c.WithNewFile(filename, buf.String())
-	newArgs = append(newArgs, flag, filename)
-	return c, newArgs
+// fileFlags collects the rpm file attributes requested in the archive
+// definition, keyed by their path in the package.
+func (r *RpmPackager) fileFlags() map[string]RpmFileFlag {
+	flags := map[string]RpmFileFlag{}
+	for i := range r.a.Files {
+		f := r.a.Files[i]
+		if fl := f.rpmFlags(); fl != 0 {
+			flags[filepath.Clean(f.Dest)] = fl
+		}
+	}
+	return flags
 }
+
 func (r *RpmPackager) moveStaticFiles(c *dagger.Container, rootdir string) *dagger.Container {
 	files := r.a.Files
 	for i := range r.a.Systemd {
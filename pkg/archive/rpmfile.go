@@ -0,0 +1,788 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RpmFileFlag corresponds to the RPMFILE_* attributes of a file in an rpm.
+type RpmFileFlag int32
+
+const (
+	RpmFileConfig    RpmFileFlag = 1 << 0
+	RpmFileDoc       RpmFileFlag = 1 << 1
+	RpmFileNoReplace RpmFileFlag = 1 << 4
+	RpmFileGhost     RpmFileFlag = 1 << 6
+)
+
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+
+	rpmTagHeaderSignatures = 62
+	rpmTagHeaderImmutable  = 63
+	rpmTagHeaderI18NTable  = 100
+
+	rpmSigTagSHA1        = 269
+	rpmSigTagSHA256      = 273
+	rpmSigTagSize        = 1000
+	rpmSigTagMD5         = 1004
+	rpmSigTagPayloadSize = 1007
+
+	rpmTagName              = 1000
+	rpmTagVersion           = 1001
+	rpmTagRelease           = 1002
+	rpmTagSummary           = 1004
+	rpmTagDescription       = 1005
+	rpmTagBuildTime         = 1006
+	rpmTagBuildHost         = 1007
+	rpmTagSize              = 1009
+	rpmTagLicense           = 1014
+	rpmTagGroup             = 1016
+	rpmTagURL               = 1020
+	rpmTagOS                = 1021
+	rpmTagArch              = 1022
+	rpmTagPreIn             = 1023
+	rpmTagPostIn            = 1024
+	rpmTagPreUn             = 1025
+	rpmTagPostUn            = 1026
+	rpmTagFileSizes         = 1028
+	rpmTagFileModes         = 1030
+	rpmTagFileRdevs         = 1033
+	rpmTagFileMtimes        = 1034
+	rpmTagFileDigests       = 1035
+	rpmTagFileLinkTos       = 1036
+	rpmTagFileFlags         = 1037
+	rpmTagFileUserName      = 1039
+	rpmTagFileGroupName     = 1040
+	rpmTagSourceRPM         = 1044
+	rpmTagProvideName       = 1047
+	rpmTagRequireFlags      = 1048
+	rpmTagRequireName       = 1049
+	rpmTagRequireVersion    = 1050
+	rpmTagConflictFlags     = 1053
+	rpmTagConflictName      = 1054
+	rpmTagConflictVersion   = 1055
+	rpmTagRPMVersion        = 1064
+	rpmTagTriggerScripts    = 1065
+	rpmTagTriggerName       = 1066
+	rpmTagTriggerVersion    = 1067
+	rpmTagTriggerFlags      = 1068
+	rpmTagTriggerIndex      = 1069
+	rpmTagPreInProg         = 1085
+	rpmTagPostInProg        = 1086
+	rpmTagPreUnProg         = 1087
+	rpmTagPostUnProg        = 1088
+	rpmTagObsoleteName      = 1090
+	rpmTagTriggerScriptProg = 1092
+	rpmTagFileDevices       = 1095
+	rpmTagFileInodes        = 1096
+	rpmTagFileLangs         = 1097
+	rpmTagProvideFlags      = 1112
+	rpmTagProvideVersion    = 1113
+	rpmTagObsoleteFlags     = 1114
+	rpmTagObsoleteVersion   = 1115
+	rpmTagDirIndexes        = 1116
+	rpmTagBaseNames         = 1117
+	rpmTagDirNames          = 1118
+	rpmTagPayloadFormat     = 1124
+	rpmTagPayloadCompressor = 1125
+	rpmTagPayloadFlags      = 1126
+	rpmTagDistTag           = 1155
+	rpmTagFileDigestAlgo    = 5011
+	rpmTagRecommendName     = 5046
+	rpmTagRecommendVersion  = 5047
+	rpmTagRecommendFlags    = 5048
+	rpmTagSuggestName       = 5049
+	rpmTagSuggestVersion    = 5050
+	rpmTagSuggestFlags      = 5051
+	rpmTagPayloadDigest     = 5092
+	rpmTagPayloadDigestAlgo = 5093
+
+	rpmSenseLess          = 1 << 1
+	rpmSenseGreater       = 1 << 2
+	rpmSenseEqual         = 1 << 3
+	rpmSenseInterp        = 1 << 8
+	rpmSenseScriptPre     = 1 << 9
+	rpmSenseScriptPost    = 1 << 10
+	rpmSenseScriptPreUn   = 1 << 11
+	rpmSenseScriptPostUn  = 1 << 12
+	rpmSenseTriggerIn     = 1 << 16
+	rpmSenseTriggerUn     = 1 << 17
+	rpmSenseTriggerPostUn = 1 << 18
+	rpmSenseRPMLib        = 1 << 24
+
+	rpmDigestAlgoSHA256 = 8
+)
+
+var (
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+
+	rpmLeadArchMap = map[string]int16{
+		"x86_64":  1,
+		"armv7hl": 12,
+		"aarch64": 19,
+	}
+)
+
+// RpmWriter assembles a binary rpm from a staged root directory without
+// relying on rpmbuild or fpm. Only regular files, symlinks and empty
+// directories are included in the package so that we never claim ownership
+// of shared directories such as /usr/bin.
+type RpmWriter struct {
+	Name        string
+	Version     string
+	Release     string
+	Arch        string
+	Dist        string
+	Summary     string
+	Description string
+	URL         string
+	License     string
+
+	// Dependencies use the usual rpm syntax, e.g. "libseccomp >= 2.3".
+	Requires   []string
+	Provides   []string
+	Conflicts  []string
+	Obsoletes  []string
+	Recommends []string
+	Suggests   []string
+
+	PreIn  string
+	PostIn string
+	PreUn  string
+	PostUn string
+
+	Triggers []Trigger
+
+	// FileFlags sets attributes such as %config(noreplace) on files, keyed
+	// by absolute path inside the package.
+	FileFlags map[string]RpmFileFlag
+
+	Compression Compression
+	// ModTime is used as the build time and the timestamp of every file. If
+	// it is zero, the modification times from the root directory are used.
+	ModTime time.Time
+}
+
+type rpmFile struct {
+	path   string
+	mode   int32
+	size   int64
+	mtime  int32
+	link   string
+	digest string
+	flags  RpmFileFlag
+	data   []byte
+}
+
+type rpmDep struct {
+	name    string
+	flags   int32
+	version string
+}
+
+// parseRpmDep splits a dependency such as "container-selinux >= 2:2.95" into
+// its name, comparison flags and version.
+func parseRpmDep(s string) (rpmDep, error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		return rpmDep{name: fields[0]}, nil
+	case 3:
+		var flags int32
+		switch fields[1] {
+		case "<":
+			flags = rpmSenseLess
+		case "<=":
+			flags = rpmSenseLess | rpmSenseEqual
+		case "=", "==":
+			flags = rpmSenseEqual
+		case ">=":
+			flags = rpmSenseGreater | rpmSenseEqual
+		case ">":
+			flags = rpmSenseGreater
+		default:
+			return rpmDep{}, fmt.Errorf("invalid operator in dependency %q", s)
+		}
+		return rpmDep{name: fields[0], flags: flags, version: fields[2]}, nil
+	default:
+		return rpmDep{}, fmt.Errorf("invalid dependency %q", s)
+	}
+}
+
+func parseRpmDeps(deps []string) ([]rpmDep, error) {
+	out := make([]rpmDep, 0, len(deps))
+	for _, d := range deps {
+		dep, err := parseRpmDep(d)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dep)
+	}
+	return out, nil
+}
+
+// Filename returns the conventional file name of the package.
+func (r *RpmWriter) Filename() string {
+	return fmt.Sprintf("%s-%s-%s.%s.rpm", r.Name, r.Version, r.fullRelease(), r.Arch)
+}
+
+func (r *RpmWriter) fullRelease() string {
+	if r.Dist == "" {
+		return r.Release
+	}
+	return r.Release + "." + r.Dist
+}
+
+func (r *RpmWriter) mtime(fi fs.FileInfo) int32 {
+	if r.ModTime.IsZero() {
+		return int32(fi.ModTime().Unix())
+	}
+	return int32(r.ModTime.Unix())
+}
+
+// Write writes the package for the contents of root to w.
+func (r *RpmWriter) Write(w io.Writer, root string) error {
+	files, err := r.collectFiles(root)
+	if err != nil {
+		return err
+	}
+
+	cpio, err := rpmPayload(files)
+	if err != nil {
+		return err
+	}
+
+	payload, err := r.Compression.compress(cpio)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := r.header(files, payload)
+	if err != nil {
+		return err
+	}
+
+	sig := r.signature(hdr, payload, len(cpio))
+
+	if _, err := w.Write(r.lead()); err != nil {
+		return err
+	}
+	if _, err := w.Write(sig); err != nil {
+		return err
+	}
+	if pad := (8 - len(sig)%8) % 8; pad > 0 {
+		if _, err := w.Write(make([]byte, pad)); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+func (r *RpmWriter) collectFiles(root string) ([]rpmFile, error) {
+	var files []rpmFile
+
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := "/" + filepath.ToSlash(rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		f := rpmFile{
+			path:  name,
+			mtime: r.mtime(info),
+			flags: r.FileFlags[name],
+		}
+
+		switch {
+		case info.IsDir():
+			entries, err := os.ReadDir(p)
+			if err != nil {
+				return err
+			}
+			if len(entries) != 0 {
+				return nil
+			}
+			f.mode = 0o040000 | int32(info.Mode().Perm())
+			f.size = 4096
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			f.mode = 0o120000 | 0o777
+			f.link = target
+			f.size = int64(len(target))
+			f.data = []byte(target)
+		case info.Mode().IsRegular():
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			f.mode = 0o100000 | int32(info.Mode().Perm())
+			f.size = int64(len(b))
+			f.digest = fmt.Sprintf("%x", sha256.Sum256(b))
+			f.data = b
+		default:
+			return fmt.Errorf("unsupported file type for %s: %s", name, info.Mode().Type())
+		}
+
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// rpmPayload produces the cpio (newc) archive that rpm expects as payload.
+func rpmPayload(files []rpmFile) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	write := func(name string, ino, mode, nlink, mtime int32, data []byte) {
+		fmt.Fprintf(buf, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+			ino, mode, 0, 0, nlink, mtime, len(data), 0, 0, 0, 0, len(name)+1, 0)
+		buf.WriteString(name)
+		buf.WriteByte(0)
+		buf.Write(make([]byte, (4-buf.Len()%4)%4))
+		buf.Write(data)
+		buf.Write(make([]byte, (4-buf.Len()%4)%4))
+	}
+
+	for i, f := range files {
+		nlink := int32(1)
+		if f.mode&0o040000 != 0 {
+			nlink = 2
+		}
+		write("."+f.path, int32(i+1), f.mode, nlink, f.mtime, f.data)
+	}
+	write("TRAILER!!!", 0, 0, 1, 0, nil)
+
+	return buf.Bytes(), nil
+}
+
+func (r *RpmWriter) lead() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(rpmLeadMagic)
+	buf.Write([]byte{3, 0})
+	binary.Write(buf, binary.BigEndian, int16(0)) // binary package
+	binary.Write(buf, binary.BigEndian, rpmLeadArchMap[r.Arch])
+
+	name := make([]byte, 66)
+	copy(name[:65], fmt.Sprintf("%s-%s-%s", r.Name, r.Version, r.fullRelease()))
+	buf.Write(name)
+
+	binary.Write(buf, binary.BigEndian, int16(1)) // linux
+	binary.Write(buf, binary.BigEndian, int16(5)) // header-style signature
+	buf.Write(make([]byte, 16))
+	return buf.Bytes()
+}
+
+func (r *RpmWriter) signature(hdr, payload []byte, payloadSize int) []byte {
+	h := &rpmHeader{}
+
+	md5sum := md5.New()
+	md5sum.Write(hdr)
+	md5sum.Write(payload)
+
+	h.addString(rpmSigTagSHA1, fmt.Sprintf("%x", sha1.Sum(hdr)))
+	h.addString(rpmSigTagSHA256, fmt.Sprintf("%x", sha256.Sum256(hdr)))
+	h.addInt32(rpmSigTagSize, int32(len(hdr)+len(payload)))
+	h.addBin(rpmSigTagMD5, md5sum.Sum(nil))
+	h.addInt32(rpmSigTagPayloadSize, int32(payloadSize))
+
+	return h.marshal(rpmTagHeaderSignatures)
+}
+
+func (r *RpmWriter) header(files []rpmFile, payload []byte) ([]byte, error) {
+	h := &rpmHeader{}
+
+	summary, _, _ := strings.Cut(strings.TrimSpace(r.Description), "\n")
+	if r.Summary != "" {
+		summary = r.Summary
+	}
+	license := r.License
+	if license == "" {
+		license = "unknown"
+	}
+	evr := r.Version + "-" + r.fullRelease()
+
+	var buildTime int32
+	if !r.ModTime.IsZero() {
+		buildTime = int32(r.ModTime.Unix())
+	}
+
+	h.addStrings(rpmTagHeaderI18NTable, "C")
+	h.addString(rpmTagName, r.Name)
+	h.addString(rpmTagVersion, r.Version)
+	h.addString(rpmTagRelease, r.fullRelease())
+	h.addI18N(rpmTagSummary, summary)
+	h.addI18N(rpmTagDescription, r.Description)
+	h.addInt32(rpmTagBuildTime, buildTime)
+	h.addString(rpmTagBuildHost, "localhost")
+	h.addString(rpmTagLicense, license)
+	h.addI18N(rpmTagGroup, "default")
+	if r.URL != "" {
+		h.addString(rpmTagURL, r.URL)
+	}
+	h.addString(rpmTagOS, "linux")
+	h.addString(rpmTagArch, r.Arch)
+	h.addString(rpmTagSourceRPM, fmt.Sprintf("%s-%s.src.rpm", r.Name, evr))
+	h.addString(rpmTagRPMVersion, "4.14.3")
+	if r.Dist != "" {
+		h.addString(rpmTagDistTag, r.Dist)
+	}
+	h.addString(rpmTagPayloadFormat, "cpio")
+	h.addString(rpmTagPayloadFlags, "9")
+	h.addStrings(rpmTagPayloadDigest, fmt.Sprintf("%x", sha256.Sum256(payload)))
+	h.addInt32(rpmTagPayloadDigestAlgo, rpmDigestAlgoSHA256)
+
+	requires, err := parseRpmDeps(r.Requires)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := []struct {
+		tag, progTag int
+		sense        int32
+		body         string
+	}{
+		{rpmTagPreIn, rpmTagPreInProg, rpmSenseScriptPre, r.PreIn},
+		{rpmTagPostIn, rpmTagPostInProg, rpmSenseScriptPost, r.PostIn},
+		{rpmTagPreUn, rpmTagPreUnProg, rpmSenseScriptPreUn, r.PreUn},
+		{rpmTagPostUn, rpmTagPostUnProg, rpmSenseScriptPostUn, r.PostUn},
+	}
+	for _, s := range scripts {
+		if s.body == "" {
+			continue
+		}
+		h.addString(s.tag, s.body)
+		h.addStrings(s.progTag, "/bin/sh")
+		requires = append(requires, rpmDep{name: "/bin/sh", flags: rpmSenseInterp | s.sense})
+	}
+
+	switch r.Compression {
+	case "", CompressionGzip:
+		h.addString(rpmTagPayloadCompressor, "gzip")
+	case CompressionXz:
+		h.addString(rpmTagPayloadCompressor, "xz")
+		requires = append(requires, rpmDep{name: "rpmlib(PayloadIsXz)", flags: rpmSenseRPMLib | rpmSenseLess | rpmSenseEqual, version: "5.2-1"})
+	case CompressionZstd:
+		h.addString(rpmTagPayloadCompressor, "zstd")
+		requires = append(requires, rpmDep{name: "rpmlib(PayloadIsZstd)", flags: rpmSenseRPMLib | rpmSenseLess | rpmSenseEqual, version: "5.4.18-1"})
+	default:
+		return nil, fmt.Errorf("compression %q is not supported for rpm", r.Compression)
+	}
+
+	requires = append(requires,
+		rpmDep{name: "rpmlib(CompressedFileNames)", flags: rpmSenseRPMLib | rpmSenseLess | rpmSenseEqual, version: "3.0.4-1"},
+		rpmDep{name: "rpmlib(FileDigests)", flags: rpmSenseRPMLib | rpmSenseLess | rpmSenseEqual, version: "4.6.0-1"},
+		rpmDep{name: "rpmlib(PayloadFilesHavePrefix)", flags: rpmSenseRPMLib | rpmSenseLess | rpmSenseEqual, version: "4.0-1"},
+	)
+
+	provides, err := parseRpmDeps(r.Provides)
+	if err != nil {
+		return nil, err
+	}
+	provides = append(provides, rpmDep{name: r.Name, flags: rpmSenseEqual, version: evr})
+
+	deps := []struct {
+		nameTag, versionTag, flagsTag int
+		deps                          []string
+		parsed                        []rpmDep
+	}{
+		{rpmTagRequireName, rpmTagRequireVersion, rpmTagRequireFlags, nil, requires},
+		{rpmTagProvideName, rpmTagProvideVersion, rpmTagProvideFlags, nil, provides},
+		{rpmTagConflictName, rpmTagConflictVersion, rpmTagConflictFlags, r.Conflicts, nil},
+		{rpmTagObsoleteName, rpmTagObsoleteVersion, rpmTagObsoleteFlags, r.Obsoletes, nil},
+		{rpmTagRecommendName, rpmTagRecommendVersion, rpmTagRecommendFlags, r.Recommends, nil},
+		{rpmTagSuggestName, rpmTagSuggestVersion, rpmTagSuggestFlags, r.Suggests, nil},
+	}
+	for _, d := range deps {
+		parsed := d.parsed
+		if parsed == nil {
+			parsed, err = parseRpmDeps(d.deps)
+			if err != nil {
+				return nil, err
+			}
+		}
+		h.addDeps(d.nameTag, d.versionTag, d.flagsTag, parsed)
+	}
+
+	if err := h.addTriggers(r.Triggers); err != nil {
+		return nil, err
+	}
+
+	h.addFiles(files)
+
+	return h.marshal(rpmTagHeaderImmutable), nil
+}
+
+type rpmEntry struct {
+	tag   int32
+	typ   int32
+	count int32
+	data  []byte
+}
+
+type rpmHeader struct {
+	entries []rpmEntry
+}
+
+func (h *rpmHeader) add(tag int, typ int32, count int, data []byte) {
+	h.entries = append(h.entries, rpmEntry{tag: int32(tag), typ: typ, count: int32(count), data: data})
+}
+
+func (h *rpmHeader) addString(tag int, s string) {
+	h.add(tag, rpmTypeString, 1, append([]byte(s), 0))
+}
+
+func (h *rpmHeader) addI18N(tag int, s string) {
+	h.add(tag, rpmTypeI18NString, 1, append([]byte(s), 0))
+}
+
+func (h *rpmHeader) addStrings(tag int, ss ...string) {
+	buf := new(bytes.Buffer)
+	for _, s := range ss {
+		buf.WriteString(s)
+		buf.WriteByte(0)
+	}
+	h.add(tag, rpmTypeStringArray, len(ss), buf.Bytes())
+}
+
+func (h *rpmHeader) addInt32(tag int, vs ...int32) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, vs)
+	h.add(tag, rpmTypeInt32, len(vs), buf.Bytes())
+}
+
+func (h *rpmHeader) addInt16(tag int, vs ...int16) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, vs)
+	h.add(tag, rpmTypeInt16, len(vs), buf.Bytes())
+}
+
+func (h *rpmHeader) addBin(tag int, b []byte) {
+	h.add(tag, rpmTypeBin, len(b), b)
+}
+
+func (h *rpmHeader) addDeps(nameTag, versionTag, flagsTag int, deps []rpmDep) {
+	if len(deps) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(deps))
+	versions := make([]string, 0, len(deps))
+	flags := make([]int32, 0, len(deps))
+	for _, d := range deps {
+		names = append(names, d.name)
+		versions = append(versions, d.version)
+		flags = append(flags, d.flags)
+	}
+
+	h.addStrings(nameTag, names...)
+	h.addStrings(versionTag, versions...)
+	h.addInt32(flagsTag, flags...)
+}
+
+func (h *rpmHeader) addTriggers(triggers []Trigger) error {
+	if len(triggers) == 0 {
+		return nil
+	}
+
+	var (
+		scripts  []string
+		progs    []string
+		names    []string
+		versions []string
+		flags    []int32
+		indexes  []int32
+	)
+
+	for i, t := range triggers {
+		dep, err := parseRpmDep(t.Package)
+		if err != nil {
+			return err
+		}
+
+		var sense int32
+		switch t.When {
+		case TriggerInstall:
+			sense = rpmSenseTriggerIn
+		case TriggerUninstall:
+			sense = rpmSenseTriggerUn
+		case TriggerPostUninstall:
+			sense = rpmSenseTriggerPostUn
+		default:
+			return fmt.Errorf("unrecognized trigger kind: %d", t.When)
+		}
+
+		scripts = append(scripts, t.Script)
+		progs = append(progs, "/bin/sh")
+		names = append(names, dep.name)
+		versions = append(versions, dep.version)
+		flags = append(flags, dep.flags|sense)
+		indexes = append(indexes, int32(i))
+	}
+
+	h.addStrings(rpmTagTriggerScripts, scripts...)
+	h.addStrings(rpmTagTriggerName, names...)
+	h.addStrings(rpmTagTriggerVersion, versions...)
+	h.addInt32(rpmTagTriggerFlags, flags...)
+	h.addInt32(rpmTagTriggerIndex, indexes...)
+	h.addStrings(rpmTagTriggerScriptProg, progs...)
+	return nil
+}
+
+func (h *rpmHeader) addFiles(files []rpmFile) {
+	var installedSize int64
+	for _, f := range files {
+		installedSize += f.size
+	}
+	h.addInt32(rpmTagSize, int32(installedSize))
+
+	if len(files) == 0 {
+		return
+	}
+
+	var (
+		sizes     []int32
+		modes     []int16
+		rdevs     []int16
+		mtimes    []int32
+		digests   []string
+		links     []string
+		flags     []int32
+		users     []string
+		groups    []string
+		devices   []int32
+		inodes    []int32
+		langs     []string
+		dirIdx    []int32
+		baseNames []string
+		dirNames  []string
+	)
+
+	dirs := map[string]int32{}
+	for i, f := range files {
+		dir, base := path.Split(f.path)
+		idx, ok := dirs[dir]
+		if !ok {
+			idx = int32(len(dirNames))
+			dirs[dir] = idx
+			dirNames = append(dirNames, dir)
+		}
+
+		sizes = append(sizes, int32(f.size))
+		modes = append(modes, int16(uint16(f.mode)))
+		rdevs = append(rdevs, 0)
+		mtimes = append(mtimes, f.mtime)
+		digests = append(digests, f.digest)
+		links = append(links, f.link)
+		flags = append(flags, int32(f.flags))
+		users = append(users, "root")
+		groups = append(groups, "root")
+		devices = append(devices, 1)
+		inodes = append(inodes, int32(i+1))
+		langs = append(langs, "")
+		dirIdx = append(dirIdx, idx)
+		baseNames = append(baseNames, base)
+	}
+
+	h.addInt32(rpmTagFileSizes, sizes...)
+	h.addInt16(rpmTagFileModes, modes...)
+	h.addInt16(rpmTagFileRdevs, rdevs...)
+	h.addInt32(rpmTagFileMtimes, mtimes...)
+	h.addStrings(rpmTagFileDigests, digests...)
+	h.addStrings(rpmTagFileLinkTos, links...)
+	h.addInt32(rpmTagFileFlags, flags...)
+	h.addStrings(rpmTagFileUserName, users...)
+	h.addStrings(rpmTagFileGroupName, groups...)
+	h.addInt32(rpmTagFileDevices, devices...)
+	h.addInt32(rpmTagFileInodes, inodes...)
+	h.addStrings(rpmTagFileLangs, langs...)
+	h.addInt32(rpmTagDirIndexes, dirIdx...)
+	h.addStrings(rpmTagBaseNames, baseNames...)
+	h.addStrings(rpmTagDirNames, dirNames...)
+	h.addInt32(rpmTagFileDigestAlgo, rpmDigestAlgoSHA256)
+}
+
+// marshal serializes the header as an immutable region identified by
+// regionTag. Entries are written in tag order with the region trailer at the
+// end of the data store, which is the layout rpm itself produces.
+func (h *rpmHeader) marshal(regionTag int32) []byte {
+	entries := append([]rpmEntry{}, h.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	index := new(bytes.Buffer)
+	data := new(bytes.Buffer)
+
+	writeIndex := func(w io.Writer, tag, typ, offset, count int32) {
+		binary.Write(w, binary.BigEndian, []int32{tag, typ, offset, count})
+	}
+
+	for _, e := range entries {
+		align := 1
+		switch e.typ {
+		case rpmTypeInt16:
+			align = 2
+		case rpmTypeInt32:
+			align = 4
+		}
+		data.Write(make([]byte, (align-data.Len()%align)%align))
+
+		writeIndex(index, e.tag, e.typ, int32(data.Len()), e.count)
+		data.Write(e.data)
+	}
+
+	nindex := int32(len(entries) + 1)
+	trailerOffset := int32(data.Len())
+	writeIndex(data, regionTag, rpmTypeBin, -nindex*16, 16)
+
+	buf := new(bytes.Buffer)
+	buf.Write(rpmHeaderMagic)
+	binary.Write(buf, binary.BigEndian, nindex)
+	binary.Write(buf, binary.BigEndian, int32(data.Len()))
+	writeIndex(buf, regionTag, rpmTypeBin, trailerOffset, 16)
+	buf.Write(index.Bytes())
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
@@ -0,0 +1,144 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRpmHeader parses a header structure at the start of b and returns its
+// raw bytes and the string value of every tag.
+func readRpmHeader(t *testing.T, b []byte) ([]byte, map[int32][]string) {
+	t.Helper()
+
+	if !bytes.HasPrefix(b, rpmHeaderMagic) {
+		t.Fatal("missing header magic")
+	}
+
+	nindex := int32(binary.BigEndian.Uint32(b[8:]))
+	hsize := int32(binary.BigEndian.Uint32(b[12:]))
+	store := b[16+nindex*16 : 16+nindex*16+hsize]
+
+	tags := map[int32][]string{}
+	for i := int32(0); i < nindex; i++ {
+		var e [4]int32
+		if err := binary.Read(bytes.NewReader(b[16+i*16:]), binary.BigEndian, &e); err != nil {
+			t.Fatal(err)
+		}
+		tag, typ, offset, count := e[0], e[1], e[2], e[3]
+
+		switch typ {
+		case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+			ss := strings.SplitN(string(store[offset:]), "\x00", int(count)+1)
+			tags[tag] = ss[:count]
+		case rpmTypeInt32:
+			for j := int32(0); j < count; j++ {
+				tags[tag] = append(tags[tag], fmt.Sprint(int32(binary.BigEndian.Uint32(store[offset+j*4:]))))
+			}
+		}
+	}
+
+	return b[:16+nindex*16+hsize], tags
+}
+
+func TestRpmWriter(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "etc/docker"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr/bin/runc"), []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w := RpmWriter{
+		Name:        "moby-runc",
+		Version:     "1.1.12",
+		Release:     "1",
+		Dist:        "cm2",
+		Arch:        "x86_64",
+		Description: "runc\nCLI tool for spawning and running containers.",
+		Requires:    []string{"libseccomp >= 2.3", "/bin/sh"},
+		Conflicts:   []string{"runc"},
+		Recommends:  []string{"moby-containerd"},
+		PostIn:      "echo installed",
+		Triggers:    []Trigger{{When: TriggerInstall, Package: "firewalld", Script: "echo reload"}},
+		FileFlags:   map[string]RpmFileFlag{"/usr/bin/runc": RpmFileConfig | RpmFileNoReplace},
+		ModTime:     time.Unix(1700000000, 0),
+	}
+
+	if got, want := w.Filename(), "moby-runc-1.1.12-1.cm2.x86_64.rpm"; got != want {
+		t.Fatalf("unexpected filename: %s", got)
+	}
+
+	var first, second bytes.Buffer
+	if err := w.Write(&first, root); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&second, root); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("output is not reproducible")
+	}
+
+	b := first.Bytes()
+	if !bytes.HasPrefix(b, rpmLeadMagic) {
+		t.Fatal("missing lead magic")
+	}
+	b = b[96:]
+
+	sig, sigTags := readRpmHeader(t, b)
+	b = b[len(sig)+(8-len(sig)%8)%8:]
+
+	hdr, tags := readRpmHeader(t, b)
+	if got, want := sigTags[rpmSigTagSHA256][0], fmt.Sprintf("%x", sha256.Sum256(hdr)); got != want {
+		t.Errorf("header digest mismatch: %s != %s", got, want)
+	}
+
+	for tag, want := range map[int32]string{
+		rpmTagName:          "moby-runc",
+		rpmTagRelease:       "1.cm2",
+		rpmTagSummary:       "runc",
+		rpmTagConflictName:  "runc",
+		rpmTagRecommendName: "moby-containerd",
+		rpmTagTriggerName:   "firewalld",
+		rpmTagPostIn:        "echo installed",
+	} {
+		if got := tags[tag]; len(got) == 0 || got[0] != want {
+			t.Errorf("tag %d: expected %q, got %q", tag, want, got)
+		}
+	}
+
+	// Empty directories are owned by the package, populated ones are not.
+	if got := strings.Join(tags[rpmTagBaseNames], ","); got != "docker,runc" {
+		t.Errorf("unexpected files: %s", got)
+	}
+	if got, want := tags[rpmTagFileFlags][1], fmt.Sprint(int32(RpmFileConfig|RpmFileNoReplace)); got != want {
+		t.Errorf("unexpected flags for runc: %s", got)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b[len(hdr):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"./etc/docker\x00", "./usr/bin/runc\x00", "TRAILER!!!\x00"} {
+		if !bytes.Contains(payload, []byte(name)) {
+			t.Errorf("payload is missing %q", name)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	// rpmSigTagRSA holds an OpenPGP signature of the header, whatever the
+	// key algorithm, as written by rpmsign for anything but DSA keys.
+	rpmSigTagRSA = 268
+
+	rpmTypeNull  = 0
+	rpmTypeChar  = 1
+	rpmTypeInt8  = 2
+	rpmTypeInt64 = 5
+)
+
+// RpmParts is an rpm split into the parts it is made of.
+type RpmParts struct {
+	Lead []byte
+	// Signature is the signature header, without the padding after it.
+	Signature []byte
+	// Header is the main header, which is what header signatures sign.
+	Header  []byte
+	Payload []byte
+}
+
+// SplitRpm splits the rpm in b into its parts, which are slices of b.
+func SplitRpm(b []byte) (*RpmParts, error) {
+	if len(b) < 96 || !bytes.HasPrefix(b, rpmLeadMagic) {
+		return nil, errors.New("missing rpm lead magic")
+	}
+	p := &RpmParts{Lead: b[:96]}
+	rest := b[96:]
+
+	_, sigLen, err := parseRpmHeader(rest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signature header: %w", err)
+	}
+	p.Signature = rest[:sigLen]
+	pad := (8 - sigLen%8) % 8
+	if len(rest) < sigLen+pad {
+		return nil, errors.New("truncated rpm signature header")
+	}
+	rest = rest[sigLen+pad:]
+
+	_, hdrLen, err := parseRpmHeader(rest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	p.Header = rest[:hdrLen]
+	p.Payload = rest[hdrLen:]
+	return p, nil
+}
+
+// Bytes joins the parts back into an rpm.
+func (p *RpmParts) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(p.Lead)
+	buf.Write(p.Signature)
+	buf.Write(make([]byte, (8-len(p.Signature)%8)%8))
+	buf.Write(p.Header)
+	buf.Write(p.Payload)
+	return buf.Bytes()
+}
+
+// HeaderSignature returns the OpenPGP signature of the header stored in the
+// signature header, or nil if the rpm is not signed.
+func (p *RpmParts) HeaderSignature() ([]byte, error) {
+	entries, err := rpmHeaderEntries(p.Signature)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.tag == rpmSigTagRSA {
+			return e.data, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetHeaderSignature stores sig, an OpenPGP signature of the header, in the
+// signature header, replacing any signature already there.
+func (p *RpmParts) SetHeaderSignature(sig []byte) error {
+	entries, err := rpmHeaderEntries(p.Signature)
+	if err != nil {
+		return err
+	}
+
+	h := &rpmHeader{}
+	for _, e := range entries {
+		if e.tag != rpmSigTagRSA {
+			h.entries = append(h.entries, e)
+		}
+	}
+	h.addBin(rpmSigTagRSA, sig)
+	p.Signature = h.marshal(rpmTagHeaderSignatures)
+	return nil
+}
+
+// CheckPayloadDigest checks the payload against the sha256 digest of it
+// stored in the header, so that a signature of the header covers it.
+func (p *RpmParts) CheckPayloadDigest() error {
+	entries, err := rpmHeaderEntries(p.Header)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.tag != rpmTagPayloadDigest {
+			continue
+		}
+		want, _, _ := bytes.Cut(e.data, []byte{0})
+		sum := sha256.Sum256(p.Payload)
+		if string(want) != hex.EncodeToString(sum[:]) {
+			return errors.New("rpm payload does not match its digest")
+		}
+		return nil
+	}
+	return errors.New("rpm header has no payload digest")
+}
+
+// rpmHeaderEntries returns the entries of the header at the start of b in
+// index order, without the region trailer, and with their data cut to the
+// size given by their type and count, without alignment padding.
+func rpmHeaderEntries(b []byte) ([]rpmEntry, error) {
+	if len(b) < 16 || !bytes.HasPrefix(b, rpmHeaderMagic) {
+		return nil, errors.New("missing rpm header magic")
+	}
+	nindex := int(binary.BigEndian.Uint32(b[8:]))
+	hsize := int(binary.BigEndian.Uint32(b[12:]))
+	if len(b) < 16+nindex*16+hsize {
+		return nil, errors.New("truncated rpm header")
+	}
+	store := b[16+nindex*16 : 16+nindex*16+hsize]
+
+	var entries []rpmEntry
+	for i := 0; i < nindex; i++ {
+		idx := b[16+i*16:]
+		tag := int32(binary.BigEndian.Uint32(idx))
+		typ := int32(binary.BigEndian.Uint32(idx[4:]))
+		offset := int(int32(binary.BigEndian.Uint32(idx[8:])))
+		count := int32(binary.BigEndian.Uint32(idx[12:]))
+		if tag == rpmTagHeaderSignatures || tag == rpmTagHeaderImmutable {
+			continue
+		}
+		if offset < 0 || offset > len(store) {
+			return nil, fmt.Errorf("bad offset for rpm header tag %d", tag)
+		}
+
+		n, err := rpmEntrySize(typ, count, store[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("rpm header tag %d: %w", tag, err)
+		}
+		entries = append(entries, rpmEntry{tag: tag, typ: typ, count: count, data: store[offset : offset+n]})
+	}
+	return entries, nil
+}
+
+// rpmEntrySize returns the size of the data of an entry of type typ with
+// count values, found at the start of b.
+func rpmEntrySize(typ, count int32, b []byte) (int, error) {
+	var n int
+	switch typ {
+	case rpmTypeNull:
+	case rpmTypeChar, rpmTypeInt8, rpmTypeBin:
+		n = int(count)
+	case rpmTypeInt16:
+		n = 2 * int(count)
+	case rpmTypeInt32:
+		n = 4 * int(count)
+	case rpmTypeInt64:
+		n = 8 * int(count)
+	case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+		for i := int32(0); i < count; i++ {
+			end := bytes.IndexByte(b[n:], 0)
+			if end < 0 {
+				return 0, errors.New("unterminated string")
+			}
+			n += end + 1
+		}
+	default:
+		return 0, fmt.Errorf("unknown type %d", typ)
+	}
+	if n < 0 || n > len(b) {
+		return 0, errors.New("data out of bounds")
+	}
+	return n, nil
+}
@@ -0,0 +1,451 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+const (
+	SBOMExtensionSPDX      = ".spdx.json"
+	SBOMExtensionCycloneDX = ".cdx.json"
+
+	sbomTool = "moby-packaging"
+)
+
+// SBOM is a software bill of materials for a single package: the files it
+// installs, and the Go modules compiled into its binaries.
+type SBOM struct {
+	Name    string
+	Version string
+	// PURL is the package URL of the package itself.
+	PURL    string
+	Webpage string
+	Created time.Time
+
+	Modules []SBOMModule
+	Files   []SBOMFile
+}
+
+type SBOMModule struct {
+	Path    string
+	Version string
+	// Binaries lists the files in the package the module is compiled into.
+	Binaries []string
+}
+
+func (m SBOMModule) PURL() string {
+	return fmt.Sprintf("pkg:golang/%s@%s", m.Path, m.Version)
+}
+
+type SBOMFile struct {
+	Name   string
+	Sha256 string
+}
+
+// packageURL returns the purl of a package built from spec.
+func packageURL(spec *Spec, version string) (string, error) {
+	d, err := LookupDistro(spec.Distro)
+	if err != nil {
+		return "", err
+	}
+
+	switch d.Kind {
+	case PkgKindDeb:
+		return fmt.Sprintf("pkg:deb/%s/%s@%s?arch=%s&distro=%s", d.Family, spec.Pkg, version, strings.ReplaceAll(spec.Arch, "/", ""), d.Name), nil
+	case PkgKindRPM:
+		arch, err := RpmArch(spec.Arch)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("pkg:rpm/%s/%s@%s?arch=%s&distro=%s", d.Family, spec.Pkg, version, arch, d.Tag), nil
+	default:
+		return fmt.Sprintf("pkg:generic/%s@%s?arch=%s", spec.Pkg, version, strings.ReplaceAll(spec.Arch, "/", "")), nil
+	}
+}
+
+// generateSBOM builds the SBOM of a package. binaries maps the path of each
+// binary in the build container c to where it is installed by the package;
+// they are copied out to read their Go build info, and binaries which are not
+// Go programs are skipped. The installed files are read from root, the staged
+// package root on the host.
+func generateSBOM(ctx context.Context, c *dagger.Container, a *Archive, spec *Spec, version string, binaries map[string]string, root string, created time.Time) (*SBOM, error) {
+	purl, err := packageURL(spec, version)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SBOM{
+		Name:    spec.Pkg,
+		Version: version,
+		PURL:    purl,
+		Webpage: a.Webpage,
+		Created: created,
+	}
+
+	tmp, err := os.MkdirTemp("", "moby-sbom-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	bins := make([]string, 0, len(binaries))
+	for bin := range binaries {
+		bins = append(bins, bin)
+	}
+	sort.Strings(bins)
+
+	modules := map[string]*SBOMModule{}
+	for i, bin := range bins {
+		local := filepath.Join(tmp, fmt.Sprintf("%d-%s", i, path.Base(bin)))
+		if _, err := c.File(bin).Export(ctx, local); err != nil {
+			return nil, fmt.Errorf("error exporting %s: %w", bin, err)
+		}
+
+		info, err := buildinfo.ReadFile(local)
+		if err != nil {
+			// Not a Go binary.
+			continue
+		}
+
+		name := binaries[bin]
+		add := func(p, v string) {
+			key := p + "@" + v
+			m, ok := modules[key]
+			if !ok {
+				m = &SBOMModule{Path: p, Version: v}
+				modules[key] = m
+			}
+			m.Binaries = append(m.Binaries, name)
+		}
+
+		add("stdlib", strings.TrimPrefix(info.GoVersion, "go"))
+		if info.Main.Path != "" {
+			v := info.Main.Version
+			if v == "" || v == "(devel)" {
+				v = spec.Tag
+			}
+			add(info.Main.Path, v)
+		}
+		for _, dep := range info.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			add(dep.Path, dep.Version)
+		}
+	}
+
+	for _, m := range modules {
+		s.Modules = append(s.Modules, *m)
+	}
+	sort.Slice(s.Modules, func(i, j int) bool { return s.Modules[i].PURL() < s.Modules[j].PURL() })
+
+	if s.Files, err = sbomFiles(root); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// installedBinaries maps each of the linux binaries of the archive to the
+// path it is installed at. Binaries which are only used for dependency
+// resolution and are not installed by a File entry keep their build path.
+func (a *Archive) installedBinaries() map[string]string {
+	binaries := make(map[string]string, len(a.Binaries))
+	for _, bin := range a.Binaries {
+		binaries[bin] = bin
+		for _, f := range a.Files {
+			if f.Source == bin && !f.IsDir {
+				binaries[bin] = "/" + strings.TrimPrefix(f.Dest, "/")
+				break
+			}
+		}
+	}
+	return binaries
+}
+
+func sbomFiles(root string) ([]SBOMFile, error) {
+	var files []SBOMFile
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, SBOMFile{
+			Name:   "/" + filepath.ToSlash(rel),
+			Sha256: fmt.Sprintf("%x", sha256.Sum256(b)),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// writeSBOM generates the SBOM of a package about to be written from root to
+// outDir/pkgFilename. The SBOM documents are written next to the package and,
+// if the archive asks for it, embedded into root. The embedded copy is taken
+// before it is added, so it does not list itself.
+func (a *Archive) writeSBOM(ctx context.Context, c *dagger.Container, spec *Spec, version string, binaries map[string]string, root, outDir, pkgFilename string, created time.Time) error {
+	s, err := generateSBOM(ctx, c, a, spec, version, binaries, root, created)
+	if err != nil {
+		return fmt.Errorf("error generating sbom: %w", err)
+	}
+
+	if a.EmbedSBOM {
+		if err := s.Embed(root); err != nil {
+			return fmt.Errorf("error embedding sbom: %w", err)
+		}
+	}
+
+	return s.WriteFiles(outDir, pkgFilename)
+}
+
+// WriteFiles writes the SPDX and CycloneDX documents to dir, named after the
+// package file they describe.
+func (s *SBOM) WriteFiles(dir, pkgFilename string) error {
+	spdx, err := s.SPDX()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, pkgFilename+SBOMExtensionSPDX), spdx, 0o644); err != nil {
+		return err
+	}
+
+	cdx, err := s.CycloneDX()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, pkgFilename+SBOMExtensionCycloneDX), cdx, 0o644)
+}
+
+// Embed writes the SBOM documents into the package root under
+// /usr/share/doc/<pkg>/.
+func (s *SBOM) Embed(root string) error {
+	dir := filepath.Join(root, "usr/share/doc", s.Name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return s.WriteFiles(dir, "sbom")
+}
+
+func marshalSBOM(v interface{}) ([]byte, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxFile struct {
+	SPDXID           string         `json:"SPDXID"`
+	FileName         string         `json:"fileName"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+// SPDX returns the SBOM as an SPDX 2.3 JSON document. The output only depends
+// on the contents of the SBOM, so it is reproducible.
+func (s *SBOM) SPDX() ([]byte, error) {
+	const noAssertion = "NOASSERTION"
+
+	download := s.Webpage
+	if download == "" {
+		download = noAssertion
+	}
+
+	doc := spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        s.Name + "-" + s.Version,
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomTool},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           "SPDXRef-Package",
+			Name:             s.Name,
+			VersionInfo:      s.Version,
+			DownloadLocation: download,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+			ExternalRefs:     []spdxExternalRef{{"PACKAGE-MANAGER", "purl", s.PURL}},
+		}},
+		Relationships: []spdxRelationship{{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Package"}},
+	}
+
+	for i, m := range s.Modules {
+		id := fmt.Sprintf("SPDXRef-Module-%d", i)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:           id,
+			Name:             m.Path,
+			VersionInfo:      m.Version,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+			ExternalRefs:     []spdxExternalRef{{"PACKAGE-MANAGER", "purl", m.PURL()}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-Package", "DEPENDS_ON", id})
+	}
+
+	for i, f := range s.Files {
+		id := fmt.Sprintf("SPDXRef-File-%d", i)
+		doc.Files = append(doc.Files, spdxFile{
+			SPDXID:           id,
+			FileName:         "." + f.Name,
+			Checksums:        []spdxChecksum{{"SHA256", f.Sha256}},
+			LicenseConcluded: noAssertion,
+			CopyrightText:    noAssertion,
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-Package", "CONTAINS", id})
+	}
+
+	// The namespace has to be unique per document, so derive it from the
+	// contents rather than using a random id.
+	h := sha256.New()
+	for _, p := range doc.Packages {
+		fmt.Fprintln(h, p.Name, p.VersionInfo)
+	}
+	for _, f := range s.Files {
+		fmt.Fprintln(h, f.Name, f.Sha256)
+	}
+	doc.DocumentNamespace = fmt.Sprintf("https://github.com/Azure/moby-packaging/spdx/%s/%s/%x", s.Name, s.Version, h.Sum(nil))
+
+	return marshalSBOM(doc)
+}
+
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type    string    `json:"type"`
+	BOMRef  string    `json:"bom-ref,omitempty"`
+	Name    string    `json:"name"`
+	Version string    `json:"version,omitempty"`
+	PURL    string    `json:"purl,omitempty"`
+	Hashes  []cdxHash `json:"hashes,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// CycloneDX returns the SBOM as a CycloneDX 1.5 JSON document.
+func (s *SBOM) CycloneDX() ([]byte, error) {
+	doc := cdxDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cdxMetadata{
+			Timestamp: s.Created.UTC().Format(time.RFC3339),
+			Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: sbomTool}}},
+			Component: cdxComponent{Type: "application", BOMRef: s.PURL, Name: s.Name, Version: s.Version, PURL: s.PURL},
+		},
+		Components: []cdxComponent{},
+	}
+
+	root := cdxDependency{Ref: s.PURL}
+	for _, m := range s.Modules {
+		doc.Components = append(doc.Components, cdxComponent{Type: "library", BOMRef: m.PURL(), Name: m.Path, Version: m.Version, PURL: m.PURL()})
+		root.DependsOn = append(root.DependsOn, m.PURL())
+	}
+	for _, f := range s.Files {
+		doc.Components = append(doc.Components, cdxComponent{Type: "file", Name: f.Name, Hashes: []cdxHash{{"SHA-256", f.Sha256}}})
+	}
+	doc.Dependencies = []cdxDependency{root}
+
+	return marshalSBOM(doc)
+}
@@ -0,0 +1,91 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSBOM(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr/bin/runc"), []byte("runc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := sbomFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "/usr/bin/runc" {
+		t.Fatalf("unexpected files: %v", files)
+	}
+
+	spec := &Spec{Pkg: "moby-runc", Distro: "jammy", Arch: "arm/v7", Tag: "1.1.12", Revision: "1"}
+	purl, err := packageURL(spec, "1.1.12-ubuntu22.04u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "pkg:deb/ubuntu/moby-runc@1.1.12-ubuntu22.04u1?arch=armv7&distro=jammy"; purl != want {
+		t.Errorf("expected purl %q, got %q", want, purl)
+	}
+
+	s := &SBOM{
+		Name:    "moby-runc",
+		Version: "1.1.12-ubuntu22.04u1",
+		PURL:    purl,
+		Created: time.Unix(1700000000, 0),
+		Modules: []SBOMModule{
+			{Path: "github.com/opencontainers/runc", Version: "1.1.12", Binaries: []string{"/usr/bin/runc"}},
+			{Path: "stdlib", Version: "1.21.9", Binaries: []string{"/usr/bin/runc"}},
+		},
+		Files: files,
+	}
+
+	spdx, err := s.SPDX()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.SPDX()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(spdx, again) {
+		t.Error("spdx document is not reproducible")
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(spdx, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Packages) != 3 || len(doc.Files) != 1 {
+		t.Errorf("expected 3 packages and 1 file, got %d and %d", len(doc.Packages), len(doc.Files))
+	}
+	// DESCRIBES, two DEPENDS_ON and one CONTAINS.
+	if len(doc.Relationships) != 4 {
+		t.Errorf("expected 4 relationships, got %d", len(doc.Relationships))
+	}
+	if doc.CreationInfo.Created != "2023-11-14T22:13:20Z" {
+		t.Errorf("unexpected creation time %q", doc.CreationInfo.Created)
+	}
+
+	cdx, err := s.CycloneDX()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom cdxDocument
+	if err := json.Unmarshal(cdx, &bom); err != nil {
+		t.Fatal(err)
+	}
+	if len(bom.Components) != 3 || len(bom.Dependencies) != 1 || len(bom.Dependencies[0].DependsOn) != 2 {
+		t.Errorf("unexpected cyclonedx document:\n%s", cdx)
+	}
+	if bom.Metadata.Component.PURL != purl {
+		t.Errorf("expected root purl %q, got %q", purl, bom.Metadata.Component.PURL)
+	}
+}
@@ -1,7 +1,9 @@
 package archive
 
 import (
+	"errors"
 	"fmt"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -9,47 +11,6 @@ import (
 
 var (
 	nonAlnum = regexp.MustCompile(`[^a-zA-Z0-9]+`)
-
-	ExtensionMap = map[string]string{
-		"bionic":   "deb",
-		"bookworm": "deb",
-		"bullseye": "deb",
-		"buster":   "deb",
-		"focal":    "deb",
-		"jammy":    "deb",
-		"noble":    "deb",
-		"rhel9":    "rpm",
-		"rhel8":    "rpm",
-		"mariner2": "rpm",
-		"windows":  "zip",
-	}
-
-	OSMap = map[string]string{
-		"bookworm": "debian",
-		"bullseye": "debian",
-		"buster":   "debian",
-		"bionic":   "ubuntu",
-		"focal":    "ubuntu",
-		"jammy":    "ubuntu",
-		"noble":    "ubuntu",
-		"rhel9":    "el9",
-		"rhel8":    "el8",
-		"mariner2": "cm2",
-		"windows":  "windows",
-	}
-
-	VersionMap = map[string]string{
-		"bookworm": "12",
-		"bullseye": "11",
-		"buster":   "10",
-		"bionic":   "18.04",
-		"focal":    "20.04",
-		"jammy":    "22.04",
-		"noble":    "24.04",
-		"rhel9":    "el9",
-		"rhel8":    "el8",
-		"mariner2": "cm2",
-	}
 )
 
 type Spec struct {
@@ -115,47 +76,44 @@ func (s *Spec) Dir(rootDir string) string {
 // name, according to those semantic rules, based on the information in the
 // build spec.
 func (s *Spec) Basename() (string, error) {
-	o, ok := OSMap[s.Distro]
-	if !ok {
-		return "", fmt.Errorf("Distro not understood: '%s'", s.Distro)
+	d, err := LookupDistro(s.Distro)
+	if err != nil {
+		return "", err
 	}
 
-	extension := ExtensionMap[s.Distro]
-	version := VersionMap[s.Distro]
 	sanitizedArch := strings.ReplaceAll(s.Arch, "/", "")
 	str := ""
 
-	switch o {
-	case "debian", "ubuntu":
-		str = fmt.Sprintf("%[1]s_%[2]s-%[3]s%[4]su%[5]s_%[6]s.%[7]s",
+	switch d.Kind {
+	case PkgKindDeb:
+		str = fmt.Sprintf("%[1]s_%[2]s-%[3]su%[4]s_%[5]s.%[6]s",
 			/* 1 */ s.Pkg,
 			/* 2 */ s.Tag,
-			/* 3 */ o,
-			/* 4 */ version,
-			/* 5 */ s.Revision,
-			/* 6 */ sanitizedArch,
-			/* 7 */ extension,
+			/* 3 */ d.Tag,
+			/* 4 */ s.Revision,
+			/* 5 */ sanitizedArch,
+			/* 6 */ d.Extension(),
 		)
-	case "windows":
+	case PkgKindWin:
 		str = fmt.Sprintf("%[1]s-%[2]s+azure-u%[3]s.%[4]s.%[5]s",
 			/* 1 */ s.Pkg,
 			/* 2 */ s.Tag,
 			/* 3 */ s.Revision,
 			/* 4 */ sanitizedArch,
-			/* 5 */ extension,
+			/* 5 */ d.Extension(),
 		)
 	default:
-		arch, ok := rpmArchMap[s.Arch]
-		if !ok {
-			arch = s.Arch
+		arch, err := RpmArch(s.Arch)
+		if err != nil {
+			return "", err
 		}
 		str = fmt.Sprintf("%[1]s-%[2]s-%[3]s.%[4]s.%[5]s.%[6]s",
 			/* 1 */ s.Pkg,
 			/* 2 */ s.Tag,
 			/* 3 */ s.Revision,
-			/* 4 */ o,
+			/* 4 */ d.Tag,
 			/* 5 */ arch,
-			/* 6 */ extension,
+			/* 6 */ d.Extension(),
 		)
 	}
 
@@ -179,3 +137,178 @@ func (s *Spec) OS() string {
 
 	return "linux"
 }
+
+// ParseStoragePath is the inverse of StoragePath: it returns the spec of the
+// package stored at p. Only the fields which are part of the path are set;
+// the repo and commit are left empty.
+func ParseStoragePath(p string) (Spec, error) {
+	spec, err := ParseBasename(path.Base(p))
+	if err != nil {
+		return Spec{}, err
+	}
+
+	// The directories repeat what is in the basename, so they must match.
+	expected, err := spec.StoragePath()
+	if err != nil {
+		return Spec{}, err
+	}
+	if p != expected {
+		return Spec{}, fmt.Errorf("invalid storage path %q: expected %s", p, expected)
+	}
+	return spec, nil
+}
+
+// ParseBasename is the inverse of Basename: it returns the spec of the
+// package named base, a deb, rpm or windows zip. Only the package, distro,
+// arch, tag and revision are set.
+func ParseBasename(base string) (Spec, error) {
+	var (
+		spec Spec
+		err  error
+	)
+	switch path.Ext(base) {
+	case ".deb":
+		spec, err = parseDebBasename(strings.TrimSuffix(base, ".deb"))
+	case ".rpm":
+		spec, err = parseRpmBasename(strings.TrimSuffix(base, ".rpm"))
+	case ".zip":
+		spec, err = parseWinBasename(strings.TrimSuffix(base, ".zip"))
+	default:
+		err = errors.New("unknown package type")
+	}
+	if err != nil {
+		return Spec{}, fmt.Errorf("invalid package name %q: %w", base, err)
+	}
+	if spec.Pkg == "" || spec.Tag == "" || spec.Revision == "" {
+		return Spec{}, fmt.Errorf("invalid package name %q: missing package, version or revision", base)
+	}
+	// Package names may contain dashes, so in rpms and zips only the
+	// version starting with a digit, as debian requires, tells them apart.
+	if !isDigit(spec.Tag[0]) {
+		return Spec{}, fmt.Errorf("invalid package name %q: version %q does not start with a digit", base, spec.Tag)
+	}
+
+	// Anything ambiguous in the name, such as a tag containing the
+	// separators around it, would not give the same name back.
+	if b, err := spec.Basename(); err != nil || b != base {
+		return Spec{}, fmt.Errorf("invalid package name %q: cannot be parsed unambiguously", base)
+	}
+	return spec, nil
+}
+
+// parseDebBasename parses <pkg>_<tag>-<distro tag>u<revision>_<arch>.
+func parseDebBasename(s string) (Spec, error) {
+	pkg, rest, ok := strings.Cut(s, "_")
+	if !ok {
+		return Spec{}, errors.New("expected <package>_<version>_<arch>.deb")
+	}
+	i := strings.LastIndex(rest, "_")
+	if i < 0 {
+		return Spec{}, errors.New("expected <package>_<version>_<arch>.deb")
+	}
+	version, arch := rest[:i], rest[i+1:]
+
+	i = strings.LastIndex(version, "-")
+	if i < 0 {
+		return Spec{}, fmt.Errorf("expected a debian revision in version %q", version)
+	}
+	tag, debRev := version[:i], version[i+1:]
+
+	// The revision is prefixed by the distro tag, which may end in digits
+	// itself, e.g. debian10u1, so the longest matching tag wins.
+	var (
+		distro Distro
+		rev    string
+	)
+	for _, d := range Distros() {
+		if d.Kind != PkgKindDeb || len(d.Tag) <= len(distro.Tag) {
+			continue
+		}
+		if r, ok := strings.CutPrefix(debRev, d.Tag+"u"); ok {
+			distro, rev = d, r
+		}
+	}
+	if distro.Name == "" {
+		return Spec{}, fmt.Errorf("unknown distro in revision %q", debRev)
+	}
+
+	return Spec{Pkg: pkg, Distro: distro.Name, Arch: unsanitizeArch(distro, arch), Tag: tag, Revision: rev}, nil
+}
+
+// parseRpmBasename parses <pkg>-<tag>-<revision>.<distro tag>.<rpm arch>.
+func parseRpmBasename(s string) (Spec, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 3 {
+		return Spec{}, errors.New("expected <package>-<version>-<release>.<dist>.<arch>.rpm")
+	}
+	nvr := strings.Join(parts[:len(parts)-2], ".")
+	distTag, rpmArch := parts[len(parts)-2], parts[len(parts)-1]
+
+	var spec Spec
+	for _, d := range Distros() {
+		if d.Kind == PkgKindRPM && d.Tag == distTag {
+			spec.Distro = d.Name
+		}
+	}
+	if spec.Distro == "" {
+		return Spec{}, fmt.Errorf("unknown distro tag %q", distTag)
+	}
+	for arch, a := range rpmArchMap {
+		if a == rpmArch {
+			spec.Arch = arch
+		}
+	}
+	if spec.Arch == "" {
+		return Spec{}, fmt.Errorf("unknown rpm architecture %q", rpmArch)
+	}
+
+	i := strings.LastIndex(nvr, "-")
+	if i < 0 {
+		return Spec{}, errors.New("expected <package>-<version>-<release>")
+	}
+	nv := nvr[:i]
+	spec.Revision = nvr[i+1:]
+	i = strings.LastIndex(nv, "-")
+	if i < 0 {
+		return Spec{}, errors.New("expected <package>-<version>-<release>")
+	}
+	spec.Pkg, spec.Tag = nv[:i], nv[i+1:]
+	return spec, nil
+}
+
+// parseWinBasename parses <pkg>-<tag>+azure-u<revision>.<arch>.
+func parseWinBasename(s string) (Spec, error) {
+	nv, rest, ok := strings.Cut(s, "+azure-u")
+	if !ok {
+		return Spec{}, errors.New("expected <package>-<version>+azure-u<revision>.<arch>.zip")
+	}
+	i := strings.LastIndex(rest, ".")
+	if i < 0 {
+		return Spec{}, errors.New("expected <package>-<version>+azure-u<revision>.<arch>.zip")
+	}
+	rev, arch := rest[:i], rest[i+1:]
+
+	i = strings.LastIndex(nv, "-")
+	if i < 0 {
+		return Spec{}, errors.New("expected <package>-<version>")
+	}
+
+	var distro Distro
+	for _, d := range Distros() {
+		if d.Kind == PkgKindWin {
+			distro = d
+		}
+	}
+	return Spec{Pkg: nv[:i], Distro: distro.Name, Arch: unsanitizeArch(distro, arch), Tag: nv[i+1:], Revision: rev}, nil
+}
+
+// unsanitizeArch undoes the removal of the slash from arches such as arm/v7
+// in basenames.
+func unsanitizeArch(d Distro, arch string) string {
+	for _, a := range d.Arches {
+		if strings.ReplaceAll(a, "/", "") == arch {
+			return a
+		}
+	}
+	return arch
+}
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	var n int
+	for _, d := range Distros() {
+		for _, arch := range d.Arches {
+			for _, s := range []Spec{
+				{Pkg: "moby-runc", Tag: "1.1.12", Revision: "1"},
+				{Pkg: "moby-containerd-shim-systemd", Tag: "0.1.0", Revision: "12"},
+				{Pkg: "moby-engine", Tag: "24.0.9~rc.1", Revision: "3"},
+				{Pkg: "moby-cli", Tag: "20.10.9+dfsg1", Revision: "10"},
+			} {
+				s.Distro, s.Arch = d.Name, arch
+
+				base, err := s.Basename()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ParseBasename(base)
+				if err != nil {
+					t.Errorf("%s: %v", base, err)
+					continue
+				}
+				if got != s {
+					t.Errorf("%s: expected %+v, got %+v", base, s, got)
+				}
+
+				p, err := s.StoragePath()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err = ParseStoragePath(p)
+				if err != nil {
+					t.Errorf("%s: %v", p, err)
+					continue
+				}
+				if got != s {
+					t.Errorf("%s: expected %+v, got %+v", p, s, got)
+				}
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		t.Fatal("no specs tested")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, name := range []string{
+		"moby-runc_1.1.12-ubuntu22.04u1_amd64.tar.gz",
+		"moby-runc_1.1.12_amd64.deb",
+		"moby-runc_1.1.12-1_amd64.deb",
+		"moby-runc_1.1.12-ubuntu99.04u1_amd64.deb",
+		"moby-runc_1.1.12-ubuntu22.04u_amd64.deb",
+		"moby-engine_20.10.9+azure-1_amd64.deb",
+		"moby-runc-1.1.12-1.fc40.x86_64.rpm",
+		"moby-runc-1.1.12-1.el9.ppc64le.rpm",
+		"moby-runc-1.1.12.el9.x86_64.rpm",
+		"moby-engine-20.10.2+azure-1.amd64.zip",
+		"moby-engine-20.10.2+azure-u.amd64.zip",
+	} {
+		if s, err := ParseBasename(name); err == nil {
+			t.Errorf("%s: expected an error, got %+v", name, s)
+		}
+	}
+
+	for _, p := range []string{
+		"moby-runc_1.1.12-ubuntu22.04u1_amd64.deb",
+		"moby-runc/1.1.12/jammy/linux_amd64/moby-runc_1.1.12-ubuntu22.04u1_amd64.deb",
+		"moby-runc/1.1.12+azure/focal/linux_amd64/moby-runc_1.1.12-ubuntu22.04u1_amd64.deb",
+		"moby-runc/1.1.12+azure/jammy/linux_arm64/moby-runc_1.1.12-ubuntu22.04u1_amd64.deb",
+		"moby-cli/1.1.12+azure/jammy/linux_amd64/moby-runc_1.1.12-ubuntu22.04u1_amd64.deb",
+	} {
+		if s, err := ParseStoragePath(p); err == nil || !strings.Contains(err.Error(), "moby-runc_1.1.12-ubuntu22.04u1_amd64.deb") {
+			t.Errorf("%s: expected an error, got %+v: %v", p, s, err)
+		}
+	}
+}
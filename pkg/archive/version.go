@@ -0,0 +1,242 @@
+package archive
+
+import (
+	"strings"
+)
+
+// CompareVersions compares two package versions the way the package manager
+// for kind does, returning -1, 0 or 1 if a is older than, the same as or
+// newer than b. Windows zips have no package manager and follow the debian
+// rules.
+func CompareVersions(kind PkgKind, a, b string) int {
+	if kind == PkgKindRPM {
+		return CompareRpmVersions(a, b)
+	}
+	return CompareDebVersions(a, b)
+}
+
+// CompareDebVersions compares two debian versions, [epoch:]upstream[-revision],
+// following dpkg: the epochs are compared as numbers, then the upstream
+// versions and the revisions with dpkg's rules, where "~" sorts before
+// anything, even the end of the version.
+func CompareDebVersions(a, b string) int {
+	ea, ua, ra := splitDebVersion(a)
+	eb, ub, rb := splitDebVersion(b)
+
+	if c := compareNumbers(ea, eb); c != 0 {
+		return c
+	}
+	if c := debVerRevCmp(ua, ub); c != 0 {
+		return c
+	}
+	return debVerRevCmp(ra, rb)
+}
+
+func splitDebVersion(v string) (epoch, upstream, revision string) {
+	epoch = "0"
+	if e, rest, ok := strings.Cut(v, ":"); ok {
+		epoch, v = e, rest
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// debOrder is the weight of a character in the non-digit parts of a debian
+// version.
+func debOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+// debVerRevCmp is dpkg's verrevcmp. The versions are compared as
+// alternating runs of non-digits, compared character by character, and
+// digits, compared as numbers.
+func debVerRevCmp(a, b string) int {
+	for a != "" || b != "" {
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			var ac, bc int
+			if a != "" {
+				ac = debOrder(a[0])
+			}
+			if b != "" {
+				bc = debOrder(b[0])
+			}
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			// Both are the same non-digit, so neither is at its end.
+			a, b = a[1:], b[1:]
+		}
+
+		var na, nb string
+		na, a = spanDigits(a)
+		nb, b = spanDigits(b)
+		if c := compareNumbers(na, nb); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// CompareRpmVersions compares two rpm versions, [epoch:]version[-release],
+// following rpm: the epochs are compared as numbers, then the versions and
+// the releases with rpmvercmp.
+func CompareRpmVersions(a, b string) int {
+	ea, va, ra := splitRpmVersion(a)
+	eb, vb, rb := splitRpmVersion(b)
+
+	if c := compareNumbers(ea, eb); c != 0 {
+		return c
+	}
+	if c := rpmVerCmp(va, vb); c != 0 {
+		return c
+	}
+	// A missing release matches any release.
+	if ra == "" || rb == "" {
+		return 0
+	}
+	return rpmVerCmp(ra, rb)
+}
+
+func splitRpmVersion(v string) (epoch, version, release string) {
+	epoch = "0"
+	if e, rest, ok := strings.Cut(v, ":"); ok {
+		epoch, v = e, rest
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// rpmVerCmp is rpm's rpmvercmp. The versions are split into runs of digits
+// and of letters, ignoring anything else. Digits sort after letters, "~"
+// sorts before anything, even the end of the version, and "^" sorts after
+// the end of the version but before anything else.
+func rpmVerCmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+next:
+	for a != "" || b != "" {
+		a = strings.TrimLeftFunc(a, isRpmSeparator)
+		b = strings.TrimLeftFunc(b, isRpmSeparator)
+
+		for _, special := range []byte{'~', '^'} {
+			as, bs := strings.HasPrefix(a, string(special)), strings.HasPrefix(b, string(special))
+			switch {
+			case as && bs:
+				a, b = a[1:], b[1:]
+				continue next
+			case as:
+				if special == '^' && b == "" {
+					return 1
+				}
+				return -1
+			case bs:
+				if special == '^' && a == "" {
+					return -1
+				}
+				return 1
+			}
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		if isDigit(a[0]) {
+			var na, nb string
+			na, a = spanDigits(a)
+			if !isDigit(b[0]) {
+				return 1
+			}
+			nb, b = spanDigits(b)
+			if c := compareNumbers(na, nb); c != 0 {
+				return c
+			}
+			continue
+		}
+
+		if isDigit(b[0]) {
+			return -1
+		}
+		var sa, sb string
+		sa, a = spanAlpha(a)
+		sb, b = spanAlpha(b)
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+func isRpmSeparator(r rune) bool {
+	if r < 128 && (isDigit(byte(r)) || isAlpha(byte(r))) {
+		return false
+	}
+	return r != '~' && r != '^'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func spanDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func spanAlpha(s string) (string, string) {
+	i := 0
+	for i < len(s) && isAlpha(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// compareNumbers compares two strings of digits as numbers, however long.
+func compareNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
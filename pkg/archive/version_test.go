@@ -0,0 +1,68 @@
+package archive
+
+import "testing"
+
+func TestCompareDebVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0-1", "1.0-01", 0},
+		{"1.0", "1.0-0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0+azure", "1.0", 1},
+		{"1.0a", "1.0+", -1},
+		{"1:1.0", "2.0", 1},
+		{"20.10.9-1", "20.10.17-1", -1},
+		{"1.7.13-ubuntu22.04u2", "1.7.13-ubuntu22.04u10", -1},
+		{"1.2.3-4", "1.2.3-4.1", -1},
+	} {
+		if got := CompareDebVersions(tc.a, tc.b); got != tc.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", tc.a, tc.b, tc.expected, got)
+		}
+		if got := CompareDebVersions(tc.b, tc.a); got != -tc.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", tc.b, tc.a, -tc.expected, got)
+		}
+	}
+}
+
+// Cases from rpm's rpmvercmp tests.
+func TestCompareRpmVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0.1a", -1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"1.0aa", "1.0a", 1},
+		{"1b.fc17", "1.fc17", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git123", "1.0~rc1", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0^git1~pre", "1.0^git1", -1},
+		{"1.0", "1.0-1", 0},
+		{"1:1.0-1", "2.0-1", 1},
+		{"1.7.13-2", "1.7.13-10", -1},
+		{"2_0", "2.0", 0},
+	} {
+		if got := CompareRpmVersions(tc.a, tc.b); got != tc.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", tc.a, tc.b, tc.expected, got)
+		}
+		if got := CompareRpmVersions(tc.b, tc.a); got != -tc.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", tc.b, tc.a, -tc.expected, got)
+		}
+	}
+}
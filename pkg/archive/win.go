@@ -1,6 +1,10 @@
 package archive
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path"
 	"strings"
 
 	"dagger.io/dagger"
@@ -22,7 +26,8 @@ func NewWinPackager(a *Archive, mp string) *WinPackager {
 	}
 }
 
-func (w *WinPackager) Package(client *dagger.Client, c *dagger.Container, project *Spec) *dagger.Directory {
+func (w *WinPackager) Package(client *dagger.Client, c *dagger.Container, project *Spec) (*dagger.Directory, error) {
+	ctx := context.TODO()
 	dir := client.Directory()
 	rootDir := "/package"
 	sanitizedArch := strings.ReplaceAll(project.Arch, "/", "")
@@ -44,7 +49,56 @@ func (w *WinPackager) Package(client *dagger.Client, c *dagger.Container, projec
         zip "/out/${PROJECT}-${VERSION}+azure-u${REVISION}.${ARCH}.zip" *
         `})
 
-	return c.Directory("/out")
+	version := project.Tag + "+azure-u" + project.Revision
+	filename := fmt.Sprintf("%s-%s.%s.zip", project.Pkg, version, sanitizedArch)
+	c, err := w.withSBOM(ctx, c, project, version, rootDir, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Directory("/out"), nil
+}
+
+// withSBOM adds the SBOM documents of the zip to /out. There is nowhere to
+// embed them in a zip, so EmbedSBOM is ignored.
+func (w *WinPackager) withSBOM(ctx context.Context, c *dagger.Container, project *Spec, version, rootDir, filename string) (*dagger.Container, error) {
+	modTime, err := sourceDateEpoch(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := os.MkdirTemp("", "moby-win-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(root)
+
+	if _, err := c.Directory(rootDir).Export(ctx, root); err != nil {
+		return nil, fmt.Errorf("error exporting package root: %w", err)
+	}
+
+	binaries := make(map[string]string, len(w.a.WinBinaries))
+	for _, b := range w.a.WinBinaries {
+		binaries[b] = "/" + path.Base(b)
+	}
+
+	s, err := generateSBOM(ctx, c, &w.a, project, version, binaries, root, modTime)
+	if err != nil {
+		return nil, fmt.Errorf("error generating sbom: %w", err)
+	}
+
+	spdx, err := s.SPDX()
+	if err != nil {
+		return nil, err
+	}
+	cdx, err := s.CycloneDX()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.
+		WithNewFile("/out/"+filename+SBOMExtensionSPDX, string(spdx)).
+		WithNewFile("/out/"+filename+SBOMExtensionCycloneDX, string(cdx)), nil
 }
 
 func (w *WinPackager) moveStaticFiles(c *dagger.Container, rootdir string) *dagger.Container {
@@ -0,0 +1,287 @@
+// Package index generates the indexes published next to the packages in
+// storage: the latest version of every package for every distro and
+// architecture, as JSON and as an RSS feed, and the versions of each release
+// series, so users and install scripts can find packages without listing
+// the storage container.
+package index
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/storage"
+)
+
+// defaultMinVersions is the oldest version of each package to index. Older
+// packages are still stored, but are not listed.
+//
+//go:embed min-versions.json
+var defaultMinVersions []byte
+
+// DefaultMinVersions returns the minimum version of each package indexed
+// by default, e.g. "moby-runc": "1.0.0-0".
+func DefaultMinVersions() map[string]string {
+	m := map[string]string{}
+	if err := json.Unmarshal(defaultMinVersions, &m); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Entry is a package in the index.
+type Entry struct {
+	Name   string `json:"name"`
+	Distro string `json:"distro"`
+	// Version is the tag and revision of the package, e.g. "1.1.12-2".
+	Version string `json:"version"`
+	URI     string `json:"uri"`
+	// Arch is the architecture in the format used by build specs, e.g.
+	// "arm/v7".
+	Arch   string `json:"arch"`
+	Sha256 string `json:"sha256"`
+
+	kind archive.PkgKind
+	// series is the major.minor version the package belongs to.
+	series string
+}
+
+// Options configures the index.
+type Options struct {
+	// URLPrefix is the URL the storage container is served from. The URI
+	// of a package is its storage path under it.
+	URLPrefix string
+	// IndexURL is the URL the index is served from, linked to from the
+	// RSS feed.
+	IndexURL string
+	// MinVersions is the oldest version of each package to index.
+	// Packages missing from it are indexed whatever their version.
+	MinVersions map[string]string
+}
+
+// Index is the packages found in storage, sorted by name and then version.
+type Index struct {
+	Entries []Entry
+	// Skipped lists the errors for the packages which were found in
+	// storage but could not be indexed, because their path follows
+	// neither archive.Spec.StoragePath nor the older basenames.
+	Skipped []error
+
+	opts Options
+}
+
+// New indexes the packages in objs. Anything other than a package, such as
+// provenance, is ignored.
+func New(objs []storage.Object, opts Options) *Index {
+	idx := &Index{opts: opts}
+	for _, obj := range objs {
+		switch path.Ext(obj.Name) {
+		case ".deb", ".rpm", ".zip":
+		default:
+			continue
+		}
+
+		e, err := newEntry(obj, opts.URLPrefix)
+		if err != nil {
+			idx.Skipped = append(idx.Skipped, err)
+			continue
+		}
+		if min, ok := opts.MinVersions[e.Name]; ok && archive.CompareVersions(e.kind, e.Version, min) < 0 {
+			continue
+		}
+		idx.Entries = append(idx.Entries, e)
+	}
+
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		return compareEntries(idx.Entries[i], idx.Entries[j]) < 0
+	})
+	return idx
+}
+
+func newEntry(obj storage.Object, urlPrefix string) (Entry, error) {
+	var kind archive.PkgKind
+	spec, err := archive.ParseStoragePath(obj.Name)
+	if err == nil {
+		d, err := archive.LookupDistro(spec.Distro)
+		if err != nil {
+			return Entry{}, fmt.Errorf("%s: %w", obj.Name, err)
+		}
+		kind = d.Kind
+	} else {
+		legacy, legacyKind, lerr := parseLegacyPath(obj.Name)
+		if lerr != nil {
+			return Entry{}, err
+		}
+		spec, kind = legacy, legacyKind
+	}
+
+	return Entry{
+		Name:    spec.Pkg,
+		Distro:  spec.Distro,
+		Version: spec.Tag + "-" + spec.Revision,
+		URI:     strings.TrimSuffix(urlPrefix, "/") + "/" + obj.Name,
+		Arch:    spec.Arch,
+		Sha256:  obj.Metadata[storage.Sha256Key],
+		kind:    kind,
+		series:  series(spec.Tag),
+	}, nil
+}
+
+// Packages uploaded before the basenames included the distro, e.g.
+// "moby-engine_20.10.9+azure-1_amd64.deb", "moby-engine-20.10.17+azure-1.el8.x86_64.rpm"
+// or "moby-engine-20.10.2+azure-1.amd64.zip", have only the version and
+// revision in their basename.
+var (
+	legacyDebVersion = `_(\d+\.\d+\.\d+)(?:\+azure)?-(?:\w+\d+(?:\.\d+)?u)?(\d+)_`
+	legacyRpmVersion = `-(\d+\.\d+\.\d+)(?:\+azure)?-(\d+)\.`
+	legacyZipVersion = `-(\d+\.\d+\.\d+)(?:\+azure)?-u?(\d+)\.`
+)
+
+// parseLegacyPath returns the spec and package kind of a package stored
+// under a basename older than archive.Spec.Basename. The name, distro and
+// arch are taken from the directories of its storage path, and the kind
+// from its extension, since the distro may be one no longer built, such as
+// xenial or centos7.
+func parseLegacyPath(p string) (archive.Spec, archive.PkgKind, error) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 5 {
+		return archive.Spec{}, "", fmt.Errorf("invalid storage path %q", p)
+	}
+	pkg, distro, osArch, base := parts[0], parts[2], parts[3], parts[4]
+
+	var (
+		version string
+		kind    archive.PkgKind
+	)
+	switch path.Ext(base) {
+	case ".deb":
+		version, kind = legacyDebVersion, archive.PkgKindDeb
+	case ".rpm":
+		version, kind = legacyRpmVersion, archive.PkgKindRPM
+	case ".zip":
+		version, kind = legacyZipVersion, archive.PkgKindWin
+	default:
+		return archive.Spec{}, "", fmt.Errorf("invalid package name %q: unknown package type", base)
+	}
+	m := regexp.MustCompile("^" + regexp.QuoteMeta(pkg) + version).FindStringSubmatch(base)
+	if m == nil {
+		return archive.Spec{}, "", fmt.Errorf("invalid package name %q", base)
+	}
+
+	_, arch, ok := strings.Cut(osArch, "_")
+	if !ok {
+		return archive.Spec{}, "", fmt.Errorf("invalid storage path %q: missing os and arch", p)
+	}
+	return archive.Spec{
+		Pkg:      pkg,
+		Distro:   distro,
+		Arch:     strings.ReplaceAll(arch, "_", "/"),
+		Tag:      m[1],
+		Revision: m[2],
+	}, kind, nil
+}
+
+// series returns the major.minor part of a tag, e.g. "1.7" for "1.7.13".
+func series(tag string) string {
+	parts := strings.SplitN(tag, ".", 3)
+	if len(parts) < 2 {
+		return tag
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// compareEntries orders entries by name, then version, with the version
+// rules of their package manager. Entries of different kinds, which are
+// never compared to find the latest one, fall back to the debian rules.
+func compareEntries(a, b Entry) int {
+	if c := strings.Compare(a.Name, b.Name); c != 0 {
+		return c
+	}
+	kind := a.kind
+	if a.kind != b.kind {
+		kind = archive.PkgKindDeb
+	}
+	if c := archive.CompareVersions(kind, a.Version, b.Version); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Distro, b.Distro); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Arch, b.Arch)
+}
+
+// latest returns the newest of the entries for each distro, package and
+// architecture, sorted by those.
+func latest(entries []Entry) []Entry {
+	type key struct{ distro, name, arch string }
+	newest := map[key]Entry{}
+	for _, e := range entries {
+		k := key{e.Distro, e.Name, e.Arch}
+		if cur, ok := newest[k]; !ok || archive.CompareVersions(e.kind, e.Version, cur.Version) >= 0 {
+			newest[k] = e
+		}
+	}
+
+	out := make([]Entry, 0, len(newest))
+	for _, e := range newest {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Distro != b.Distro {
+			return a.Distro < b.Distro
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Arch < b.Arch
+	})
+	return out
+}
+
+// Latest returns the newest version of each package for each distro and
+// architecture.
+func (idx *Index) Latest() []Entry {
+	return latest(idx.Entries)
+}
+
+func (idx *Index) filter(keep func(Entry) bool) []Entry {
+	var out []Entry
+	for _, e := range idx.Entries {
+		if keep(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// byDistro groups entries as distro -> package -> entries.
+func byDistro(entries []Entry) map[string]map[string][]Entry {
+	m := map[string]map[string][]Entry{}
+	for _, e := range entries {
+		if m[e.Distro] == nil {
+			m[e.Distro] = map[string][]Entry{}
+		}
+		m[e.Distro][e.Name] = append(m[e.Distro][e.Name], e)
+	}
+	return m
+}
+
+// unique returns the sorted set of values of f over the entries.
+func unique(entries []Entry, f func(Entry) string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, e := range entries {
+		if v := f(e); !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
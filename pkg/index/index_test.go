@@ -0,0 +1,155 @@
+package index
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/moby-packaging/pkg/storage"
+)
+
+func object(name string) storage.Object {
+	return storage.Object{Name: name, Properties: storage.Properties{Metadata: map[string]string{storage.Sha256Key: "sum-" + filepath.Base(name)}}}
+}
+
+func readJSON(t *testing.T, p string, v interface{}) {
+	t.Helper()
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	objs := []storage.Object{
+		object("moby-runc/1.1.9+azure/jammy/linux_amd64/moby-runc_1.1.9-ubuntu22.04u1_amd64.deb"),
+		object("moby-runc/1.1.10+azure/jammy/linux_amd64/moby-runc_1.1.10-ubuntu22.04u1_amd64.deb"),
+		object("moby-runc/1.1.10+azure/jammy/linux_amd64/moby-runc_1.1.10-ubuntu22.04u1_amd64.deb.intoto.json"),
+		object("moby-runc/1.1.10+azure/jammy/linux_arm_v7/moby-runc_1.1.10-ubuntu22.04u1_armv7.deb"),
+		object("moby-runc/1.1.10+azure/jammy/linux_arm_v7/moby-runc_1.1.10-ubuntu22.04u2_armv7.deb"),
+		object("moby-runc/1.1.10+azure/jammy/linux_arm_v7/moby-runc_1.1.10-ubuntu22.04u10_armv7.deb"),
+		object("moby-runc/1.0.3+azure/rhel9/linux_arm64/moby-runc-1.0.3-1.el9.aarch64.rpm"),
+		object("moby-runc/1.2.0~rc1+azure/rhel9/linux_arm64/moby-runc-1.2.0~rc1-1.el9.aarch64.rpm"),
+		object("moby-runc/1.1.12+azure/rhel9/linux_arm64/moby-runc-1.1.12-1.el9.aarch64.rpm"),
+		object("moby-runc/0.9.0+azure/rhel9/linux_arm64/moby-runc-0.9.0-1.el9.aarch64.rpm"),
+		object("moby-engine/20.10.9+azure/bionic/linux_amd64/moby-engine_20.10.9+azure-1_amd64.deb"),
+		object("moby-engine/20.10.17+azure/rhel8/linux_amd64/moby-engine-20.10.17+azure-1.el8.x86_64.rpm"),
+		object("moby-engine/20.10.2+azure/windows/windows_amd64/moby-engine-20.10.2+azure-1.amd64.zip"),
+		object("moby-engine/20.10.2+azure/windows/windows_amd64/moby-engine.zip"),
+	}
+
+	idx := New(objs, Options{
+		URLPrefix:   "https://example.com/moby/",
+		IndexURL:    "https://example.com/index",
+		MinVersions: DefaultMinVersions(),
+	})
+	if len(idx.Skipped) != 1 || !strings.Contains(idx.Skipped[0].Error(), `"moby-engine.zip"`) {
+		t.Errorf("expected the unversioned engine package to be skipped, got %v", idx.Skipped)
+	}
+	if len(idx.Entries) != 11 {
+		t.Fatalf("expected 11 entries, got %d: %+v", len(idx.Entries), idx.Entries)
+	}
+
+	var legacy []string
+	for _, e := range idx.Entries {
+		if e.Name == "moby-engine" {
+			legacy = append(legacy, e.Distro+" "+e.Arch+" "+e.Version)
+		}
+	}
+	if expected := "windows amd64 20.10.2-1,bionic amd64 20.10.9-1,rhel8 amd64 20.10.17-1"; strings.Join(legacy, ",") != expected {
+		t.Errorf("expected legacy entries %s, got %s", expected, strings.Join(legacy, ","))
+	}
+
+	dir := t.TempDir()
+	if err := idx.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest map[string]map[string][]Entry
+	readJSON(t, filepath.Join(dir, "latest.json"), &latest)
+	var got []string
+	for _, distro := range []string{"jammy", "rhel9"} {
+		for _, e := range latest[distro]["moby-runc"] {
+			got = append(got, e.Distro+" "+e.Arch+" "+e.Version)
+		}
+	}
+	expected := []string{
+		"jammy amd64 1.1.10-1",
+		"jammy arm/v7 1.1.10-10",
+		"rhel9 arm64 1.2.0~rc1-1",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected latest:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	e := latest["jammy"]["moby-runc"][0]
+	if e.URI != "https://example.com/moby/moby-runc/1.1.10+azure/jammy/linux_amd64/moby-runc_1.1.10-ubuntu22.04u1_amd64.deb" || e.Sha256 != "sum-moby-runc_1.1.10-ubuntu22.04u1_amd64.deb" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	for p, want := range map[string]string{
+		"jammy/moby-runc/latest/arm/v7": "https://example.com/moby/moby-runc/1.1.10+azure/jammy/linux_arm_v7/moby-runc_1.1.10-ubuntu22.04u10_armv7.deb\n",
+		"jammy/moby-runc/latest/armv7":  "https://example.com/moby/moby-runc/1.1.10+azure/jammy/linux_arm_v7/moby-runc_1.1.10-ubuntu22.04u10_armv7.deb\n",
+	} {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil || string(b) != want {
+			t.Errorf("%s: expected %q, got %q: %v", p, want, b, err)
+		}
+	}
+
+	var versions []string
+	readJSON(t, filepath.Join(dir, "rhel9/moby-runc/versions.json"), &versions)
+	if strings.Join(versions, " ") != "1.0 1.1 1.2" {
+		t.Errorf("unexpected versions: %v", versions)
+	}
+
+	var series []Entry
+	readJSON(t, filepath.Join(dir, "jammy/moby-runc/1.1/index.json"), &series)
+	got = nil
+	for _, e := range series {
+		got = append(got, e.Arch+" "+e.Version)
+	}
+	if expected := "amd64 1.1.9-1,amd64 1.1.10-1,arm/v7 1.1.10-1,arm/v7 1.1.10-2,arm/v7 1.1.10-10"; strings.Join(got, ",") != expected {
+		t.Errorf("expected series %s, got %s", expected, strings.Join(got, ","))
+	}
+
+	rss, err := os.ReadFile(filepath.Join(dir, "latest.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<atom:link href="https://example.com/index/latest.rss" rel="self" type="application/rss+xml" />`,
+		"<title>moby-runc 1.1.10-10 arm/v7</title>",
+		"SHA256 Digest: sum-moby-runc-1.2.0~rc1-1.el9.aarch64.rpm",
+	} {
+		if !strings.Contains(string(rss), want) {
+			t.Errorf("expected %q in the feed:\n%s", want, rss)
+		}
+	}
+}
+
+func TestIndexLegacyDistro(t *testing.T) {
+	// Distros no longer built are not in the registry, but their packages
+	// are still indexed.
+	idx := New([]storage.Object{
+		object("moby-engine/19.03.15+azure/xenial/linux_amd64/moby-engine_19.03.15+azure-1_amd64.deb"),
+		object("moby-engine/20.10.9+azure/xenial/linux_amd64/moby-engine_20.10.9+azure-1_amd64.deb"),
+		object("moby-engine/20.10.21+azure/centos7/linux_amd64/moby-engine-20.10.21+azure-3.el7.x86_64.rpm"),
+	}, Options{MinVersions: DefaultMinVersions()})
+	if len(idx.Skipped) != 0 {
+		t.Fatalf("unexpected skipped packages: %v", idx.Skipped)
+	}
+
+	var got []string
+	for _, e := range idx.Latest() {
+		got = append(got, e.Distro+" "+string(e.kind)+" "+e.Version)
+	}
+	if expected := "centos7 rpm 20.10.21-3,xenial deb 20.10.9-1"; strings.Join(got, ",") != expected {
+		t.Errorf("expected entries %s, got %s", expected, strings.Join(got, ","))
+	}
+}
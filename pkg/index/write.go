@@ -0,0 +1,161 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Write writes the index to dir, laid out as it is served:
+//
+//	latest.json                            distro -> package -> latest entries
+//	latest.rss                             the latest entries as an RSS feed
+//	distros.json                           every distro
+//	<distro>/latest.json                   package -> latest entries
+//	<distro>/packages.json                 every package
+//	<distro>/<pkg>/latest.json             the latest entry for each arch
+//	<distro>/<pkg>/latest/<arch>           the URI of the latest package
+//	<distro>/<pkg>/versions.json           every major.minor series
+//	<distro>/<pkg>/<series>/index.json     every entry in the series
+//	<distro>/<pkg>/<series>/latest.json    the latest entry in the series
+//
+// The latest/<arch> files are also written without the slash of arches such
+// as arm/v7, as latest/armv7.
+func (idx *Index) Write(dir string) error {
+	all := idx.Latest()
+	latestByDistro := byDistro(all)
+
+	if err := writeJSON(filepath.Join(dir, "latest.json"), latestByDistro); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, "latest.rss"), rss(all, idx.opts.IndexURL)); err != nil {
+		return err
+	}
+
+	distros := unique(idx.Entries, func(e Entry) string { return e.Distro })
+	if err := writeJSON(filepath.Join(dir, "distros.json"), distros); err != nil {
+		return err
+	}
+
+	for _, distro := range distros {
+		distroDir := filepath.Join(dir, distro)
+		if err := writeJSON(filepath.Join(distroDir, "latest.json"), latestByDistro[distro]); err != nil {
+			return err
+		}
+
+		entries := idx.filter(func(e Entry) bool { return e.Distro == distro })
+		pkgs := unique(entries, func(e Entry) string { return e.Name })
+		if err := writeJSON(filepath.Join(distroDir, "packages.json"), pkgs); err != nil {
+			return err
+		}
+
+		for _, pkg := range pkgs {
+			if err := idx.writePackage(filepath.Join(distroDir, pkg), distro, pkg, latestByDistro[distro][pkg]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (idx *Index) writePackage(dir, distro, pkg string, latestEntries []Entry) error {
+	if err := writeJSON(filepath.Join(dir, "latest.json"), latestEntries); err != nil {
+		return err
+	}
+
+	for _, e := range latestEntries {
+		uri := []byte(e.URI + "\n")
+		if err := writeFile(filepath.Join(dir, "latest", filepath.FromSlash(e.Arch)), uri); err != nil {
+			return err
+		}
+		if strings.Contains(e.Arch, "/") {
+			if err := writeFile(filepath.Join(dir, "latest", strings.ReplaceAll(e.Arch, "/", "")), uri); err != nil {
+				return err
+			}
+		}
+	}
+
+	entries := idx.filter(func(e Entry) bool { return e.Distro == distro && e.Name == pkg })
+	allSeries := unique(entries, func(e Entry) string { return e.series })
+	if err := writeJSON(filepath.Join(dir, "versions.json"), allSeries); err != nil {
+		return err
+	}
+
+	for _, s := range allSeries {
+		var inSeries []Entry
+		for _, e := range entries {
+			if e.series == s {
+				inSeries = append(inSeries, e)
+			}
+		}
+		if err := writeJSON(filepath.Join(dir, s, "index.json"), inSeries); err != nil {
+			return err
+		}
+		if err := writeJSON(filepath.Join(dir, s, "latest.json"), latest(inSeries)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rss renders the entries as an RSS feed, with an item per package.
+func rss(entries []Entry, indexURL string) []byte {
+	esc := func(s string) string {
+		b := new(strings.Builder)
+		xml.EscapeText(b, []byte(s))
+		return b.String()
+	}
+	indexURL = strings.TrimSuffix(indexURL, "/")
+
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, `<?xml version="1.0" encoding="utf-8" ?>
+<rss xmlns:atom="http://www.w3.org/2005/Atom" version="2.0">
+<channel>
+    <atom:link href="%s/latest.rss" rel="self" type="application/rss+xml" />
+    <link>%s/latest.json</link>
+    <title>Latest Packages</title>
+    <description>Latest Packages</description>
+`, esc(indexURL), esc(indexURL))
+
+	for _, e := range entries {
+		fmt.Fprintf(b, `
+	<item>
+		<guid>%[1]s</guid>
+		<title>%[2]s %[3]s %[4]s</title>
+		<link>%[1]s</link>
+		<description>
+			Package: %[2]s, Version: %[3]s, Architecture: %[4]s
+			SHA256 Digest: %[5]s
+			%[1]s
+		</description>
+	</item>
+`, esc(e.URI), esc(e.Name), esc(e.Version), esc(e.Arch), esc(e.Sha256))
+	}
+
+	b.WriteString("</channel>\n</rss>\n")
+	return b.Bytes()
+}
+
+// writeJSON writes v indented, as jq did when the index was generated by a
+// script, without escaping HTML characters.
+func writeJSON(p string, v interface{}) error {
+	b := new(bytes.Buffer)
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return writeFile(p, b.Bytes())
+}
+
+func writeFile(p string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o644)
+}
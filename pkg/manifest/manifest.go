@@ -0,0 +1,441 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+// Filename is the name of the manifest file in each package directory.
+const Filename = "package.json"
+
+var (
+	kinds = map[archive.PkgKind]struct{}{
+		archive.PkgKindDeb: {},
+		archive.PkgKindRPM: {},
+		archive.PkgKindWin: {},
+	}
+
+	actions = map[string]archive.PkgAction{
+		"postinstall": archive.PkgActionPostInstall,
+		"upgrade":     archive.PkgActionUpgrade,
+		"preremove":   archive.PkgActionPreRemoval,
+		"postremove":  archive.PkgActionPostRemoval,
+	}
+
+	triggers = map[string]archive.TriggerKind{
+		"install":       archive.TriggerInstall,
+		"uninstall":     archive.TriggerUninstall,
+		"postuninstall": archive.TriggerPostUninstall,
+	}
+)
+
+// Manifest is the declarative definition of a package. The top level fields
+// apply to every distro; Kinds and Distros layer overrides on top of them, in
+// that order. A list set in an override replaces the inherited list rather
+// than extending it, so `"conflicts": []` clears any inherited conflicts.
+//
+// A package is built for every known distro of each kind listed in Kinds,
+// and for the distros listed in Distros, so Distros only needs the distros
+// with overrides of their own.
+type Manifest struct {
+	Name        string                        `json:"name"`
+	Webpage     string                        `json:"webpage"`
+	Repo        string                        `json:"repo,omitempty"`
+	Description string                        `json:"description"`
+	GoVersion   string                        `json:"goVersion,omitempty"`
+	Files       []archive.File                `json:"files"`
+	Systemd     []archive.Systemd             `json:"systemd,omitempty"`
+	Binaries    []string                      `json:"binaries,omitempty"`
+	WinBinaries []string                      `json:"winBinaries,omitempty"`
+	EmbedSBOM   bool                          `json:"embedSBOM,omitempty"`
+	Kinds       map[archive.PkgKind]Overrides `json:"kinds,omitempty"`
+	Distros     map[string]Distro             `json:"distros,omitempty"`
+
+	fsys fs.FS
+	dir  string
+}
+
+// Overrides holds the per package kind and per distro settings of a package.
+type Overrides struct {
+	Description    *string           `json:"description,omitempty"`
+	Files          []archive.File    `json:"files,omitempty"`
+	Systemd        []archive.Systemd `json:"systemd,omitempty"`
+	Binaries       []string          `json:"binaries,omitempty"`
+	BuildDeps      []string          `json:"buildDeps,omitempty"`
+	RuntimeDeps    []string          `json:"runtimeDeps,omitempty"`
+	Recommends     []string          `json:"recommends,omitempty"`
+	Suggests       []string          `json:"suggests,omitempty"`
+	Conflicts      []string          `json:"conflicts,omitempty"`
+	Replaces       []string          `json:"replaces,omitempty"`
+	Provides       []string          `json:"provides,omitempty"`
+	InstallScripts []InstallScript   `json:"installScripts,omitempty"`
+	Triggers       []Trigger         `json:"triggers,omitempty"`
+}
+
+// Distro holds the overrides specific to a distro. Kind defaults to the
+// package kind of the distro.
+type Distro struct {
+	Kind archive.PkgKind `json:"kind,omitempty"`
+	// Skip excludes the distro from the distros of its kind.
+	Skip bool `json:"skip,omitempty"`
+	Overrides
+}
+
+// InstallScript refers to a maintainer script either inline or by a path
+// relative to the manifest.
+type InstallScript struct {
+	When   string `json:"when"`
+	File   string `json:"file,omitempty"`
+	Script string `json:"script,omitempty"`
+}
+
+// Trigger is an rpm trigger, see archive.Trigger.
+type Trigger struct {
+	When    string `json:"when"`
+	Package string `json:"package"`
+	File    string `json:"file,omitempty"`
+	Script  string `json:"script,omitempty"`
+}
+
+// Load reads and validates the manifest in dir. Script files referenced by
+// the manifest are resolved relative to dir within fsys.
+func Load(fsys fs.FS, dir string) (*Manifest, error) {
+	return LoadFile(fsys, dir, Filename)
+}
+
+// LoadFile is like Load for a manifest with another name than Filename, for
+// packages which select one of several manifests themselves.
+func LoadFile(fsys fs.FS, dir, name string) (*Manifest, error) {
+	filename := path.Join(dir, name)
+
+	b, err := fs.ReadFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	m.fsys = fsys
+	m.dir = dir
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return m, nil
+}
+
+// Parse decodes a manifest. Unknown fields are rejected so that typos do not
+// silently drop settings.
+func Parse(b []byte) (*Manifest, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	var m Manifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, describeJSONError(b, err)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the manifest object")
+	}
+
+	return &m, nil
+}
+
+func describeJSONError(b []byte, err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		offset    int64 = -1
+	)
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+		err = fmt.Errorf("%s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+
+	if offset < 0 || offset > int64(len(b)) {
+		return err
+	}
+
+	line := bytes.Count(b[:offset], []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(b[:offset], '\n')
+	return fmt.Errorf("line %d, column %d: %w", line, col, err)
+}
+
+// Validate checks the manifest for missing or inconsistent fields and
+// returns all the problems found rather than only the first.
+func (m *Manifest) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if m.Name == "" {
+		fail("name", "required")
+	}
+	if m.dir != "" && m.Name != "" && m.Name != path.Base(m.dir) {
+		fail("name", "%q does not match the package directory %q", m.Name, path.Base(m.dir))
+	}
+	if m.Description == "" {
+		fail("description", "required")
+	}
+
+	m.validateFiles("files", m.Files, fail)
+
+	for _, kind := range sortedKeys(m.Kinds) {
+		o := m.Kinds[kind]
+		if _, ok := kinds[kind]; !ok {
+			fail("kinds", "unknown package kind %q", kind)
+			continue
+		}
+		m.validateOverrides("kinds."+string(kind), &o, fail)
+	}
+
+	if len(m.Kinds) == 0 && len(m.Distros) == 0 {
+		fail("distros", "at least one kind or distro is required")
+	}
+	for _, name := range sortedKeys(m.Distros) {
+		d := m.Distros[name]
+		field := "distros." + name
+		known, err := archive.LookupDistro(name)
+		if err != nil {
+			fail(field, "%v", err)
+		}
+		if _, ok := kinds[d.Kind]; d.Kind != "" && !ok {
+			fail(field+".kind", "unknown package kind %q", d.Kind)
+		} else if d.Kind != "" && err == nil && d.Kind != known.Kind {
+			fail(field+".kind", "%s packages are %s, not %s", name, known.Kind, d.Kind)
+		}
+		m.validateOverrides(field, &d.Overrides, fail)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *Manifest) validateFiles(field string, files []archive.File, fail func(string, string, ...interface{})) {
+	for i, f := range files {
+		field := fmt.Sprintf("%s[%d]", field, i)
+		if f.Dest == "" {
+			fail(field+".dest", "required")
+		}
+		if f.Source == "" && !f.IsDir {
+			fail(field+".source", "required unless isDir is set")
+		}
+	}
+}
+
+func (m *Manifest) validateOverrides(field string, o *Overrides, fail func(string, string, ...interface{})) {
+	m.validateFiles(field+".files", o.Files, fail)
+
+	for i, s := range o.InstallScripts {
+		field := fmt.Sprintf("%s.installScripts[%d]", field, i)
+		if _, ok := actions[s.When]; !ok {
+			fail(field+".when", "must be one of %s, got %q", strings.Join(sortedKeys(actions), ", "), s.When)
+		}
+		if err := m.checkScript(s.File, s.Script); err != nil {
+			fail(field, "%s", err)
+		}
+	}
+
+	for i, t := range o.Triggers {
+		field := fmt.Sprintf("%s.triggers[%d]", field, i)
+		if _, ok := triggers[t.When]; !ok {
+			fail(field+".when", "must be one of %s, got %q", strings.Join(sortedKeys(triggers), ", "), t.When)
+		}
+		if t.Package == "" {
+			fail(field+".package", "required")
+		}
+		if err := m.checkScript(t.File, t.Script); err != nil {
+			fail(field, "%s", err)
+		}
+	}
+}
+
+func (m *Manifest) checkScript(file, script string) error {
+	if (file == "") == (script == "") {
+		return fmt.Errorf("exactly one of file or script must be set")
+	}
+	if file == "" || m.fsys == nil {
+		return nil
+	}
+	if _, err := fs.Stat(m.fsys, path.Join(m.dir, file)); err != nil {
+		return fmt.Errorf("script file: %w", err)
+	}
+	return nil
+}
+
+func (m *Manifest) readScript(file, script string) (string, error) {
+	if file == "" {
+		return script, nil
+	}
+	if m.fsys == nil {
+		return "", fmt.Errorf("cannot read %s: manifest was not loaded from a filesystem", file)
+	}
+	b, err := fs.ReadFile(m.fsys, path.Join(m.dir, file))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// distro returns the settings of distro, and whether the package is built
+// for it at all.
+func (m *Manifest) distro(name string) (Distro, bool) {
+	known, err := archive.LookupDistro(name)
+	if err != nil {
+		return Distro{}, false
+	}
+
+	d, ok := m.Distros[name]
+	if d.Kind == "" {
+		d.Kind = known.Kind
+	}
+	if !ok {
+		_, ok = m.Kinds[d.Kind]
+	}
+	return d, ok && !d.Skip
+}
+
+// distroNames returns the names of every distro the package is built for.
+func (m *Manifest) distroNames() []string {
+	var names []string
+	for _, d := range archive.Distros() {
+		if _, ok := m.distro(d.Name); ok {
+			names = append(names, d.Name)
+		}
+	}
+	return names
+}
+
+// Archive returns the archive definition for a single distro.
+func (m *Manifest) Archive(distro string) (archive.Archive, error) {
+	d, ok := m.distro(distro)
+	if !ok {
+		return archive.Archive{}, fmt.Errorf("%s: unsupported distro: %s", m.Name, distro)
+	}
+
+	a := archive.Archive{
+		Name:        m.Name,
+		Webpage:     m.Webpage,
+		Files:       m.Files,
+		Systemd:     m.Systemd,
+		Binaries:    m.Binaries,
+		WinBinaries: m.WinBinaries,
+		Description: m.Description,
+		EmbedSBOM:   m.EmbedSBOM,
+	}
+
+	if o, ok := m.Kinds[d.Kind]; ok {
+		if err := m.apply(&a, &o); err != nil {
+			return archive.Archive{}, err
+		}
+	}
+
+	if err := m.apply(&a, &d.Overrides); err != nil {
+		return archive.Archive{}, err
+	}
+
+	return a, nil
+}
+
+// Archives returns the archive definitions for every distro the package is
+// built for, keyed by distro.
+func (m *Manifest) Archives() (map[string]archive.Archive, error) {
+	names := m.distroNames()
+	archives := make(map[string]archive.Archive, len(names))
+	for _, distro := range names {
+		a, err := m.Archive(distro)
+		if err != nil {
+			return nil, err
+		}
+		archives[distro] = a
+	}
+	return archives, nil
+}
+
+// PkgKind returns the kind of package built for distro.
+func (m *Manifest) PkgKind(distro string) (archive.PkgKind, bool) {
+	d, ok := m.distro(distro)
+	return d.Kind, ok
+}
+
+func (m *Manifest) apply(a *archive.Archive, o *Overrides) error {
+	if o.Description != nil {
+		a.Description = *o.Description
+	}
+
+	for _, f := range []struct {
+		dst *[]string
+		src []string
+	}{
+		{&a.Binaries, o.Binaries},
+		{&a.BuildDeps, o.BuildDeps},
+		{&a.RuntimeDeps, o.RuntimeDeps},
+		{&a.Recommends, o.Recommends},
+		{&a.Suggests, o.Suggests},
+		{&a.Conflicts, o.Conflicts},
+		{&a.Replaces, o.Replaces},
+		{&a.Provides, o.Provides},
+	} {
+		if f.src != nil {
+			*f.dst = f.src
+		}
+	}
+
+	if o.Files != nil {
+		a.Files = o.Files
+	}
+	if o.Systemd != nil {
+		a.Systemd = o.Systemd
+	}
+
+	if o.InstallScripts != nil {
+		a.InstallScripts = make([]archive.InstallScript, 0, len(o.InstallScripts))
+		for _, s := range o.InstallScripts {
+			body, err := m.readScript(s.File, s.Script)
+			if err != nil {
+				return err
+			}
+			a.InstallScripts = append(a.InstallScripts, archive.InstallScript{When: actions[s.When], Script: body})
+		}
+	}
+
+	if o.Triggers != nil {
+		a.Triggers = make([]archive.Trigger, 0, len(o.Triggers))
+		for _, t := range o.Triggers {
+			body, err := m.readScript(t.File, t.Script)
+			if err != nil {
+				return err
+			}
+			a.Triggers = append(a.Triggers, archive.Trigger{When: triggers[t.When], Package: t.Package, Script: body})
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys[K ~string, T any](m map[K]T) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,161 @@
+package manifest_test
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Azure/moby-packaging/packages"
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/manifest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"moby-foo/package.json": {Data: []byte(`{
+	"name": "moby-foo",
+	"webpage": "https://example.com",
+	"description": "foo",
+	"files": [{"source": "/build/src/foo", "dest": "/usr/bin/foo"}],
+	"kinds": {
+		"rpm": {
+			"runtimeDeps": ["bash"],
+			"installScripts": [{"when": "postinstall", "file": "postinstall/rpm"}]
+		}
+	},
+	"distros": {
+		"jammy": {"kind": "deb"},
+		"rhel9": {"kind": "rpm"},
+		"mariner2": {"runtimeDeps": []},
+		"rhel8": {"skip": true}
+	}
+}`)},
+		"moby-foo/postinstall/rpm": {Data: []byte("echo hi\n")},
+	}
+
+	m, err := manifest.Load(fsys, "moby-foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := m.Archives()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a := archives["jammy"]; a.Name != "moby-foo" || len(a.Files) != 1 || a.RuntimeDeps != nil {
+		t.Errorf("unexpected jammy archive: %+v", a)
+	}
+
+	rhel := archives["rhel9"]
+	if len(rhel.RuntimeDeps) != 1 || len(rhel.InstallScripts) != 1 || rhel.InstallScripts[0].Script != "echo hi\n" {
+		t.Errorf("unexpected rhel9 archive: %+v", rhel)
+	}
+	if rhel.InstallScripts[0].When != archive.PkgActionPostInstall {
+		t.Errorf("unexpected script action: %d", rhel.InstallScripts[0].When)
+	}
+
+	if deps := archives["mariner2"].RuntimeDeps; deps == nil || len(deps) != 0 {
+		t.Errorf("expected distro override to clear runtime deps, got %v", deps)
+	}
+
+	// Distros of the kinds listed are built unless skipped, other distros
+	// only if they are listed.
+	for distro, want := range map[string]bool{"rhel8": false, "focal": false, "windows": false} {
+		if _, ok := archives[distro]; ok != want {
+			t.Errorf("%s: expected built to be %v", distro, want)
+		}
+	}
+	if kind, ok := m.PkgKind("mariner2"); !ok || kind != archive.PkgKindRPM {
+		t.Errorf("expected mariner2 to default to rpm, got %q", kind)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		manifest string
+		errs     []string
+	}{
+		"syntax": {
+			manifest: "{\n  \"name\": \"moby-foo\",\n  \"distros\": {,}\n}",
+			errs:     []string{"line 3"},
+		},
+		"unknown field": {
+			manifest: `{"name": "moby-foo", "dependencies": []}`,
+			errs:     []string{`unknown field "dependencies"`},
+		},
+		"invalid": {
+			manifest: `{
+				"name": "moby-bar",
+				"files": [{"dest": "/usr/bin/foo"}],
+				"distros": {
+					"jammy": {"kind": "dpkg"},
+					"focal": {"kind": "rpm"},
+					"hardy": {"kind": "deb"},
+					"rhel9": {"kind": "rpm", "installScripts": [{"when": "later", "file": "missing"}]}
+				}
+			}`,
+			errs: []string{
+				`name: "moby-bar" does not match`,
+				"description: required",
+				"files[0].source: required",
+				`distros.jammy.kind: unknown package kind "dpkg"`,
+				"distros.rhel9.installScripts[0].when",
+				"distros.rhel9.installScripts[0]: script file",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fsys := fstest.MapFS{"moby-foo/package.json": {Data: []byte(tc.manifest)}}
+
+			_, err := manifest.Load(fsys, "moby-foo")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, e := range tc.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("expected error to contain %q, got:\n%s", e, err)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedManifests(t *testing.T) {
+	files, err := fs.Glob(packages.FS, "*/package*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no manifests found")
+	}
+
+	for _, f := range files {
+		m, err := manifest.LoadFile(packages.FS, path.Dir(f), path.Base(f))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		archives, err := m.Archives()
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		for _, distro := range []string{"jammy", "rhel9", "mariner2", "windows"} {
+			if _, ok := archives[distro]; !ok {
+				t.Errorf("%s: missing archive for %s", f, distro)
+			}
+		}
+	}
+
+	m, err := packages.Manifest("moby-containerd-shim-systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.PkgKind("noble"); ok {
+		t.Error("expected moby-containerd-shim-systemd not to be built for noble")
+	}
+}
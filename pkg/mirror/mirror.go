@@ -0,0 +1,13 @@
+package mirror
+
+import "os"
+
+// Prefix returns the registry prefix that base images are pulled from. It can
+// be overridden with the MIRROR_PREFIX environment variable.
+func Prefix() string {
+	prefix, ok := os.LookupEnv("MIRROR_PREFIX")
+	if !ok {
+		prefix = "mcr.microsoft.com/mirror/docker/library"
+	}
+	return prefix
+}
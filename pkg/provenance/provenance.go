@@ -0,0 +1,244 @@
+// Package provenance produces in-toto statements carrying SLSA v1 build
+// provenance for the packages we build.
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+const (
+	StatementType = "https://in-toto.io/Statement/v1"
+	PredicateType = "https://slsa.dev/provenance/v1"
+	BuildType     = "https://github.com/Azure/moby-packaging/build/v1"
+	BuilderID     = "https://github.com/Azure/moby-packaging"
+
+	// Extension is appended to the filename of a package to get the
+	// filename of its provenance.
+	Extension = ".intoto.json"
+)
+
+type Statement struct {
+	Type          string     `json:"_type"`
+	Subject       []Subject  `json:"subject"`
+	PredicateType string     `json:"predicateType"`
+	Predicate     Provenance `json:"predicate"`
+}
+
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   ExternalParameters   `json:"externalParameters"`
+	InternalParameters   InternalParameters   `json:"internalParameters"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies"`
+}
+
+// ExternalParameters are the inputs of the build which are under the control
+// of whoever requested it.
+type ExternalParameters struct {
+	Spec archive.Spec `json:"spec"`
+}
+
+// InternalParameters are the inputs of the build which are chosen by
+// moby-packaging itself.
+type InternalParameters struct {
+	GoVersion string `json:"goVersion"`
+}
+
+type ResourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+type RunDetails struct {
+	Builder  Builder  `json:"builder"`
+	Metadata Metadata `json:"metadata"`
+}
+
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+type Metadata struct {
+	StartedOn  time.Time `json:"startedOn"`
+	FinishedOn time.Time `json:"finishedOn"`
+}
+
+// Build describes how a set of packages was produced.
+type Build struct {
+	Spec      archive.Spec
+	GoVersion string
+	// Images are the container images the build ran in, including the
+	// image the Go toolchain was taken from. Refs should be resolved to a
+	// digest.
+	Images []string
+	// Patches are the paths (relative to the package directory) and
+	// contents of the patches applied to the source, in order.
+	Patches []Patch
+
+	StartedOn  time.Time
+	FinishedOn time.Time
+}
+
+type Patch struct {
+	Name string
+	Data []byte
+}
+
+// Statement returns the provenance statement for a package with the given
+// filename and sha256 digest.
+func (b *Build) Statement(name, sha256sum string) *Statement {
+	deps := []ResourceDescriptor{{
+		URI:    "git+" + b.Spec.Repo + "@" + b.Spec.Commit,
+		Digest: map[string]string{"gitCommit": b.Spec.Commit},
+	}}
+
+	for _, ref := range b.Images {
+		d := ResourceDescriptor{URI: "oci://" + ref}
+		if _, digest, ok := cutDigest(ref); ok {
+			d.Digest = map[string]string{"sha256": digest}
+		}
+		deps = append(deps, d)
+	}
+
+	for _, p := range b.Patches {
+		deps = append(deps, ResourceDescriptor{
+			Name:   p.Name,
+			Digest: map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256(p.Data))},
+		})
+	}
+
+	return &Statement{
+		Type:          StatementType,
+		Subject:       []Subject{{Name: name, Digest: map[string]string{"sha256": sha256sum}}},
+		PredicateType: PredicateType,
+		Predicate: Provenance{
+			BuildDefinition: BuildDefinition{
+				BuildType:            BuildType,
+				ExternalParameters:   ExternalParameters{Spec: b.Spec},
+				InternalParameters:   InternalParameters{GoVersion: b.GoVersion},
+				ResolvedDependencies: deps,
+			},
+			RunDetails: RunDetails{
+				Builder:  Builder{ID: BuilderID, Version: builderVersion()},
+				Metadata: Metadata{StartedOn: b.StartedOn.UTC(), FinishedOn: b.FinishedOn.UTC()},
+			},
+		},
+	}
+}
+
+// WriteFiles writes a provenance statement next to every package in dir, and
+// returns the paths of the files written.
+func (b *Build) WriteFiles(dir string) ([]string, error) {
+	var written []string
+
+	for _, pattern := range []string{"*.deb", "*.rpm", "*.zip"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pkg := range matches {
+			sum, err := fileSha256(pkg)
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := json.MarshalIndent(b.Statement(filepath.Base(pkg), sum), "", "  ")
+			if err != nil {
+				return nil, err
+			}
+
+			filename := pkg + Extension
+			if err := os.WriteFile(filename, append(out, '\n'), 0o644); err != nil {
+				return nil, err
+			}
+			written = append(written, filename)
+		}
+	}
+
+	return written, nil
+}
+
+// CheckSubject checks that the provenance written next to the package at pkg
+// by WriteFiles describes that package: that its subject has the name and
+// sha256 digest of the package.
+func CheckSubject(pkg string) error {
+	b, err := os.ReadFile(pkg + Extension)
+	if err != nil {
+		return err
+	}
+	var st Statement
+	if err := json.Unmarshal(b, &st); err != nil {
+		return fmt.Errorf("error reading provenance of %s: %w", pkg, err)
+	}
+
+	sum, err := fileSha256(pkg)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(pkg)
+	for _, s := range st.Subject {
+		if s.Name == name && s.Digest["sha256"] == sum {
+			return nil
+		}
+	}
+	return fmt.Errorf("provenance of %s does not have it as subject with sha256 %s", pkg, sum)
+}
+
+func fileSha256(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// cutDigest splits an image ref of the form name@sha256:digest.
+func cutDigest(ref string) (string, string, bool) {
+	i := strings.LastIndex(ref, "@")
+	if i < 0 {
+		return "", "", false
+	}
+	digest, ok := strings.CutPrefix(ref[i+1:], "sha256:")
+	return ref[:i], digest, ok
+}
+
+func builderVersion() map[string]string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return map[string]string{"moby-packaging": s.Value}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	pkg := filepath.Join(dir, "moby-runc_1.1.12-ubuntu22.04u1_amd64.deb")
+	if err := os.WriteFile(pkg, []byte("package"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Build{
+		Spec:      archive.Spec{Pkg: "moby-runc", Distro: "jammy", Arch: "amd64", Repo: "https://github.com/opencontainers/runc.git", Commit: "abc123", Tag: "1.1.12", Revision: "1"},
+		GoVersion: "1.24.9",
+		Images:    []string{"mcr.microsoft.com/mirror/docker/library/buildpack-deps:jammy@sha256:0123", "golang:1.24.9"},
+		Patches:   []Patch{{Name: "patches/0001-fix.patch", Data: []byte("diff")}},
+	}
+
+	written, err := b.WriteFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || written[0] != pkg+Extension {
+		t.Fatalf("unexpected files written: %v", written)
+	}
+
+	data, err := os.ReadFile(written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Statement
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.Subject[0].Digest["sha256"], fmt.Sprintf("%x", sha256.Sum256([]byte("package"))); got != want {
+		t.Errorf("unexpected subject digest: %s", got)
+	}
+	if s.PredicateType != PredicateType || s.Predicate.BuildDefinition.ExternalParameters.Spec.Commit != "abc123" {
+		t.Errorf("unexpected statement: %+v", s)
+	}
+
+	deps := s.Predicate.BuildDefinition.ResolvedDependencies
+	if len(deps) != 4 {
+		t.Fatalf("expected source, two images and a patch, got %+v", deps)
+	}
+	if deps[0].Digest["gitCommit"] != "abc123" || deps[1].Digest["sha256"] != "0123" || deps[2].Digest != nil || deps[3].Name != "patches/0001-fix.patch" {
+		t.Errorf("unexpected dependencies: %+v", deps)
+	}
+}
+
+func TestCheckSubject(t *testing.T) {
+	dir := t.TempDir()
+	pkg := filepath.Join(dir, "moby-runc_1.1.12-ubuntu22.04u1_amd64.deb")
+	if err := os.WriteFile(pkg, []byte("package"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Build{Spec: archive.Spec{Pkg: "moby-runc", Distro: "jammy", Arch: "amd64", Tag: "1.1.12", Revision: "1"}}
+	if _, err := b.WriteFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSubject(pkg); err != nil {
+		t.Error(err)
+	}
+
+	if err := os.WriteFile(pkg, []byte("signed package"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSubject(pkg); err == nil {
+		t.Error("expected an error for a changed package")
+	}
+}
@@ -0,0 +1,76 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// download writes what is at uri, an http, https or file URI, to dest.
+func (w *Worker) download(ctx context.Context, uri, dest string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return permanent(err)
+	}
+
+	var body io.ReadCloser
+	switch u.Scheme {
+	case "file":
+		body, err = os.Open(u.Path)
+		if err != nil {
+			return err
+		}
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return permanent(err)
+		}
+		client := w.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("error downloading %s: %s", uri, resp.Status)
+		}
+		body = resp.Body
+	default:
+		return permanent(fmt.Errorf("cannot download %s: unsupported scheme", uri))
+	}
+	defer body.Close()
+
+	return writeFile(dest, body)
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dest, in)
+}
+
+func writeFile(dest string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	return f.Close()
+}
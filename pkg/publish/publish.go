@@ -0,0 +1,365 @@
+// Package publish signs and publishes the packages of builds announced on a
+// queue. A build enqueues a message for each package it built, giving where
+// to download it from and its sha256 sum; a Worker dequeues the messages,
+// signs each package and uploads it, with its provenance, to release storage.
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/provenance"
+	"github.com/Azure/moby-packaging/pkg/queue"
+	"github.com/Azure/moby-packaging/pkg/sign"
+	"github.com/Azure/moby-packaging/pkg/storage"
+)
+
+const (
+	// DefaultVisibility is how long a message is hidden from other workers
+	// at a time while it is handled. It is renewed until the message is
+	// handled.
+	DefaultVisibility = 5 * time.Minute
+	// DefaultMaxDequeueCount is how many times a message is tried before
+	// it is given up on as a poison message.
+	DefaultMaxDequeueCount = 5
+	// DefaultPollInterval is how long to wait before polling an empty
+	// queue again.
+	DefaultPollInterval = 30 * time.Second
+)
+
+// NewMessage returns the message announcing the package of spec, built at p
+// and downloadable from uri. The package's provenance must be downloadable
+// from uri + provenance.Extension.
+func NewMessage(spec archive.Spec, p, uri string) (queue.Message, error) {
+	sum, _, err := storage.HashFile(p)
+	if err != nil {
+		return queue.Message{}, err
+	}
+	return queue.Message{
+		Artifact: queue.ArtifactInfo{Name: filepath.Base(p), URI: uri, Sha256Sum: sum},
+		Spec:     spec,
+	}, nil
+}
+
+// Worker handles the messages in a queue, one at a time.
+type Worker struct {
+	Queue queue.Queue
+	// Poison receives the messages which cannot be handled, to be looked
+	// into. If it is nil, they are only reported.
+	Poison queue.Queue
+	// Index, if set, is the index the messages were enqueued with by
+	// queue.EnqueueOnce. A build is removed from it once its message is
+	// deleted, so that it can be enqueued again.
+	Index   queue.Index
+	Backend storage.Backend
+	// Sign signs the packages. Before uploading, the signatures are
+	// checked with Sign.Verifier, or for windows zips with the Verify
+	// command of Sign.Authenticode, if they are set.
+	Sign sign.Options
+	// Client downloads packages from http and https URIs. It defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	Visibility      time.Duration
+	MaxDequeueCount int64
+	PollInterval    time.Duration
+	// Retries and RetryDelay are passed to storage.PutFile.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Logf reports progress and errors. It defaults to printing to stderr.
+	Logf func(format string, args ...interface{})
+}
+
+// Run handles messages until ctx is done.
+func (w *Worker) Run(ctx context.Context) error {
+	for {
+		n, err := w.Poll(ctx)
+		if err != nil {
+			w.logf("##vso[task.logissue type=error;]%s", err)
+		}
+		if n > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.pollInterval()):
+		}
+	}
+}
+
+// Poll dequeues and handles a message, if there is one visible, and returns
+// how many were dequeued. A message which fails to be handled is left in
+// the queue, to be retried once it is visible again, unless it is poison.
+func (w *Worker) Poll(ctx context.Context) (int, error) {
+	msgs, err := w.Queue.Dequeue(ctx, 1, w.visibility())
+	if err != nil {
+		return 0, fmt.Errorf("error dequeuing from %s: %w", w.Queue, err)
+	}
+
+	var errs []error
+	for _, r := range msgs {
+		if err := w.handle(ctx, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(msgs), errors.Join(errs...)
+}
+
+func (w *Worker) handle(ctx context.Context, r *queue.Received) error {
+	m, err := r.Message()
+	if err != nil {
+		return w.poison(ctx, r, nil, err)
+	}
+	if r.DequeueCount > w.maxDequeueCount() {
+		return w.poison(ctx, r, m, fmt.Errorf("%s: gave up after %d attempts", m.Artifact.Name, r.DequeueCount-1))
+	}
+
+	stop := w.keepHidden(ctx, r)
+	err = w.publish(ctx, m)
+	stop()
+
+	if err != nil {
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return w.poison(ctx, r, m, fmt.Errorf("%s: %w", m.Artifact.Name, err))
+		}
+		return fmt.Errorf("error publishing %s, attempt %d of %d: %w", m.Artifact.Name, r.DequeueCount, w.maxDequeueCount(), err)
+	}
+	if err := w.Queue.Delete(ctx, r); err != nil {
+		return fmt.Errorf("%s was published, but its message could not be deleted: %w", m.Artifact.Name, err)
+	}
+	return w.forget(ctx, m)
+}
+
+// poison moves a message which cannot be handled to the poison queue. m is
+// the decoded message, or nil if it cannot be decoded.
+func (w *Worker) poison(ctx context.Context, r *queue.Received, m *queue.Message, reason error) error {
+	if w.Poison != nil {
+		if err := w.Poison.Enqueue(ctx, r.Body); err != nil {
+			return fmt.Errorf("error moving message %s to %s: %w (poison because: %v)", r.ID, w.Poison, err, reason)
+		}
+	}
+	if err := w.Queue.Delete(ctx, r); err != nil {
+		return fmt.Errorf("error deleting poison message %s: %w (poison because: %v)", r.ID, err, reason)
+	}
+	if m != nil {
+		if err := w.forget(ctx, m); err != nil {
+			reason = errors.Join(reason, err)
+		}
+	}
+	if w.Poison != nil {
+		return fmt.Errorf("message %s moved to %s: %w", r.ID, w.Poison, reason)
+	}
+	return fmt.Errorf("message %s dropped: %w", r.ID, reason)
+}
+
+// forget removes the build of a deleted message from the index.
+func (w *Worker) forget(ctx context.Context, m *queue.Message) error {
+	if w.Index == nil {
+		return nil
+	}
+	if err := w.Index.Remove(ctx, queue.SpecKey(m.Spec)); err != nil {
+		return fmt.Errorf("error removing %s from the index: %w", m.Artifact.Name, err)
+	}
+	return nil
+}
+
+// keepHidden renews the visibility of r until the returned function is
+// called, so that no other worker handles the message meanwhile, however
+// long it takes.
+func (w *Worker) keepHidden(ctx context.Context, r *queue.Received) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(w.visibility() / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := w.Queue.Renew(ctx, r, w.visibility()); err != nil && ctx.Err() == nil {
+					w.logf("##vso[task.logissue type=warning;]error renewing message %s: %s", r.ID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// publish downloads, signs and uploads the package announced by m.
+func (w *Worker) publish(ctx context.Context, m *queue.Message) error {
+	name, err := m.Spec.Basename()
+	if err != nil {
+		return permanent(err)
+	}
+	if m.Artifact.Name != name {
+		return permanent(fmt.Errorf("artifact name does not match the spec, expected %s", name))
+	}
+	storagePath, err := m.Spec.StoragePath()
+	if err != nil {
+		return permanent(err)
+	}
+
+	dir, err := os.MkdirTemp("", "publish")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	unsigned := filepath.Join(dir, "unsigned", name)
+	if err := w.download(ctx, m.Artifact.URI, unsigned); err != nil {
+		return err
+	}
+	sum, _, err := storage.HashFile(unsigned)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, m.Artifact.Sha256Sum) {
+		return permanent(fmt.Errorf("downloaded %s with sha256 %s, expected %s", m.Artifact.URI, sum, m.Artifact.Sha256Sum))
+	}
+	if err := w.download(ctx, m.Artifact.URI+provenance.Extension, unsigned+provenance.Extension); err != nil {
+		return err
+	}
+	if err := provenance.CheckSubject(unsigned); err != nil {
+		return permanent(err)
+	}
+
+	provSum, provSize, err := storage.HashFile(unsigned + provenance.Extension)
+	if err != nil {
+		return err
+	}
+	if done, err := w.published(ctx, storagePath, provSum); err != nil || done {
+		return err
+	}
+
+	signed := filepath.Join(dir, "signed", name)
+	if err := copyFile(unsigned, signed); err != nil {
+		return err
+	}
+	if err := sign.SignPackage(signed, w.Sign); err != nil {
+		return err
+	}
+	if err := sign.CompareSigned(unsigned, signed); err != nil {
+		return permanent(err)
+	}
+	if w.verifies(signed) {
+		if err := sign.VerifyPackage(signed, w.Sign); err != nil {
+			return permanent(err)
+		}
+	}
+
+	pkgSum, pkgSize, err := storage.HashFile(signed)
+	if err != nil {
+		return err
+	}
+	// The provenance is uploaded last, marking the package as published.
+	// Until then, a package stored by an earlier attempt is replaced: it
+	// was signed again, so its sha256 differs.
+	if err := w.upload(ctx, storagePath, signed, pkgSum, pkgSize); err != nil {
+		return err
+	}
+	if err := w.upload(ctx, storagePath+provenance.Extension, unsigned+provenance.Extension, provSum, provSize); err != nil {
+		return err
+	}
+	w.logf("published %s to %s", storagePath, w.Backend)
+	return nil
+}
+
+// published reports whether the package at storagePath was published by an
+// earlier attempt, with the provenance with sha256 provSum.
+func (w *Worker) published(ctx context.Context, storagePath, provSum string) (bool, error) {
+	props, err := w.Backend.Stat(ctx, storagePath+provenance.Extension)
+	if errors.Is(err, storage.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if stored := props.Metadata[storage.Sha256Key]; stored != provSum {
+		return false, permanent(fmt.Errorf("%s: %w: stored %q, have %s", storagePath+provenance.Extension, storage.ErrConflict, stored, provSum))
+	}
+
+	if _, err := w.Backend.Stat(ctx, storagePath); err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	w.logf("%s is already published, skipping", storagePath)
+	return true, nil
+}
+
+func (w *Worker) upload(ctx context.Context, name, p, sum string, size int64) error {
+	opts := storage.UploadOptions{Retries: w.Retries, RetryDelay: w.RetryDelay}
+	if err := storage.PutFile(ctx, w.Backend, name, p, sum, opts); err != nil {
+		return err
+	}
+	return storage.Verify(ctx, w.Backend, name, sum, size)
+}
+
+// verifies reports whether the signature of the package at p is checked.
+func (w *Worker) verifies(p string) bool {
+	if filepath.Ext(p) == ".zip" {
+		return w.Sign.Authenticode != nil && len(w.Sign.Authenticode.Verify) > 0
+	}
+	return w.Sign.Verifier != nil
+}
+
+func (w *Worker) visibility() time.Duration {
+	if w.Visibility <= 0 {
+		return DefaultVisibility
+	}
+	return w.Visibility
+}
+
+func (w *Worker) maxDequeueCount() int64 {
+	if w.MaxDequeueCount <= 0 {
+		return DefaultMaxDequeueCount
+	}
+	return w.MaxDequeueCount
+}
+
+func (w *Worker) pollInterval() time.Duration {
+	if w.PollInterval <= 0 {
+		return DefaultPollInterval
+	}
+	return w.PollInterval
+}
+
+func (w *Worker) logf(format string, args ...interface{}) {
+	if w.Logf != nil {
+		w.Logf(format, args...)
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// permanentError is an error which trying again will not fix, so the message
+// is poison.
+type permanentError struct {
+	err error
+}
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
@@ -0,0 +1,248 @@
+package publish
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/provenance"
+	"github.com/Azure/moby-packaging/pkg/queue"
+	"github.com/Azure/moby-packaging/pkg/sign"
+	"github.com/Azure/moby-packaging/pkg/storage"
+)
+
+var testSpec = archive.Spec{Pkg: "moby-runc", Tag: "1.1.12", Revision: "1", Distro: "jammy", Arch: "amd64"}
+
+// buildPackage writes the package of testSpec and its provenance in a bundle
+// dir, and returns the path of the package relative to it.
+func buildPackage(t *testing.T, bundleDir string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr/bin/runc"), []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := testSpec.FullPath(bundleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := (&archive.DebWriter{
+		Control: "Package: moby-runc\nVersion: 1.1.12-ubuntu22.04u1\nArchitecture: amd64\nDescription: runc\n",
+		ModTime: time.Unix(1700000000, 0),
+	}).Write(f, root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&provenance.Build{Spec: testSpec}).WriteFiles(filepath.Dir(p)); err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := filepath.Rel(bundleDir, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.ToSlash(rel)
+}
+
+type testEnv struct {
+	worker *Worker
+	queue  *queue.Memory
+	poison *queue.Memory
+	msg    queue.Message
+	srv    *httptest.Server
+	// onRequest is called before serving a request, if set.
+	onRequest func(r *http.Request)
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	bundleDir := t.TempDir()
+	rel := buildPackage(t, bundleDir)
+
+	env := &testEnv{queue: queue.NewMemory("signing"), poison: queue.NewMemory("signing-poison")}
+	files := http.FileServer(http.Dir(bundleDir))
+	env.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if env.onRequest != nil {
+			env.onRequest(r)
+		}
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(env.srv.Close)
+
+	msg, err := NewMessage(testSpec, filepath.Join(bundleDir, rel), env.srv.URL+"/"+rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.msg = msg
+
+	k, err := sign.GenerateFileKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, err := storage.NewLocalDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.worker = &Worker{
+		Queue:   env.queue,
+		Poison:  env.poison,
+		Index:   queue.NewMemoryIndex(),
+		Backend: backend,
+		Sign:    sign.Options{Signer: k, Verifier: k},
+		Logf:    t.Logf,
+	}
+	return env
+}
+
+// enqueue adds m to the queue. Its build must not have a message already:
+// the worker removes them from the index once handled.
+func (env *testEnv) enqueue(t *testing.T, m queue.Message) {
+	t.Helper()
+	added, err := queue.EnqueueOnce(context.Background(), env.queue, env.worker.Index, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !added {
+		t.Fatal("build already in the index")
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.enqueue(t, env.msg)
+
+	if n, err := env.worker.Poll(ctx); n != 1 || err != nil {
+		t.Fatalf("expected a message to be handled, got %d: %v", n, err)
+	}
+	if env.queue.Len() != 0 || env.poison.Len() != 0 {
+		t.Fatalf("expected the message to be deleted, %d left, %d poison", env.queue.Len(), env.poison.Len())
+	}
+
+	storagePath, err := testSpec.StoragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{storagePath, storagePath + provenance.Extension} {
+		if _, err := env.worker.Backend.Stat(ctx, name); err != nil {
+			t.Errorf("expected %s to be stored: %v", name, err)
+		}
+	}
+	stored := filepath.Join(env.worker.Backend.String(), storagePath)
+	if err := sign.VerifyPackage(stored, env.worker.Sign); err != nil {
+		t.Error(err)
+	}
+
+	// Publishing again is a no-op.
+	env.enqueue(t, env.msg)
+	if n, err := env.worker.Poll(ctx); n != 1 || err != nil {
+		t.Fatalf("expected a message to be handled, got %d: %v", n, err)
+	}
+	if env.queue.Len() != 0 || env.poison.Len() != 0 {
+		t.Fatalf("expected the message to be deleted, %d left, %d poison", env.queue.Len(), env.poison.Len())
+	}
+
+	if n, err := env.worker.Poll(ctx); n != 0 || err != nil {
+		t.Fatalf("expected an empty queue, got %d: %v", n, err)
+	}
+}
+
+func TestPoison(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	bad := env.msg
+	bad.Artifact.Sha256Sum = strings.Repeat("0", 64)
+	env.enqueue(t, bad)
+	if err := env.queue.Enqueue(ctx, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if n, err := env.worker.Poll(ctx); n != 1 || err == nil {
+			t.Fatalf("expected a message to fail, got %d: %v", n, err)
+		}
+	}
+	if env.queue.Len() != 0 || env.poison.Len() != 2 {
+		t.Fatalf("expected the messages to be poison, %d left, %d poison", env.queue.Len(), env.poison.Len())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.worker.Visibility = 20 * time.Millisecond
+	env.worker.MaxDequeueCount = 2
+
+	missing := env.msg
+	missing.Artifact.URI = env.srv.URL + "/missing.deb"
+	env.enqueue(t, missing)
+
+	// Failures are retried once the message is visible again, until it has
+	// been tried MaxDequeueCount times.
+	for i := 0; i < 2; i++ {
+		if n, err := env.worker.Poll(ctx); n != 1 || err == nil {
+			t.Fatalf("expected a message to fail, got %d: %v", n, err)
+		}
+		if env.queue.Len() != 1 {
+			t.Fatal("expected the message to be left in the queue")
+		}
+		if n, _ := env.worker.Poll(ctx); n != 0 {
+			t.Fatal("expected the message to be hidden")
+		}
+		time.Sleep(2 * env.worker.Visibility)
+	}
+
+	if n, err := env.worker.Poll(ctx); n != 1 || err == nil {
+		t.Fatalf("expected a message to fail, got %d: %v", n, err)
+	}
+	if env.queue.Len() != 0 || env.poison.Len() != 1 {
+		t.Fatalf("expected the message to be poison, %d left, %d poison", env.queue.Len(), env.poison.Len())
+	}
+}
+
+func TestRenew(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.worker.Visibility = 20 * time.Millisecond
+	env.enqueue(t, env.msg)
+
+	// The download takes several times the visibility timeout, during which
+	// the message stays hidden.
+	var once sync.Once
+	env.onRequest = func(*http.Request) {
+		once.Do(func() {
+			time.Sleep(5 * env.worker.Visibility)
+			msgs, err := env.queue.Dequeue(ctx, 1, time.Minute)
+			if err != nil || len(msgs) != 0 {
+				t.Errorf("expected the message to stay hidden, got %d: %v", len(msgs), err)
+			}
+		})
+	}
+
+	if n, err := env.worker.Poll(ctx); n != 1 || err != nil {
+		t.Fatalf("expected a message to be handled, got %d: %v", n, err)
+	}
+	if env.queue.Len() != 0 {
+		t.Fatal("expected the message to be deleted")
+	}
+}
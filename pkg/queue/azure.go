@@ -0,0 +1,202 @@
+package queue
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue/queueerror"
+)
+
+const (
+	DefaultAccountName = "moby"
+	DefaultQueueName   = "moby-packaging-signing-and-publishing"
+
+	// AzuriteConnectionString connects to the queue and blob services of
+	// Azurite, the Azure storage emulator, on their default ports with its
+	// well-known development account. "UseDevelopmentStorage=true" is short for it.
+	AzuriteConnectionString = "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;" +
+		"AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==;" +
+		"BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;QueueEndpoint=http://127.0.0.1:10001/devstoreaccount1;"
+
+	// Azure storage returns at most 32 messages per request.
+	azureMaxMessages = 32
+)
+
+// Client is a Queue backed by an Azure storage queue. Message bodies are
+// stored base64 encoded.
+type Client struct {
+	c *azqueue.QueueClient
+}
+
+// AzureOptions configures how to connect to an Azure storage queue.
+type AzureOptions struct {
+	// ConnectionString, if set, connects with the account name and key or
+	// the SAS in it rather than the default Azure credential chain, e.g.
+	// to Azurite.
+	ConnectionString string
+	// Endpoint overrides the URL of the queue service of the account,
+	// https://<account>.queue.core.windows.net.
+	Endpoint string
+	// BlobEndpoint overrides the URL of the blob service of the account,
+	// https://<account>.blob.core.windows.net, for a BlobIndex.
+	BlobEndpoint string
+}
+
+func NewDefaultSignQueueClient() (*Client, error) {
+	return NewClient(DefaultAccountName, DefaultQueueName)
+}
+
+// NewClient returns the queue in the storage account, authenticated with the
+// default Azure credential chain.
+func NewClient(accountName, queueName string) (*Client, error) {
+	return NewAzureQueue(accountName, queueName, AzureOptions{})
+}
+
+// NewAzureQueue returns the queue in the storage account, connected to as
+// configured by opts. The account name is ignored when connecting with a
+// connection string.
+func NewAzureQueue(accountName, queueName string, opts AzureOptions) (*Client, error) {
+	if opts.ConnectionString != "" {
+		c, err := azqueue.NewQueueClientFromConnectionString(connectionString(opts.ConnectionString), queueName, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Client{c: c}, nil
+	}
+
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceURL := opts.Endpoint
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.queue.core.windows.net", accountName)
+	}
+	sClient, err := azqueue.NewServiceClient(serviceURL, credential, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{c: sClient.NewQueueClient(queueName)}, nil
+}
+
+// Create creates the queue if it does not exist yet.
+func (c *Client) Create(ctx context.Context) error {
+	_, err := c.c.Create(ctx, nil)
+	if queueerror.HasCode(err, queueerror.QueueAlreadyExists) {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) Enqueue(ctx context.Context, body []byte) error {
+	_, err := c.c.EnqueueMessage(ctx, base64.StdEncoding.EncodeToString(body), nil)
+	return err
+}
+
+func (c *Client) Dequeue(ctx context.Context, n int, visibility time.Duration) ([]*Received, error) {
+	num := int32(min(n, azureMaxMessages))
+	resp, err := c.c.DequeueMessages(ctx, &azqueue.DequeueMessagesOptions{
+		NumberOfMessages:  &num,
+		VisibilityTimeout: visibilitySeconds(visibility),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Received, 0, len(resp.Messages))
+	for _, m := range resp.Messages {
+		if m.MessageID == nil || m.PopReceipt == nil {
+			return nil, errors.New("dequeued a message without an ID or pop receipt")
+		}
+		r := &Received{ID: *m.MessageID, PopReceipt: *m.PopReceipt, Body: decodeBody(m.MessageText)}
+		if m.DequeueCount != nil {
+			r.DequeueCount = *m.DequeueCount
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (c *Client) Peek(ctx context.Context, n int) ([]*Received, error) {
+	num := int32(min(n, azureMaxMessages))
+	resp, err := c.c.PeekMessages(ctx, &azqueue.PeekMessagesOptions{NumberOfMessages: &num})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Received, 0, len(resp.Messages))
+	for _, m := range resp.Messages {
+		r := &Received{Body: decodeBody(m.MessageText)}
+		if m.MessageID != nil {
+			r.ID = *m.MessageID
+		}
+		if m.DequeueCount != nil {
+			r.DequeueCount = *m.DequeueCount
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (c *Client) Renew(ctx context.Context, r *Received, visibility time.Duration) error {
+	resp, err := c.c.UpdateMessage(ctx, r.ID, r.PopReceipt, base64.StdEncoding.EncodeToString(r.Body), &azqueue.UpdateMessageOptions{
+		VisibilityTimeout: visibilitySeconds(visibility),
+	})
+	if err != nil {
+		return azureError(r, err)
+	}
+	if resp.PopReceipt != nil {
+		r.PopReceipt = *resp.PopReceipt
+	}
+	return nil
+}
+
+func (c *Client) Delete(ctx context.Context, r *Received) error {
+	_, err := c.c.DeleteMessage(ctx, r.ID, r.PopReceipt, nil)
+	return azureError(r, err)
+}
+
+func (c *Client) String() string {
+	return fmt.Sprintf("azure queue %s", c.c.URL())
+}
+
+// connectionString expands the "UseDevelopmentStorage=true" shorthand.
+func connectionString(s string) string {
+	if strings.EqualFold(strings.Trim(s, "; "), "UseDevelopmentStorage=true") {
+		return AzuriteConnectionString
+	}
+	return s
+}
+
+// decodeBody returns the base64 decoded message text. A text which cannot be
+// decoded is returned as it is, for the consumer to report when decoding the
+// message.
+func decodeBody(text *string) []byte {
+	if text == nil {
+		return nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(*text); err == nil {
+		return b
+	}
+	return []byte(*text)
+}
+
+func visibilitySeconds(d time.Duration) *int32 {
+	s := int32((d + time.Second - 1) / time.Second)
+	return &s
+}
+
+func azureError(r *Received, err error) error {
+	if queueerror.HasCode(err, queueerror.MessageNotFound, queueerror.PopReceiptMismatch) {
+		return fmt.Errorf("message %s: %w: %v", r.ID, ErrNotFound, err)
+	}
+	return err
+}
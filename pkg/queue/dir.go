@@ -0,0 +1,263 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	dirLockName = ".lock"
+	// Every operation holds the lock briefly, so one older than this was
+	// left behind by a process which died holding it.
+	dirStaleLock = time.Minute
+)
+
+// Dir is a queue kept in a directory, with a JSON file per message, so that
+// producers and consumers in separate processes can share it without Azure,
+// e.g. for trying out the publishing flow locally. Operations are
+// serialized by a lock directory created next to the messages.
+type Dir struct {
+	root string
+}
+
+type dirMessage struct {
+	ID           string    `json:"id"`
+	PopReceipt   string    `json:"popReceipt,omitempty"`
+	DequeueCount int64     `json:"dequeueCount"`
+	VisibleAt    time.Time `json:"visibleAt"`
+	Body         []byte    `json:"body"`
+}
+
+// NewDir returns the queue kept in root, which is created if needed.
+func NewDir(root string) (*Dir, error) {
+	if root == "" {
+		return nil, fmt.Errorf("no directory given for the queue")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &Dir{root: root}, nil
+}
+
+func (q *Dir) Enqueue(ctx context.Context, body []byte) error {
+	unlock, err := q.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// IDs sort in the order messages were enqueued.
+	id := fmt.Sprintf("%019d-%s", time.Now().UnixNano(), randomHex())
+	return q.write(&dirMessage{ID: id, Body: body})
+}
+
+func (q *Dir) Dequeue(ctx context.Context, n int, visibility time.Duration) ([]*Received, error) {
+	unlock, err := q.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	msgs, err := q.visible(n)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Received, 0, len(msgs))
+	for _, m := range msgs {
+		m.DequeueCount++
+		m.PopReceipt = randomHex()
+		m.VisibleAt = time.Now().Add(visibility)
+		if err := q.write(m); err != nil {
+			return nil, err
+		}
+		out = append(out, &Received{ID: m.ID, PopReceipt: m.PopReceipt, DequeueCount: m.DequeueCount, Body: m.Body})
+	}
+	return out, nil
+}
+
+func (q *Dir) Peek(ctx context.Context, n int) ([]*Received, error) {
+	unlock, err := q.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	msgs, err := q.visible(n)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Received, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, &Received{ID: m.ID, DequeueCount: m.DequeueCount, Body: m.Body})
+	}
+	return out, nil
+}
+
+func (q *Dir) Renew(ctx context.Context, r *Received, visibility time.Duration) error {
+	unlock, err := q.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := q.find(r)
+	if err != nil {
+		return err
+	}
+	m.PopReceipt = randomHex()
+	m.VisibleAt = time.Now().Add(visibility)
+	if err := q.write(m); err != nil {
+		return err
+	}
+	r.PopReceipt = m.PopReceipt
+	return nil
+}
+
+func (q *Dir) Delete(ctx context.Context, r *Received) error {
+	unlock, err := q.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := q.find(r); err != nil {
+		return err
+	}
+	return os.Remove(q.path(r.ID))
+}
+
+func (q *Dir) String() string {
+	return "directory queue " + q.root
+}
+
+func (q *Dir) path(id string) string {
+	return filepath.Join(q.root, id+".json")
+}
+
+// visible returns up to n visible messages, oldest first.
+func (q *Dir) visible(n int) ([]*dirMessage, error) {
+	entries, err := os.ReadDir(q.root)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var out []*dirMessage
+	for _, e := range entries {
+		if len(out) == n {
+			break
+		}
+		name := e.Name()
+		if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		m, err := q.read(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return nil, err
+		}
+		if now.Before(m.VisibleAt) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// find returns the message r was dequeued as, if it was not dequeued again
+// since.
+func (q *Dir) find(r *Received) (*dirMessage, error) {
+	if r.ID == "" || filepath.Base(r.ID) != r.ID || strings.HasPrefix(r.ID, ".") {
+		return nil, fmt.Errorf("message %q: %w", r.ID, ErrNotFound)
+	}
+	m, err := q.read(r.ID)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("message %s: %w", r.ID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.PopReceipt != r.PopReceipt {
+		return nil, fmt.Errorf("message %s: %w: dequeued again", r.ID, ErrNotFound)
+	}
+	return m, nil
+}
+
+func (q *Dir) read(id string) (*dirMessage, error) {
+	b, err := os.ReadFile(q.path(id))
+	if err != nil {
+		return nil, err
+	}
+	var m dirMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("error reading message %s: %w", id, err)
+	}
+	return &m, nil
+}
+
+// write replaces the file of the message atomically, so that a process
+// dying halfway does not leave a truncated message.
+func (q *Dir) write(m *dirMessage) (retErr error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(q.root, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), q.path(m.ID))
+}
+
+// lock waits to create the lock directory, and returns a function removing
+// it. Creating a directory is atomic on every platform, unlike file locks.
+func (q *Dir) lock(ctx context.Context) (unlock func(), err error) {
+	p := filepath.Join(q.root, dirLockName)
+	for {
+		err := os.Mkdir(p, 0o755)
+		if err == nil {
+			return func() { os.Remove(p) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(p); err == nil && time.Since(fi.ModTime()) > dirStaleLock {
+			os.Remove(p)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func randomHex() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+// Index records which builds have a message in a queue, keyed by SpecKey,
+// so that each build is enqueued once however many times it is announced.
+// Unlike looking through the queue, it sees the messages being handled as
+// well as the visible ones, and does not disturb either.
+type Index interface {
+	// Add records key, and reports whether it was not recorded already.
+	// Concurrent calls with the same key report true for only one.
+	Add(ctx context.Context, key string) (bool, error)
+	// Remove forgets key. Removing a key which is not recorded is not an
+	// error.
+	Remove(ctx context.Context, key string) error
+}
+
+// SpecKey returns the key of a build in an Index: the sha256 of the spec.
+func SpecKey(spec archive.Spec) string {
+	// The fields of a struct are always marshaled in the same order.
+	b, err := json.Marshal(spec)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// EnqueueOnce adds m to q unless idx records a message for the same build,
+// and reports whether it was added. The consumer removes the key once it
+// has handled the message.
+func EnqueueOnce(ctx context.Context, q Queue, idx Index, m Message) (bool, error) {
+	key := SpecKey(m.Spec)
+	added, err := idx.Add(ctx, key)
+	if err != nil || !added {
+		return false, err
+	}
+
+	if err := EnqueueMessage(ctx, q, m); err != nil {
+		// Forget the build, so that enqueuing it can be tried again.
+		if rmErr := idx.Remove(ctx, key); rmErr != nil {
+			err = errors.Join(err, fmt.Errorf("error removing %s from the index: %w", key, rmErr))
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// MemoryIndex is an Index held in memory, to go with a Memory queue.
+type MemoryIndex struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{keys: map[string]bool{}}
+}
+
+func (idx *MemoryIndex) Add(ctx context.Context, key string) (bool, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.keys[key] {
+		return false, nil
+	}
+	idx.keys[key] = true
+	return true, nil
+}
+
+func (idx *MemoryIndex) Remove(ctx context.Context, key string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.keys, key)
+	return nil
+}
+
+// DirIndex is an Index kept in a directory, with an empty file per key, to
+// go with a Dir queue.
+type DirIndex struct {
+	root string
+}
+
+// NewDirIndex returns the index kept in root, which is created if needed.
+func NewDirIndex(root string) (*DirIndex, error) {
+	if root == "" {
+		return nil, fmt.Errorf("no directory given for the index")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirIndex{root: root}, nil
+}
+
+func (idx *DirIndex) Add(ctx context.Context, key string) (bool, error) {
+	p, err := idx.path(key)
+	if err != nil {
+		return false, err
+	}
+	// O_EXCL makes creating the file atomic.
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, f.Close()
+}
+
+func (idx *DirIndex) Remove(ctx context.Context, key string) error {
+	p, err := idx.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (idx *DirIndex) path(key string) (string, error) {
+	if key == "" || filepath.Base(key) != key || strings.HasPrefix(key, ".") {
+		return "", fmt.Errorf("invalid index key: %q", key)
+	}
+	return filepath.Join(idx.root, key), nil
+}
+
+// BlobIndex is an Index kept as empty blobs in an Azure storage container,
+// to go with an Azure queue. Blobs are created only if they do not exist,
+// which Azure storage does atomically.
+type BlobIndex struct {
+	client    *azblob.Client
+	container string
+	prefix    string
+}
+
+// NewBlobIndex returns the index kept under prefix in the container of the
+// storage account, connected to as configured by opts.
+func NewBlobIndex(accountName, container, prefix string, opts AzureOptions) (*BlobIndex, error) {
+	idx := &BlobIndex{container: container, prefix: prefix}
+
+	if opts.ConnectionString != "" {
+		client, err := azblob.NewClientFromConnectionString(connectionString(opts.ConnectionString), nil)
+		if err != nil {
+			return nil, err
+		}
+		idx.client = client
+		return idx, nil
+	}
+
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	serviceURL := opts.BlobEndpoint
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net", accountName)
+	}
+	client, err := azblob.NewClient(serviceURL, credential, nil)
+	if err != nil {
+		return nil, err
+	}
+	idx.client = client
+	return idx, nil
+}
+
+// Create creates the container if it does not exist yet.
+func (idx *BlobIndex) Create(ctx context.Context) error {
+	_, err := idx.client.CreateContainer(ctx, idx.container, nil)
+	if bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		return nil
+	}
+	return err
+}
+
+func (idx *BlobIndex) Add(ctx context.Context, key string) (bool, error) {
+	etag := azcore.ETagAny
+	_, err := idx.client.UploadBuffer(ctx, idx.container, path.Join(idx.prefix, key), nil, &azblob.UploadBufferOptions{
+		AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &etag},
+		},
+	})
+	if bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (idx *BlobIndex) Remove(ctx context.Context, key string) error {
+	_, err := idx.client.DeleteBlob(ctx, idx.container, path.Join(idx.prefix, key), nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory is a queue held in memory, for tests and for running the signing
+// and publishing flow locally.
+type Memory struct {
+	name string
+
+	mu       sync.Mutex
+	messages []*memoryMessage
+	nextID   int
+	receipts int
+}
+
+type memoryMessage struct {
+	id           string
+	popReceipt   string
+	dequeueCount int64
+	body         []byte
+	visibleAt    time.Time
+}
+
+// NewMemory returns an empty queue. The name is only used to describe it.
+func NewMemory(name string) *Memory {
+	return &Memory{name: name}
+}
+
+func (q *Memory) Enqueue(ctx context.Context, body []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	q.messages = append(q.messages, &memoryMessage{
+		id:   strconv.Itoa(q.nextID),
+		body: append([]byte{}, body...),
+	})
+	return nil
+}
+
+func (q *Memory) Dequeue(ctx context.Context, n int, visibility time.Duration) ([]*Received, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var out []*Received
+	for _, m := range q.messages {
+		if len(out) == n {
+			break
+		}
+		if now.Before(m.visibleAt) {
+			continue
+		}
+		m.dequeueCount++
+		m.popReceipt = q.newReceipt()
+		m.visibleAt = now.Add(visibility)
+		out = append(out, &Received{
+			ID:           m.id,
+			PopReceipt:   m.popReceipt,
+			DequeueCount: m.dequeueCount,
+			Body:         append([]byte{}, m.body...),
+		})
+	}
+	return out, nil
+}
+
+func (q *Memory) Peek(ctx context.Context, n int) ([]*Received, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var out []*Received
+	for _, m := range q.messages {
+		if len(out) == n {
+			break
+		}
+		if now.Before(m.visibleAt) {
+			continue
+		}
+		out = append(out, &Received{ID: m.id, DequeueCount: m.dequeueCount, Body: append([]byte{}, m.body...)})
+	}
+	return out, nil
+}
+
+func (q *Memory) Renew(ctx context.Context, r *Received, visibility time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	m, err := q.find(r)
+	if err != nil {
+		return err
+	}
+	m.popReceipt = q.newReceipt()
+	m.visibleAt = time.Now().Add(visibility)
+	r.PopReceipt = m.popReceipt
+	return nil
+}
+
+func (q *Memory) Delete(ctx context.Context, r *Received) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.find(r); err != nil {
+		return err
+	}
+	for i, m := range q.messages {
+		if m.id == r.ID {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Len returns the number of messages in the queue, visible or not.
+func (q *Memory) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+func (q *Memory) String() string {
+	return "memory queue " + q.name
+}
+
+func (q *Memory) find(r *Received) (*memoryMessage, error) {
+	for _, m := range q.messages {
+		if m.id == r.ID {
+			if m.popReceipt != r.PopReceipt {
+				return nil, fmt.Errorf("message %s: %w: dequeued again", r.ID, ErrNotFound)
+			}
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("message %s: %w", r.ID, ErrNotFound)
+}
+
+func (q *Memory) newReceipt() string {
+	q.receipts++
+	return strconv.Itoa(q.receipts)
+}
@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when renewing or deleting a message which was
+// deleted, or dequeued again by another consumer after it became visible.
+var ErrNotFound = errors.New("message not found")
+
+// Queue holds messages until a consumer has handled them. A dequeued
+// message is hidden from other consumers for a while rather than removed,
+// so that it is handled again if its consumer fails before deleting it.
+//
+// Client implements it with an Azure storage queue, Memory in memory, and
+// Dir with files in a directory.
+type Queue interface {
+	// Enqueue adds a message with the given body.
+	Enqueue(ctx context.Context, body []byte) error
+	// Dequeue returns up to n visible messages, oldest first, and hides
+	// them for visibility.
+	Dequeue(ctx context.Context, n int, visibility time.Duration) ([]*Received, error)
+	// Peek returns up to n visible messages, oldest first, without hiding
+	// them. Their PopReceipt is empty. Azure queues return at most 32.
+	Peek(ctx context.Context, n int) ([]*Received, error)
+	// Renew hides a dequeued message for visibility from now, and updates
+	// its PopReceipt.
+	Renew(ctx context.Context, r *Received, visibility time.Duration) error
+	// Delete removes a dequeued message.
+	Delete(ctx context.Context, r *Received) error
+	// String describes the queue, for logging.
+	String() string
+}
+
+// Received is a message returned by Queue.Dequeue.
+type Received struct {
+	ID string
+	// PopReceipt identifies this dequeue of the message. Renewing or
+	// deleting it fails once the message was dequeued again.
+	PopReceipt string
+	// DequeueCount is how many times the message was dequeued, including
+	// this one.
+	DequeueCount int64
+	Body         []byte
+}
+
+// Message decodes the body of the message.
+func (r *Received) Message() (*Message, error) {
+	var m Message
+	if err := json.Unmarshal(r.Body, &m); err != nil {
+		return nil, fmt.Errorf("error decoding message %s: %w", r.ID, err)
+	}
+	return &m, nil
+}
+
+// EnqueueMessage adds m to q.
+func EnqueueMessage(ctx context.Context, q Queue, m Message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return q.Enqueue(ctx, b)
+}
@@ -0,0 +1,258 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+func testQueue(t *testing.T, q Queue) {
+	ctx := context.Background()
+	const visibility = 50 * time.Millisecond
+
+	msgs := []Message{
+		{Artifact: ArtifactInfo{Name: "a"}, Spec: archive.Spec{Pkg: "moby-runc", Tag: "1.1.12"}},
+		{Artifact: ArtifactInfo{Name: "b"}, Spec: archive.Spec{Pkg: "moby-containerd", Tag: "1.7.13"}},
+	}
+	for _, m := range msgs {
+		if err := EnqueueMessage(ctx, q, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	peeked, err := q.Peek(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peeked) != 2 {
+		t.Fatalf("expected to peek 2 messages, got %d", len(peeked))
+	}
+
+	// Messages come out oldest first, and peeking did not hide them.
+	got, err := q.Dequeue(ctx, 1, visibility)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected a message, got %d", len(got))
+	}
+	a := got[0]
+	if m, err := a.Message(); err != nil || *m != msgs[0] {
+		t.Fatalf("expected %+v, got %+v: %v", msgs[0], m, err)
+	}
+	if a.DequeueCount != 1 {
+		t.Errorf("expected a dequeue count of 1, got %d", a.DequeueCount)
+	}
+
+	// The dequeued message is hidden.
+	peeked, err = q.Peek(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peeked) != 1 || peeked[0].ID == a.ID {
+		t.Fatalf("expected to peek only the second message, got %+v", peeked)
+	}
+	got, err = q.Dequeue(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID == a.ID {
+		t.Fatalf("expected only the second message, got %+v", got)
+	}
+	b := got[0]
+
+	// Renewing keeps it hidden past the first timeout.
+	if err := q.Renew(ctx, a, 4*visibility); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * visibility)
+	if got, err := q.Dequeue(ctx, 10, visibility); err != nil || len(got) != 0 {
+		t.Fatalf("expected no visible message, got %d: %v", len(got), err)
+	}
+	time.Sleep(3 * visibility)
+
+	// Once visible again, it is dequeued again, and the earlier receipt is
+	// no longer valid.
+	got, err = q.Dequeue(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != a.ID || got[0].DequeueCount != 2 {
+		t.Fatalf("expected the first message again, got %+v", got)
+	}
+	if err := q.Delete(ctx, a); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting with a stale receipt, got %v", err)
+	}
+	if err := q.Delete(ctx, got[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Delete(ctx, got[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	if err := q.Delete(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	peeked, err = q.Peek(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peeked) != 0 {
+		t.Fatalf("expected an empty queue, got %d messages", len(peeked))
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testQueue(t, NewMemory("test"))
+}
+
+func TestDir(t *testing.T) {
+	q, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testQueue(t, q)
+}
+
+func TestDirConcurrent(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	producer, err := NewDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 20
+	for i := 0; i < n; i++ {
+		if err := producer.Enqueue(ctx, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Consumers sharing the directory never get the same message.
+	var (
+		mu   sync.Mutex
+		seen = map[string]bool{}
+		wg   sync.WaitGroup
+	)
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q, err := NewDir(root)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for {
+				got, err := q.Dequeue(ctx, 1, time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(got) == 0 {
+					return
+				}
+				mu.Lock()
+				if seen[string(got[0].Body)] {
+					t.Errorf("message %s dequeued twice", got[0].Body)
+				}
+				seen[string(got[0].Body)] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != n {
+		t.Errorf("expected %d messages, got %d", n, len(seen))
+	}
+}
+
+func testIndex(t *testing.T, idx Index) {
+	ctx := context.Background()
+	q := NewMemory("test")
+	m := Message{Artifact: ArtifactInfo{Name: "a"}, Spec: archive.Spec{Pkg: "moby-runc", Tag: "1.1.12", Revision: "1"}}
+	other := Message{Artifact: ArtifactInfo{Name: "b"}, Spec: archive.Spec{Pkg: "moby-runc", Tag: "1.1.12", Revision: "2"}}
+
+	for i, tc := range []struct {
+		m      Message
+		expect bool
+	}{{m, true}, {m, false}, {other, true}} {
+		added, err := EnqueueOnce(ctx, q, idx, tc.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != tc.expect {
+			t.Errorf("%d: expected added=%v", i, tc.expect)
+		}
+	}
+	if q.Len() != 2 {
+		t.Fatalf("expected 2 messages, got %d", q.Len())
+	}
+
+	// Dequeuing leaves the build in the index, until it is removed.
+	if _, err := q.Dequeue(ctx, 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := EnqueueOnce(ctx, q, idx, m); err != nil || added {
+		t.Fatalf("expected an in-flight build not to be added: %v", err)
+	}
+	if err := idx.Remove(ctx, SpecKey(m.Spec)); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Remove(ctx, SpecKey(m.Spec)); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := EnqueueOnce(ctx, q, idx, m); err != nil || !added {
+		t.Fatalf("expected a removed build to be added: %v", err)
+	}
+}
+
+func TestMemoryIndex(t *testing.T) {
+	testIndex(t, NewMemoryIndex())
+}
+
+func TestDirIndex(t *testing.T) {
+	idx, err := NewDirIndex(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIndex(t, idx)
+}
+
+func TestContainsBuild(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemory("test")
+	spec := archive.Spec{Pkg: "moby-runc", Tag: "1.1.12", Revision: "1"}
+	if err := q.Enqueue(ctx, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnqueueMessage(ctx, q, Message{Spec: spec}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := PeekMessages(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := msgs.ContainsBuild(spec)
+	if !found || err == nil {
+		t.Errorf("expected the build to be found, and the decode error returned, got %v: %v", found, err)
+	}
+	other := spec
+	other.Revision = "2"
+	if found, _ := msgs.ContainsBuild(other); found {
+		t.Error("expected another build not to be found")
+	}
+
+	// Peeking did not hide anything.
+	if got, err := q.Dequeue(ctx, 10, time.Minute); err != nil || len(got) != 2 {
+		t.Errorf("expected 2 messages, got %d: %v", len(got), err)
+	}
+}
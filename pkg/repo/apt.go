@@ -0,0 +1,222 @@
+package repo
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const aptComponent = "main"
+
+// debFieldOrder is the order control fields are written in the Packages
+// index. Any other fields follow in alphabetical order.
+var debFieldOrder = []string{
+	"Package",
+	"Source",
+	"Version",
+	"Architecture",
+	"Maintainer",
+	"Installed-Size",
+	"Pre-Depends",
+	"Depends",
+	"Recommends",
+	"Suggests",
+	"Conflicts",
+	"Breaks",
+	"Replaces",
+	"Provides",
+	"Section",
+	"Priority",
+	"Homepage",
+	"Description",
+}
+
+// AptPackage is a deb to publish for a codename, e.g. "jammy".
+type AptPackage struct {
+	Codename string
+	Path     string
+}
+
+// WriteApt writes an apt repository to root, with a suite per codename and
+// a single "main" component. The debs are copied into pool/, which is shared
+// between codenames, and each suite has a Packages index per architecture
+// and a Release file, which is signed as InRelease and Release.gpg if there
+// is a signer.
+func WriteApt(root string, pkgs []AptPackage, o Options) error {
+	opts := o.defaults()
+
+	// codename -> architecture -> packages
+	suites := map[string]map[string][]*pkgFile{}
+	for _, p := range pkgs {
+		f, err := readPkgFile(p.Path)
+		if err != nil {
+			return err
+		}
+		arch := f.contents.Fields["Architecture"]
+		name := f.contents.Fields["Package"]
+		if arch == "" || name == "" || f.contents.Fields["Version"] == "" {
+			return fmt.Errorf("%s: missing Package, Version or Architecture field", p.Path)
+		}
+
+		if err := copyFile(filepath.Join(root, filepath.FromSlash(poolPath(name, p.Path))), p.Path); err != nil {
+			return err
+		}
+
+		if suites[p.Codename] == nil {
+			suites[p.Codename] = map[string][]*pkgFile{}
+		}
+		suites[p.Codename][arch] = append(suites[p.Codename][arch], f)
+	}
+
+	for codename, arches := range suites {
+		if err := writeSuite(root, codename, arches, opts); err != nil {
+			return fmt.Errorf("error writing suite %s: %w", codename, err)
+		}
+	}
+	return nil
+}
+
+// poolPath is the path of a deb in the repository, following the layout of
+// the Debian archive: pool/main/m/moby-runc/moby-runc_..._amd64.deb.
+func poolPath(pkg, filename string) string {
+	prefix := pkg[:1]
+	if strings.HasPrefix(pkg, "lib") && len(pkg) > 3 {
+		prefix = pkg[:4]
+	}
+	return path.Join("pool", aptComponent, prefix, pkg, filepath.Base(filename))
+}
+
+type indexFile struct {
+	name string
+	data []byte
+}
+
+func writeSuite(root, codename string, arches map[string][]*pkgFile, opts Options) error {
+	dist := filepath.Join(root, "dists", codename)
+
+	archNames := make([]string, 0, len(arches))
+	for arch := range arches {
+		archNames = append(archNames, arch)
+	}
+	sort.Strings(archNames)
+
+	var indexes []indexFile
+	for _, arch := range archNames {
+		pkgs := arches[arch]
+		sort.Slice(pkgs, func(i, j int) bool {
+			a, b := pkgs[i].contents.Fields, pkgs[j].contents.Fields
+			if a["Package"] != b["Package"] {
+				return a["Package"] < b["Package"]
+			}
+			return a["Version"] < b["Version"]
+		})
+
+		packages := packagesIndex(pkgs)
+		gz, err := gzipBytes(packages)
+		if err != nil {
+			return err
+		}
+
+		dir := path.Join(aptComponent, "binary-"+arch)
+		indexes = append(indexes,
+			indexFile{path.Join(dir, "Packages"), packages},
+			indexFile{path.Join(dir, "Packages.gz"), gz},
+		)
+	}
+
+	for _, idx := range indexes {
+		if err := writeFile(filepath.Join(dist, filepath.FromSlash(idx.name)), idx.data); err != nil {
+			return err
+		}
+	}
+
+	release := releaseFile(codename, archNames, indexes, opts)
+	if err := writeFile(filepath.Join(dist, "Release"), release); err != nil {
+		return err
+	}
+
+	if opts.Signer == nil {
+		return nil
+	}
+	inRelease, err := opts.Signer.ClearSign(release)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dist, "InRelease"), inRelease); err != nil {
+		return err
+	}
+	sig, err := opts.Signer.DetachSign(release)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dist, "Release.gpg"), sig)
+}
+
+// packagesIndex renders the stanzas of the Packages index for the debs: the
+// control fields of each, plus where to find it and its checksums.
+func packagesIndex(pkgs []*pkgFile) []byte {
+	b := new(strings.Builder)
+	for i, f := range pkgs {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		fields := f.contents.Fields
+		written := map[string]bool{}
+		for _, k := range debFieldOrder {
+			if v, ok := fields[k]; ok {
+				fmt.Fprintf(b, "%s: %s\n", k, v)
+				written[k] = true
+			}
+		}
+
+		var rest []string
+		for k := range fields {
+			if !written[k] {
+				rest = append(rest, k)
+			}
+		}
+		sort.Strings(rest)
+		for _, k := range rest {
+			fmt.Fprintf(b, "%s: %s\n", k, fields[k])
+		}
+
+		fmt.Fprintf(b, "Filename: %s\n", poolPath(fields["Package"], f.path))
+		fmt.Fprintf(b, "Size: %d\n", f.size)
+		fmt.Fprintf(b, "MD5sum: %s\n", f.md5)
+		fmt.Fprintf(b, "SHA1: %s\n", f.sha1)
+		fmt.Fprintf(b, "SHA256: %s\n", f.sha256)
+	}
+	return []byte(b.String())
+}
+
+func releaseFile(codename string, arches []string, indexes []indexFile, opts Options) []byte {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "Origin: %s\n", opts.Origin)
+	fmt.Fprintf(b, "Label: %s\n", opts.Label)
+	fmt.Fprintf(b, "Suite: %s\n", codename)
+	fmt.Fprintf(b, "Codename: %s\n", codename)
+	fmt.Fprintf(b, "Date: %s\n", opts.Time.Format("Mon, 02 Jan 2006 15:04:05 UTC"))
+	fmt.Fprintf(b, "Architectures: %s\n", strings.Join(arches, " "))
+	fmt.Fprintf(b, "Components: %s\n", aptComponent)
+
+	for _, sum := range []struct {
+		name string
+		hash func([]byte) string
+	}{
+		{"MD5Sum", func(b []byte) string { return fmt.Sprintf("%x", md5.Sum(b)) }},
+		{"SHA1", func(b []byte) string { return fmt.Sprintf("%x", sha1.Sum(b)) }},
+		{"SHA256", func(b []byte) string { return fmt.Sprintf("%x", sha256.Sum256(b)) }},
+	} {
+		fmt.Fprintf(b, "%s:\n", sum.name)
+		for _, idx := range indexes {
+			fmt.Fprintf(b, " %s %d %s\n", sum.hash(idx.data), len(idx.data), idx.name)
+		}
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,134 @@
+// Package repo generates apt and yum repositories from built packages, so
+// they can be installed with the distro's package manager rather than
+// downloaded one by one.
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/sign"
+)
+
+// Options configures the generated metadata.
+type Options struct {
+	// Time is recorded as the date of the metadata. It defaults to now.
+	Time time.Time
+	// Signer signs the metadata. Without one, the repository is unsigned.
+	Signer sign.Signer
+	// Origin and Label describe an apt repository. They default to
+	// "moby-packaging".
+	Origin string
+	Label  string
+}
+
+func (o *Options) defaults() Options {
+	opts := *o
+	if opts.Time.IsZero() {
+		opts.Time = time.Now()
+	}
+	opts.Time = opts.Time.UTC()
+	if opts.Origin == "" {
+		opts.Origin = "moby-packaging"
+	}
+	if opts.Label == "" {
+		opts.Label = "moby-packaging"
+	}
+	return opts
+}
+
+// pkgFile is a package to add to a repository, with the checksums the
+// indexes list for it.
+type pkgFile struct {
+	path     string
+	contents *archive.PackageContents
+	size     int64
+	md5      string
+	sha1     string
+	sha256   string
+}
+
+func readPkgFile(p string) (*pkgFile, error) {
+	contents, err := archive.ReadPackage(p)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	md5h, sha1h, sha256h := md5.New(), sha1.New(), sha256.New()
+	n, err := io.Copy(io.MultiWriter(md5h, sha1h, sha256h), f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkgFile{
+		path:     p,
+		contents: contents,
+		size:     n,
+		md5:      fmt.Sprintf("%x", md5h.Sum(nil)),
+		sha1:     fmt.Sprintf("%x", sha1h.Sum(nil)),
+		sha256:   fmt.Sprintf("%x", sha256h.Sum(nil)),
+	}, nil
+}
+
+// copyFile copies the package into the repository at dest.
+func copyFile(dest, src string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// gzipBytes compresses b without a name or mtime in the header, so the
+// output only depends on b.
+func gzipBytes(b []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeFile(p string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o644)
+}
@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive/archivetest"
+	"github.com/Azure/moby-packaging/pkg/sign"
+)
+
+// testSigner returns a signer with a new key in a temporary gpg home, or
+// nil if gpg is not installed.
+func testSigner(t *testing.T) *sign.GPG {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		return nil
+	}
+
+	// gpg-agent's socket path must be short.
+	home, err := os.MkdirTemp("/tmp", "gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+		os.RemoveAll(home)
+	})
+
+	cmd := exec.Command("gpg", "--homedir", home, "--batch", "--passphrase", "", "--quick-gen-key", "repo-test@example.com", "ed25519", "sign", "never")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot generate a gpg key: %v: %s", err, out)
+	}
+	return &sign.GPG{KeyID: "repo-test@example.com", Homedir: home}
+}
+
+func gpgVerify(t *testing.T, s *sign.GPG, args ...string) {
+	t.Helper()
+	cmd := exec.Command("gpg", append([]string{"--homedir", s.Homedir, "--batch", "--verify"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("bad signature %v: %v: %s", args, err, out)
+	}
+}
+
+func readGzip(t *testing.T, p string) []byte {
+	t.Helper()
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRepos(t *testing.T) {
+	deb, rpm := archivetest.WritePackages(t)
+	signer := testSigner(t)
+
+	opts := Options{Time: time.Unix(1700000000, 0)}
+	if signer != nil {
+		opts.Signer = signer
+	}
+
+	out := t.TempDir()
+	aptRoot := filepath.Join(out, "apt")
+	if err := WriteApt(aptRoot, []AptPackage{{Codename: "jammy", Path: deb}}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(aptRoot, "pool/main/m/moby-runc", filepath.Base(deb))); err != nil {
+		t.Error(err)
+	}
+	packages, err := os.ReadFile(filepath.Join(aptRoot, "dists/jammy/main/binary-amd64/Packages"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Package: moby-runc\nVersion: 1.1.12-ubuntu22.04u1\nArchitecture: amd64\nDepends: libc6, libseccomp2\nDescription: runc\n CLI tool.\n",
+		"Filename: pool/main/m/moby-runc/" + filepath.Base(deb) + "\n",
+		"SHA256: ",
+	} {
+		if !strings.Contains(string(packages), want) {
+			t.Errorf("expected %q in Packages:\n%s", want, packages)
+		}
+	}
+	release, err := os.ReadFile(filepath.Join(aptRoot, "dists/jammy/Release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Codename: jammy\n", "Date: Tue, 14 Nov 2023 22:13:20 UTC\n", "Architectures: amd64\n", " main/binary-amd64/Packages.gz\n"} {
+		if !strings.Contains(string(release), want) {
+			t.Errorf("expected %q in Release:\n%s", want, release)
+		}
+	}
+
+	yumDir := filepath.Join(out, "yum/mariner2/x86_64")
+	if err := WriteYum(yumDir, []string{rpm}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(yumDir, "repodata/repomd.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var md repomd
+	if err := xml.Unmarshal(b, &md); err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Data) != 3 || md.Revision != 1700000000 {
+		t.Fatalf("unexpected repomd: %s", b)
+	}
+
+	primary := readGzip(t, filepath.Join(yumDir, filepath.FromSlash(md.Data[0].Location.Href)))
+	for _, want := range []string{
+		`<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="1">`,
+		`<version epoch="0" ver="1.1.12" rel="1.cm2"></version>`,
+		`<location href="Packages/moby-runc-1.1.12-1.cm2.x86_64.rpm"></location>`,
+		`<rpm:entry name="libseccomp" flags="GE" epoch="0" ver="2.5"></rpm:entry>`,
+		`<rpm:entry name="/bin/sh"></rpm:entry>`,
+		`<file>/usr/bin/runc</file>`,
+	} {
+		if !strings.Contains(string(primary), want) {
+			t.Errorf("expected %q in primary.xml:\n%s", want, primary)
+		}
+	}
+	if strings.Contains(string(primary), "rpmlib(") {
+		t.Errorf("expected no rpmlib dependencies in primary.xml:\n%s", primary)
+	}
+	if filelists := readGzip(t, filepath.Join(yumDir, filepath.FromSlash(md.Data[1].Location.Href))); !strings.Contains(string(filelists), "<file>/usr/bin/runc</file>") {
+		t.Errorf("expected the binary in filelists.xml:\n%s", filelists)
+	}
+
+	if signer == nil {
+		t.Log("gpg not installed, not testing signatures")
+		return
+	}
+	gpgVerify(t, signer, filepath.Join(aptRoot, "dists/jammy/InRelease"))
+	gpgVerify(t, signer, filepath.Join(aptRoot, "dists/jammy/Release.gpg"), filepath.Join(aptRoot, "dists/jammy/Release"))
+	gpgVerify(t, signer, filepath.Join(yumDir, "repodata/repomd.xml.asc"), filepath.Join(yumDir, "repodata/repomd.xml"))
+}
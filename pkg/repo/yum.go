@@ -0,0 +1,414 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	yumNSCommon    = "http://linux.duke.edu/metadata/common"
+	yumNSRpm       = "http://linux.duke.edu/metadata/rpm"
+	yumNSFilelists = "http://linux.duke.edu/metadata/filelists"
+	yumNSOther     = "http://linux.duke.edu/metadata/other"
+	yumNSRepo      = "http://linux.duke.edu/metadata/repo"
+
+	rpmSenseLess    = 1 << 1
+	rpmSenseGreater = 1 << 2
+	rpmSenseEqual   = 1 << 3
+	rpmSensePrereq  = 1<<6 | 1<<9 | 1<<10
+)
+
+// primaryFiles matches the files listed in primary.xml as well as in
+// filelists.xml, so that dependencies on them resolve without the full file
+// lists. This is the same rule createrepo uses.
+var primaryFiles = regexp.MustCompile(`^(.*/)?bin/.*|^/etc/.*|^/usr/lib/sendmail$`)
+
+type yumVersion struct {
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+}
+
+type yumChecksum struct {
+	Type  string `xml:"type,attr"`
+	PkgID string `xml:"pkgid,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type yumFile struct {
+	Type string `xml:"type,attr,omitempty"`
+	Path string `xml:",chardata"`
+}
+
+type yumEntry struct {
+	Name  string `xml:"name,attr"`
+	Flags string `xml:"flags,attr,omitempty"`
+	Epoch string `xml:"epoch,attr,omitempty"`
+	Ver   string `xml:"ver,attr,omitempty"`
+	Rel   string `xml:"rel,attr,omitempty"`
+	Pre   string `xml:"pre,attr,omitempty"`
+}
+
+type yumEntries struct {
+	Entries []yumEntry `xml:"rpm:entry"`
+}
+
+type primaryMetadata struct {
+	XMLName  xml.Name         `xml:"metadata"`
+	Xmlns    string           `xml:"xmlns,attr"`
+	XmlnsRpm string           `xml:"xmlns:rpm,attr"`
+	Count    int              `xml:"packages,attr"`
+	Packages []primaryPackage `xml:"package"`
+}
+
+type primaryPackage struct {
+	Type        string      `xml:"type,attr"`
+	Name        string      `xml:"name"`
+	Arch        string      `xml:"arch"`
+	Version     yumVersion  `xml:"version"`
+	Checksum    yumChecksum `xml:"checksum"`
+	Summary     string      `xml:"summary"`
+	Description string      `xml:"description"`
+	Packager    string      `xml:"packager"`
+	URL         string      `xml:"url"`
+	Time        struct {
+		File  string `xml:"file,attr"`
+		Build string `xml:"build,attr"`
+	} `xml:"time"`
+	Size struct {
+		Package   int64  `xml:"package,attr"`
+		Installed string `xml:"installed,attr"`
+		Archive   string `xml:"archive,attr"`
+	} `xml:"size"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Format primaryFormat `xml:"format"`
+}
+
+type primaryFormat struct {
+	License     string `xml:"rpm:license"`
+	Vendor      string `xml:"rpm:vendor"`
+	Group       string `xml:"rpm:group"`
+	BuildHost   string `xml:"rpm:buildhost"`
+	SourceRPM   string `xml:"rpm:sourcerpm"`
+	HeaderRange struct {
+		Start int64 `xml:"start,attr"`
+		End   int64 `xml:"end,attr"`
+	} `xml:"rpm:header-range"`
+	Provides  *yumEntries `xml:"rpm:provides,omitempty"`
+	Requires  *yumEntries `xml:"rpm:requires,omitempty"`
+	Conflicts *yumEntries `xml:"rpm:conflicts,omitempty"`
+	Obsoletes *yumEntries `xml:"rpm:obsoletes,omitempty"`
+	Files     []yumFile   `xml:"file"`
+}
+
+type filelistsMetadata struct {
+	XMLName  xml.Name           `xml:"filelists"`
+	Xmlns    string             `xml:"xmlns,attr"`
+	Count    int                `xml:"packages,attr"`
+	Packages []filelistsPackage `xml:"package"`
+}
+
+type filelistsPackage struct {
+	PkgID   string     `xml:"pkgid,attr"`
+	Name    string     `xml:"name,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Version yumVersion `xml:"version"`
+	Files   []yumFile  `xml:"file"`
+}
+
+type otherMetadata struct {
+	XMLName  xml.Name       `xml:"otherdata"`
+	Xmlns    string         `xml:"xmlns,attr"`
+	Count    int            `xml:"packages,attr"`
+	Packages []otherPackage `xml:"package"`
+}
+
+type otherPackage struct {
+	PkgID   string     `xml:"pkgid,attr"`
+	Name    string     `xml:"name,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Version yumVersion `xml:"version"`
+}
+
+type repomd struct {
+	XMLName  xml.Name     `xml:"repomd"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	XmlnsRpm string       `xml:"xmlns:rpm,attr"`
+	Revision int64        `xml:"revision"`
+	Data     []repomdData `xml:"data"`
+}
+
+type repomdData struct {
+	Type         string      `xml:"type,attr"`
+	Checksum     yumChecksum `xml:"checksum"`
+	OpenChecksum yumChecksum `xml:"open-checksum"`
+	Location     struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Timestamp int64 `xml:"timestamp"`
+	Size      int   `xml:"size"`
+	OpenSize  int   `xml:"open-size"`
+}
+
+// WriteYum writes a yum repository for one distro and architecture to dir.
+// The rpms are copied into Packages/, and the metadata written to repodata/,
+// with repomd.xml signed as repomd.xml.asc if there is a signer.
+func WriteYum(dir string, paths []string, o Options) error {
+	opts := o.defaults()
+
+	var pkgs []*pkgFile
+	for _, p := range paths {
+		f, err := readPkgFile(p)
+		if err != nil {
+			return err
+		}
+		pkgs = append(pkgs, f)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return filepath.Base(pkgs[i].path) < filepath.Base(pkgs[j].path) })
+
+	primary := primaryMetadata{Xmlns: yumNSCommon, XmlnsRpm: yumNSRpm, Count: len(pkgs)}
+	filelists := filelistsMetadata{Xmlns: yumNSFilelists, Count: len(pkgs)}
+	other := otherMetadata{Xmlns: yumNSOther, Count: len(pkgs)}
+
+	for _, f := range pkgs {
+		href := path.Join("Packages", filepath.Base(f.path))
+		if err := copyFile(filepath.Join(dir, filepath.FromSlash(href)), f.path); err != nil {
+			return err
+		}
+
+		pp, err := primaryPackageFor(f, href)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		primary.Packages = append(primary.Packages, pp)
+
+		var files []yumFile
+		for _, m := range f.contents.Files {
+			yf := yumFile{Path: m.Name}
+			if m.Mode.IsDir() {
+				yf.Type = "dir"
+			}
+			files = append(files, yf)
+		}
+		filelists.Packages = append(filelists.Packages, filelistsPackage{PkgID: f.sha256, Name: pp.Name, Arch: pp.Arch, Version: pp.Version, Files: files})
+		other.Packages = append(other.Packages, otherPackage{PkgID: f.sha256, Name: pp.Name, Arch: pp.Arch, Version: pp.Version})
+	}
+
+	md := repomd{Xmlns: yumNSRepo, XmlnsRpm: yumNSRpm, Revision: opts.Time.Unix()}
+	for _, d := range []struct {
+		typ string
+		v   interface{}
+	}{
+		{"primary", primary},
+		{"filelists", filelists},
+		{"other", other},
+	} {
+		raw, err := marshalXML(d.v)
+		if err != nil {
+			return err
+		}
+		gz, err := gzipBytes(raw)
+		if err != nil {
+			return err
+		}
+
+		sum := fmt.Sprintf("%x", sha256.Sum256(gz))
+		href := fmt.Sprintf("repodata/%s-%s.xml.gz", sum, d.typ)
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(href)), gz); err != nil {
+			return err
+		}
+
+		rd := repomdData{
+			Type:         d.typ,
+			Checksum:     yumChecksum{Type: "sha256", Value: sum},
+			OpenChecksum: yumChecksum{Type: "sha256", Value: fmt.Sprintf("%x", sha256.Sum256(raw))},
+			Timestamp:    opts.Time.Unix(),
+			Size:         len(gz),
+			OpenSize:     len(raw),
+		}
+		rd.Location.Href = href
+		md.Data = append(md.Data, rd)
+	}
+
+	b, err := marshalXML(md)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, "repodata", "repomd.xml"), b); err != nil {
+		return err
+	}
+
+	if opts.Signer == nil {
+		return nil
+	}
+	sig, err := opts.Signer.DetachSign(b)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, "repodata", "repomd.xml.asc"), sig)
+}
+
+func primaryPackageFor(f *pkgFile, href string) (primaryPackage, error) {
+	fields := f.contents.Fields
+
+	pp := primaryPackage{
+		Type:        "rpm",
+		Name:        fields["Name"],
+		Arch:        fields["Arch"],
+		Version:     yumVersion{Epoch: "0", Ver: fields["Version"], Rel: fields["Release"]},
+		Checksum:    yumChecksum{Type: "sha256", PkgID: "YES", Value: f.sha256},
+		Summary:     fields["Summary"],
+		Description: fields["Description"],
+		URL:         fields["URL"],
+	}
+	if pp.Name == "" || pp.Version.Ver == "" || pp.Arch == "" {
+		return pp, fmt.Errorf("missing name, version or arch")
+	}
+
+	// The build time is used for the file time too, so the metadata does
+	// not depend on when the package was copied.
+	pp.Time.File = fields["BuildTime"]
+	pp.Time.Build = fields["BuildTime"]
+	pp.Size.Package = f.size
+	pp.Size.Installed = fields["Size"]
+	pp.Size.Archive = fields["PayloadSize"]
+	pp.Location.Href = href
+
+	pp.Format.License = fields["License"]
+	pp.Format.Group = fields["Group"]
+	pp.Format.BuildHost = fields["BuildHost"]
+	pp.Format.SourceRPM = fields["SourceRPM"]
+
+	// The header follows the lead and signature header, and is followed by
+	// the payload.
+	var hdrSize, payloadSize int64
+	for _, part := range f.contents.Parts {
+		switch part.Name {
+		case "header":
+			hdrSize = part.Size
+		case "payload":
+			payloadSize = part.Size
+		}
+	}
+	pp.Format.HeaderRange.Start = f.size - payloadSize - hdrSize
+	pp.Format.HeaderRange.End = f.size - payloadSize
+
+	var err error
+	for _, dep := range []struct {
+		dst        **yumEntries
+		name       string
+		versionKey string
+		flagsKey   string
+	}{
+		{&pp.Format.Provides, "Provides", "ProvideVersion", "ProvideFlags"},
+		{&pp.Format.Requires, "Requires", "RequireVersion", "RequireFlags"},
+		{&pp.Format.Conflicts, "Conflicts", "ConflictVersion", "ConflictFlags"},
+		{&pp.Format.Obsoletes, "Obsoletes", "ObsoleteVersion", "ObsoleteFlags"},
+	} {
+		*dep.dst, err = yumDeps(fields[dep.name], fields[dep.versionKey], fields[dep.flagsKey], dep.name == "Requires")
+		if err != nil {
+			return pp, fmt.Errorf("error reading %s: %w", dep.name, err)
+		}
+	}
+
+	for _, m := range f.contents.Files {
+		if m.Mode.IsDir() || !primaryFiles.MatchString(m.Name) {
+			continue
+		}
+		pp.Format.Files = append(pp.Format.Files, yumFile{Path: m.Name})
+	}
+
+	return pp, nil
+}
+
+// yumDeps turns the dependency tags of an rpm, as joined by
+// archive.ReadPackage, into metadata entries. rpmlib() dependencies are left
+// out, as they are satisfied by rpm itself.
+func yumDeps(names, versions, flags string, requires bool) (*yumEntries, error) {
+	if names == "" {
+		return nil, nil
+	}
+
+	nameList := strings.Split(names, ", ")
+	versionList := strings.Split(versions, ", ")
+	flagList := strings.Split(flags, ", ")
+
+	entries := &yumEntries{}
+	seen := map[yumEntry]bool{}
+	for i, name := range nameList {
+		if strings.HasPrefix(name, "rpmlib(") {
+			continue
+		}
+		e := yumEntry{Name: name}
+
+		var fl int64
+		if i < len(flagList) && flagList[i] != "" {
+			var err error
+			if fl, err = strconv.ParseInt(flagList[i], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		if i < len(versionList) && versionList[i] != "" {
+			e.Flags = senseFlags(fl)
+			e.Epoch, e.Ver, e.Rel = splitEVR(versionList[i])
+		}
+		if requires && fl&rpmSensePrereq != 0 {
+			e.Pre = "1"
+		}
+
+		if !seen[e] {
+			seen[e] = true
+			entries.Entries = append(entries.Entries, e)
+		}
+	}
+	if len(entries.Entries) == 0 {
+		return nil, nil
+	}
+	return entries, nil
+}
+
+func senseFlags(fl int64) string {
+	switch fl & (rpmSenseLess | rpmSenseGreater | rpmSenseEqual) {
+	case rpmSenseLess:
+		return "LT"
+	case rpmSenseGreater:
+		return "GT"
+	case rpmSenseEqual:
+		return "EQ"
+	case rpmSenseLess | rpmSenseEqual:
+		return "LE"
+	case rpmSenseGreater | rpmSenseEqual:
+		return "GE"
+	}
+	return ""
+}
+
+// splitEVR splits an rpm version of the form [epoch:]version[-release].
+func splitEVR(evr string) (epoch, ver, rel string) {
+	epoch = "0"
+	if e, rest, ok := strings.Cut(evr, ":"); ok {
+		epoch, evr = e, rest
+	}
+	ver = evr
+	if i := strings.LastIndex(evr, "-"); i >= 0 {
+		ver, rel = evr[:i], evr[i+1:]
+	}
+	return epoch, ver, rel
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
@@ -0,0 +1,170 @@
+package sign
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Authenticode signs and verifies the windows executables in a zip by
+// running external commands on each of them, such as osslsigncode, or
+// signtool through a wrapper. The arguments "{in}" and "{out}" in the
+// commands are replaced by the path of the executable and of the signed
+// executable to write.
+type Authenticode struct {
+	// Sign signs {in}, writing the signed executable to {out}, e.g.
+	// osslsigncode sign -pkcs12 key.pfx -h sha256 -in {in} -out {out}.
+	Sign []string
+	// Verify exits with an error if {in} is not validly signed, e.g.
+	// osslsigncode verify -CAfile ca.pem -in {in}.
+	Verify []string
+}
+
+// isExecutable reports whether the file in a zip is one Authenticode
+// applies to.
+func isExecutable(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".exe", ".dll", ".sys":
+		return true
+	}
+	return false
+}
+
+// SignZip returns the zip in b with each executable in it signed. The other
+// files are copied as they are.
+func (a *Authenticode) SignZip(b []byte) ([]byte, error) {
+	if len(a.Sign) == 0 {
+		return nil, errors.New("no authenticode sign command configured")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "authenticode")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	signed := 0
+	for _, f := range zr.File {
+		if !isExecutable(f.Name) {
+			if err := zw.Copy(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		in := filepath.Join(dir, "in"+path.Ext(f.Name))
+		out := filepath.Join(dir, "out"+path.Ext(f.Name))
+		if err := extract(f, in); err != nil {
+			return nil, err
+		}
+		os.Remove(out)
+		if err := runHook(a.Sign, in, out); err != nil {
+			return nil, fmt.Errorf("error signing %s: %w", f.Name, err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			return nil, fmt.Errorf("error signing %s: %w", f.Name, err)
+		}
+
+		hdr := f.FileHeader
+		w, err := zw.CreateHeader(&hdr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		signed++
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if signed == 0 {
+		return nil, errors.New("no executables to sign")
+	}
+	return buf.Bytes(), nil
+}
+
+// VerifyZip checks the signature of each executable in the zip in b.
+func (a *Authenticode) VerifyZip(b []byte) error {
+	if len(a.Verify) == 0 {
+		return errors.New("no authenticode verify command configured")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "authenticode")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	verified := 0
+	for _, f := range zr.File {
+		if !isExecutable(f.Name) {
+			continue
+		}
+		in := filepath.Join(dir, "in"+path.Ext(f.Name))
+		if err := extract(f, in); err != nil {
+			return err
+		}
+		if err := runHook(a.Verify, in, ""); err != nil {
+			return fmt.Errorf("%s: bad signature: %w", f.Name, err)
+		}
+		verified++
+	}
+	if verified == 0 {
+		return ErrUnsigned
+	}
+	return nil
+}
+
+func extract(f *zip.File, dest string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, rc); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func runHook(command []string, in, out string) error {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		arg = strings.ReplaceAll(arg, "{in}", in)
+		args[i] = strings.ReplaceAll(arg, "{out}", out)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", args[0], err, bytes.TrimSpace(output))
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package sign
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+// CompareSigned checks that the package at signed is the package at unsigned
+// with signatures added, and nothing else changed, so that signing cannot
+// swap or corrupt what was built. The signatures themselves are not checked;
+// that is what VerifyPackage is for.
+func CompareSigned(unsigned, signed string) error {
+	if filepath.Ext(unsigned) != filepath.Ext(signed) {
+		return fmt.Errorf("%s and %s are not the same type of package", unsigned, signed)
+	}
+
+	a, err := os.ReadFile(unsigned)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(signed)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(signed) {
+	case ".deb":
+		err = compareDebs(a, b)
+	case ".rpm":
+		err = compareRpms(a, b)
+	case ".zip":
+		err = compareZips(a, b)
+	default:
+		return fmt.Errorf("%s: unknown package type", signed)
+	}
+	if err != nil {
+		return fmt.Errorf("%s does not match the package built, %s: %w", signed, unsigned, err)
+	}
+	return nil
+}
+
+// compareDebs checks that the members of the debs are the same, apart from
+// the signature members. Signers add members named with a leading
+// underscore, such as _gpgbuilder from dpkg-sig or _gpgorigin from debsigs,
+// which dpkg ignores.
+func compareDebs(unsigned, signed []byte) error {
+	members := func(b []byte) ([]archive.ArMember, error) {
+		all, err := archive.ReadAr(b)
+		if err != nil {
+			return nil, err
+		}
+		var ms []archive.ArMember
+		for _, m := range all {
+			if !strings.HasPrefix(m.Name, "_") {
+				ms = append(ms, m)
+			}
+		}
+		return ms, nil
+	}
+
+	a, err := members(unsigned)
+	if err != nil {
+		return err
+	}
+	b, err := members(signed)
+	if err != nil {
+		return err
+	}
+
+	if len(a) != len(b) {
+		return fmt.Errorf("expected %d members, found %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name {
+			return fmt.Errorf("expected member %s, found %s", a[i].Name, b[i].Name)
+		}
+		if !bytes.Equal(a[i].Data, b[i].Data) {
+			return fmt.Errorf("member %s differs", a[i].Name)
+		}
+	}
+	return nil
+}
+
+// compareRpms checks that the rpms have the same lead, header and payload.
+// Only the signature header may differ: besides the signatures, signing
+// tools may add or resize other tags in it, and it only holds digests of
+// the header and payload.
+func compareRpms(unsigned, signed []byte) error {
+	a, err := archive.SplitRpm(unsigned)
+	if err != nil {
+		return err
+	}
+	b, err := archive.SplitRpm(signed)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !bytes.Equal(a.Lead, b.Lead):
+		return errors.New("lead differs")
+	case !bytes.Equal(a.Header, b.Header):
+		return errors.New("header differs")
+	case !bytes.Equal(a.Payload, b.Payload):
+		return errors.New("payload differs")
+	}
+	return nil
+}
+
+// compareZips checks that the zips hold the same files with the same
+// contents, apart from the Authenticode signatures of the executables.
+func compareZips(unsigned, signed []byte) error {
+	a, err := readZip(unsigned)
+	if err != nil {
+		return err
+	}
+	b, err := readZip(signed)
+	if err != nil {
+		return err
+	}
+
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			return fmt.Errorf("unexpected file %s", name)
+		}
+	}
+	for name, data := range a {
+		signedData, ok := b[name]
+		if !ok {
+			return fmt.Errorf("missing file %s", name)
+		}
+		if !isExecutable(name) {
+			if !bytes.Equal(data, signedData) {
+				return fmt.Errorf("file %s differs", name)
+			}
+			continue
+		}
+
+		x, err := stripAuthenticode(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		y, err := stripAuthenticode(signedData)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if !equalPadded(x, y) {
+			return fmt.Errorf("file %s differs other than by its signature", name)
+		}
+	}
+	return nil
+}
+
+func readZip(b []byte) (map[string][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(zr.File))
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		files[f.Name] = data
+	}
+	return files, nil
+}
+
+// stripAuthenticode returns the PE executable in b without what signing
+// changes: the checksum, the certificate table entry and the certificate
+// table at the end of the file. These are the parts left out of the
+// Authenticode digest. Files which are not PE executables are returned as
+// they are.
+func stripAuthenticode(b []byte) ([]byte, error) {
+	if len(b) < 0x40 || !bytes.HasPrefix(b, []byte("MZ")) {
+		return b, nil
+	}
+
+	pe := int(binary.LittleEndian.Uint32(b[0x3c:]))
+	if pe < 0 || len(b) < pe+24+2 || !bytes.Equal(b[pe:pe+4], []byte("PE\x00\x00")) {
+		return b, nil
+	}
+	opt := pe + 24
+
+	var dirs int
+	switch magic := binary.LittleEndian.Uint16(b[opt:]); magic {
+	case 0x10b: // PE32
+		dirs = opt + 96
+	case 0x20b: // PE32+
+		dirs = opt + 112
+	default:
+		return nil, fmt.Errorf("unknown PE optional header magic %#x", magic)
+	}
+	// The certificate table is the fifth data directory.
+	cert := dirs + 4*8
+	if len(b) < cert+8 {
+		return nil, errors.New("truncated PE header")
+	}
+
+	out := append([]byte{}, b...)
+	copy(out[opt+64:opt+68], make([]byte, 4))
+	offset := int(binary.LittleEndian.Uint32(out[cert:]))
+	size := int(binary.LittleEndian.Uint32(out[cert+4:]))
+	copy(out[cert:cert+8], make([]byte, 8))
+	if size == 0 {
+		return out, nil
+	}
+	if offset < 0 || size < 0 || offset+size > len(out) {
+		return nil, errors.New("certificate table out of bounds")
+	}
+	return out[:offset], nil
+}
+
+// equalPadded reports whether a and b are equal, once the shorter of them
+// is padded with zeros to the 8 byte alignment the certificate table needs.
+func equalPadded(a, b []byte) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(b)-len(a) >= 8 || !bytes.Equal(a, b[:len(a)]) {
+		return false
+	}
+	return len(bytes.Trim(b[len(a):], "\x00")) == 0
+}
@@ -0,0 +1,141 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+const (
+	// debSignatureMember is the ar member dpkg-sig adds to a deb for a
+	// signature with the "builder" role. dpkg ignores members starting
+	// with an underscore.
+	debSignatureMember = "_gpgbuilder"
+	debSignatureRole   = "builder"
+)
+
+// SignDeb returns the deb in b with a dpkg-sig style signature appended: a
+// clear signed manifest of the md5 and sha1 sums and sizes of the other
+// members, dated t. Any signature already there is replaced.
+func SignDeb(b []byte, s Signer, t time.Time) ([]byte, error) {
+	members, err := archive.ReadAr(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var unsigned []archive.ArMember
+	for _, m := range members {
+		if m.Name != debSignatureMember {
+			unsigned = append(unsigned, m)
+		}
+	}
+
+	manifest := new(strings.Builder)
+	fmt.Fprintf(manifest, "Version: 4\nSigner: \nDate: %s\nRole: %s\nFiles: \n", t.UTC().Format(time.ANSIC), debSignatureRole)
+	for _, m := range unsigned {
+		fmt.Fprintf(manifest, "\t%x %x %d %s\n", md5.Sum(m.Data), sha1.Sum(m.Data), len(m.Data), m.Name)
+	}
+
+	sig, err := s.ClearSign([]byte(manifest.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("!<arch>\n")
+	for _, m := range append(unsigned, archive.ArMember{Name: debSignatureMember, ModTime: t, Data: sig}) {
+		if err := archive.WriteArMember(buf, m); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// VerifyDeb checks the dpkg-sig style signature of the deb in b, and that
+// the signed manifest matches every other member of the deb.
+func VerifyDeb(b []byte, v Verifier) error {
+	members, err := archive.ReadAr(b)
+	if err != nil {
+		return err
+	}
+
+	var (
+		sig      []byte
+		unsigned = map[string][]byte{}
+	)
+	for _, m := range members {
+		if m.Name == debSignatureMember {
+			sig = m.Data
+			continue
+		}
+		unsigned[m.Name] = m.Data
+	}
+	if sig == nil {
+		return ErrUnsigned
+	}
+
+	manifest, err := v.VerifyClearSigned(sig)
+	if err != nil {
+		return fmt.Errorf("%s: %w", debSignatureMember, err)
+	}
+
+	files, err := parseDebManifest(manifest)
+	if err != nil {
+		return fmt.Errorf("%s: %w", debSignatureMember, err)
+	}
+
+	for name, data := range unsigned {
+		want, ok := files[name]
+		if !ok {
+			return fmt.Errorf("%s is not signed", name)
+		}
+		got := fmt.Sprintf("%x %x %d", md5.Sum(data), sha1.Sum(data), len(data))
+		if got != want {
+			return fmt.Errorf("%s does not match its signature: signed %s, got %s", name, want, got)
+		}
+		delete(files, name)
+	}
+	for name := range files {
+		return fmt.Errorf("%s is signed, but missing", name)
+	}
+	return nil
+}
+
+// parseDebManifest returns the "<md5> <sha1> <size>" of each file in a
+// dpkg-sig manifest, by name.
+func parseDebManifest(b []byte) (map[string]string, error) {
+	files := map[string]string{}
+	inFiles := false
+	for _, line := range strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "Role:"):
+			if role := strings.TrimSpace(strings.TrimPrefix(line, "Role:")); role != debSignatureRole {
+				return nil, fmt.Errorf("unexpected role %q", role)
+			}
+		case strings.HasPrefix(line, "Files:"):
+			inFiles = true
+		case inFiles && strings.HasPrefix(line, "\t"):
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("invalid manifest line %q", line)
+			}
+			if _, err := strconv.ParseInt(fields[2], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid manifest line %q", line)
+			}
+			files[fields[3]] = strings.Join(fields[:3], " ")
+		default:
+			inFiles = false
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no files in manifest")
+	}
+	return files, nil
+}
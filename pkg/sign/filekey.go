@@ -0,0 +1,203 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	pemSignatureType = "SIGNATURE"
+	pemSignatureHead = "-----BEGIN " + pemSignatureType + "-----"
+)
+
+// FileKey signs with a PEM encoded private key, such as one generated with
+// `openssl genpkey -algorithm ed25519`, and verifies with the public key.
+// Ed25519, RSA and ECDSA keys are supported.
+//
+// Its signatures are not OpenPGP signatures, so only a FileKey can verify
+// them: it stands in for the release key in tests and local builds, in
+// the same places in the packages.
+type FileKey struct {
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// GenerateFileKey returns a new ed25519 key.
+func GenerateFileKey() (*FileKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &FileKey{private: priv, public: pub}, nil
+}
+
+// LoadFileKey reads the PEM encoded key in the file at p. A private key can
+// sign and verify, a public key can only verify.
+func LoadFileKey(p string) (*FileKey, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	k, err := parseFileKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key %s: %w", p, err)
+	}
+	return k, nil
+}
+
+func isPEMKey(b []byte) bool {
+	block, _ := pem.Decode(b)
+	return block != nil && bytes.HasSuffix([]byte(block.Type), []byte("KEY"))
+}
+
+func parseFileKey(b []byte) (*FileKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &FileKey{public: pub}, nil
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	return &FileKey{private: priv, public: priv.Public()}, nil
+}
+
+// MarshalPrivateKey returns the private key, PEM encoded in PKCS #8.
+func (k *FileKey) MarshalPrivateKey() ([]byte, error) {
+	if k.private == nil {
+		return nil, errors.New("no private key")
+	}
+	b, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), nil
+}
+
+// MarshalPublicKey returns the public key, PEM encoded, for LoadVerifier.
+func (k *FileKey) MarshalPublicKey() ([]byte, error) {
+	b, err := x509.MarshalPKIXPublicKey(k.public)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}), nil
+}
+
+func (k *FileKey) sign(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, errors.New("cannot sign with a public key")
+	}
+	if _, ok := k.private.(ed25519.PrivateKey); ok {
+		return k.private.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return k.private.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func (k *FileKey) verify(data, sig []byte) error {
+	digest := sha256.Sum256(data)
+
+	var ok bool
+	switch pub := k.public.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, data, sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, digest[:], sig)
+	default:
+		return fmt.Errorf("unsupported public key %T", k.public)
+	}
+	if !ok {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+// ClearSign appends the armored signature to data, after a newline if data
+// does not end with one, in which case the newline is signed too.
+func (k *FileKey) ClearSign(data []byte) ([]byte, error) {
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(append([]byte{}, data...), '\n')
+	}
+	sig, err := k.DetachSign(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, data...), sig...), nil
+}
+
+func (k *FileKey) DetachSign(data []byte) ([]byte, error) {
+	sig, err := k.sign(data)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemSignatureType, Bytes: sig}), nil
+}
+
+func (k *FileKey) VerifyClearSigned(msg []byte) ([]byte, error) {
+	i := bytes.LastIndex(msg, []byte(pemSignatureHead))
+	if i < 0 || (i > 0 && msg[i-1] != '\n') {
+		return nil, ErrUnsigned
+	}
+	data := msg[:i]
+	if err := k.VerifyDetached(data, msg[i:]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (k *FileKey) VerifyDetached(data, sig []byte) error {
+	raw, err := Dearmor(sig)
+	if err != nil {
+		return err
+	}
+	return k.verify(data, raw)
+}
+
+func isPEMSignature(b []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte(pemSignatureHead))
+}
+
+func decodePEMSignature(b []byte) ([]byte, error) {
+	block, rest := pem.Decode(b)
+	if block == nil || block.Type != pemSignatureType || len(bytes.TrimSpace(rest)) > 0 {
+		return nil, errors.New("invalid PEM signature")
+	}
+	return block.Bytes, nil
+}
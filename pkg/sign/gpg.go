@@ -0,0 +1,165 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	pgpArmorBegin = "-----BEGIN PGP SIGNATURE-----"
+	pgpArmorEnd   = "-----END PGP SIGNATURE-----"
+)
+
+// GPG signs with a key from a gpg keyring, and verifies with a public key.
+type GPG struct {
+	// KeyID selects the secret key to sign with.
+	KeyID string
+	// Homedir is the gpg home directory holding the keys. It defaults to
+	// gpg's own default.
+	Homedir string
+	// PublicKey is a file holding the public key to verify with, armored
+	// or not. If it is empty, signatures are verified with the keys in
+	// Homedir.
+	PublicKey string
+}
+
+func (g *GPG) ClearSign(data []byte) ([]byte, error) {
+	return g.sign(data, "--clearsign")
+}
+
+func (g *GPG) DetachSign(data []byte) ([]byte, error) {
+	return g.sign(data, "--armor", "--detach-sign")
+}
+
+func (g *GPG) sign(data []byte, args ...string) ([]byte, error) {
+	if g.KeyID == "" {
+		return nil, errors.New("no gpg key to sign with")
+	}
+	out, err := gpg(g.Homedir, data, append([]string{"--pinentry-mode", "loopback", "--digest-algo", "SHA256", "--local-user", g.KeyID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error signing with gpg key %s: %w", g.KeyID, err)
+	}
+	return out, nil
+}
+
+func (g *GPG) VerifyClearSigned(msg []byte) ([]byte, error) {
+	var out []byte
+	err := g.withVerifyHome(func(home string) error {
+		var err error
+		out, err = gpgVerify(home, msg, "--decrypt")
+		return err
+	})
+	return out, err
+}
+
+func (g *GPG) VerifyDetached(data, sig []byte) error {
+	f, err := os.CreateTemp("", "sig")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(sig); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return g.withVerifyHome(func(home string) error {
+		// "-" is the data, read from stdin.
+		_, err := gpgVerify(home, data, "--verify", f.Name(), "-")
+		return err
+	})
+}
+
+// withVerifyHome calls f with the gpg home directory holding the keys to
+// verify with: a new one with only PublicKey in it, if it is set.
+func (g *GPG) withVerifyHome(f func(home string) error) error {
+	if g.PublicKey == "" {
+		return f(g.Homedir)
+	}
+
+	// The directory is kept short, as gpg-agent's socket is created in it.
+	home, err := os.MkdirTemp("", "gpg")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "all").Run()
+		os.RemoveAll(home)
+	}()
+
+	if _, err := gpg(home, nil, "--import", g.PublicKey); err != nil {
+		return fmt.Errorf("error importing %s: %w", g.PublicKey, err)
+	}
+	return f(home)
+}
+
+// gpgVerify runs a gpg command checking a signature, which only succeeds if
+// gpg reports a valid signature, and returns its output.
+func gpgVerify(home string, stdin []byte, args ...string) ([]byte, error) {
+	status := new(bytes.Buffer)
+	out, err := runGPG(home, stdin, status, append([]string{"--status-fd", "2"}, args...)...)
+	if err != nil || !strings.Contains(status.String(), "[GNUPG:] VALIDSIG ") {
+		if strings.Contains(status.String(), "[GNUPG:] NODATA ") {
+			return nil, ErrUnsigned
+		}
+		return nil, fmt.Errorf("bad signature: %v: %s", err, strings.TrimSpace(status.String()))
+	}
+	return out, nil
+}
+
+func gpg(home string, stdin []byte, args ...string) ([]byte, error) {
+	stderr := new(bytes.Buffer)
+	out, err := runGPG(home, stdin, stderr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func runGPG(home string, stdin []byte, stderr *bytes.Buffer, args ...string) ([]byte, error) {
+	base := []string{"--batch", "--yes"}
+	if home != "" {
+		base = append([]string{"--homedir", home}, base...)
+	}
+
+	cmd := exec.Command("gpg", append(base, args...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = stderr
+	return cmd.Output()
+}
+
+// decodePGPArmor decodes an ASCII armored OpenPGP signature. The checksum is
+// not checked, as the signature itself is.
+func decodePGPArmor(b []byte) ([]byte, error) {
+	s := strings.ReplaceAll(string(b), "\r\n", "\n")
+	_, s, ok := strings.Cut(s, pgpArmorBegin+"\n")
+	if !ok {
+		return nil, errors.New("missing armor header")
+	}
+	s, _, ok = strings.Cut(s, pgpArmorEnd)
+	if !ok {
+		return nil, errors.New("missing armor footer")
+	}
+	// Armor headers, such as "Version:", end at the first blank line.
+	if headers, body, ok := strings.Cut(s, "\n\n"); ok && strings.Contains(headers, ":") {
+		s = body
+	}
+
+	var data strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "=") {
+			continue
+		}
+		data.WriteString(line)
+	}
+	return base64.StdEncoding.DecodeString(data.String())
+}
@@ -0,0 +1,52 @@
+package sign
+
+import (
+	"fmt"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+// SignRpm returns the rpm in b with a signature of its header added to its
+// signature header, where rpmsign puts it, replacing any signature already
+// there. The header holds the digests of the payload, so the signature
+// covers the whole package.
+func SignRpm(b []byte, s Signer) ([]byte, error) {
+	parts, err := archive.SplitRpm(b)
+	if err != nil {
+		return nil, err
+	}
+
+	armored, err := s.DetachSign(parts.Header)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := Dearmor(armored)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := parts.SetHeaderSignature(sig); err != nil {
+		return nil, err
+	}
+	return parts.Bytes(), nil
+}
+
+// VerifyRpm checks the header signature of the rpm in b, and the payload
+// against the digest in the signed header.
+func VerifyRpm(b []byte, v Verifier) error {
+	parts, err := archive.SplitRpm(b)
+	if err != nil {
+		return err
+	}
+	sig, err := parts.HeaderSignature()
+	if err != nil {
+		return err
+	}
+	if sig == nil {
+		return ErrUnsigned
+	}
+	if err := v.VerifyDetached(parts.Header, sig); err != nil {
+		return fmt.Errorf("rpm header signature: %w", err)
+	}
+	return parts.CheckPayloadDigest()
+}
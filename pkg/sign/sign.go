@@ -0,0 +1,210 @@
+// Package sign signs packages the way they are signed for release, and
+// verifies those signatures: rpms get an OpenPGP header signature, debs a
+// dpkg-sig style "_gpgbuilder" member, and the executables in windows zips
+// an Authenticode signature, made by an external tool. Any file can also get
+// a detached signature.
+//
+// Releases are signed with a key held by the signing service, through GPG in
+// the same formats. FileKey is a stand-in for it, for tests and local builds.
+package sign
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DetachedExtension is appended to the name of a file to get the name of its
+// detached signature.
+const DetachedExtension = ".asc"
+
+// ErrUnsigned is returned when verifying a file which has no signature.
+var ErrUnsigned = errors.New("not signed")
+
+// Signer signs data with a private key.
+type Signer interface {
+	// ClearSign returns data wrapped in a cleartext signature, as used for
+	// an apt InRelease file or a dpkg-sig signature.
+	ClearSign(data []byte) ([]byte, error)
+	// DetachSign returns an ASCII armored detached signature of data, as
+	// used for Release.gpg, repomd.xml.asc and rpm header signatures.
+	DetachSign(data []byte) ([]byte, error)
+}
+
+// Verifier checks signatures made by a Signer with the matching public key.
+type Verifier interface {
+	// VerifyClearSigned checks the cleartext signature in msg, as returned
+	// by ClearSign, and returns the data it signs.
+	VerifyClearSigned(msg []byte) ([]byte, error)
+	// VerifyDetached checks that sig, armored or not, is a signature of
+	// data.
+	VerifyDetached(data, sig []byte) error
+}
+
+// LoadVerifier returns a verifier for the public key in the file at p: a
+// PEM encoded key for a FileKey, or else a GPG public key, armored or not.
+func LoadVerifier(p string) (Verifier, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if isPEMKey(b) {
+		return parseFileKey(b)
+	}
+	return &GPG{PublicKey: p}, nil
+}
+
+// Options configures how packages are signed and verified.
+type Options struct {
+	// Signer signs debs and rpms, and detached signatures.
+	Signer Signer
+	// Verifier checks the signatures made by Signer.
+	Verifier Verifier
+	// Authenticode signs and verifies the executables in windows zips.
+	Authenticode *Authenticode
+	// Time is the date recorded in deb signatures. It defaults to now.
+	Time time.Time
+}
+
+// SignPackage signs the deb, rpm or windows zip at p in place.
+func SignPackage(p string, opts Options) error {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+
+	var signed []byte
+	switch filepath.Ext(p) {
+	case ".deb":
+		if opts.Signer == nil {
+			return fmt.Errorf("%s: no signer configured", p)
+		}
+		t := opts.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		signed, err = SignDeb(b, opts.Signer, t)
+	case ".rpm":
+		if opts.Signer == nil {
+			return fmt.Errorf("%s: no signer configured", p)
+		}
+		signed, err = SignRpm(b, opts.Signer)
+	case ".zip":
+		if opts.Authenticode == nil {
+			return fmt.Errorf("%s: no authenticode signer configured", p)
+		}
+		signed, err = opts.Authenticode.SignZip(b)
+	default:
+		return fmt.Errorf("%s: unknown package type", p)
+	}
+	if err != nil {
+		return fmt.Errorf("error signing %s: %w", p, err)
+	}
+	return writeFileAtomic(p, signed)
+}
+
+// VerifyPackage checks the signature of the deb, rpm or windows zip at p.
+func VerifyPackage(p string, opts Options) error {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(p) {
+	case ".deb":
+		if opts.Verifier == nil {
+			return fmt.Errorf("%s: no verifier configured", p)
+		}
+		err = VerifyDeb(b, opts.Verifier)
+	case ".rpm":
+		if opts.Verifier == nil {
+			return fmt.Errorf("%s: no verifier configured", p)
+		}
+		err = VerifyRpm(b, opts.Verifier)
+	case ".zip":
+		if opts.Authenticode == nil {
+			return fmt.Errorf("%s: no authenticode verifier configured", p)
+		}
+		err = opts.Authenticode.VerifyZip(b)
+	default:
+		return fmt.Errorf("%s: unknown package type", p)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	return nil
+}
+
+// SignFile writes a detached signature of the file at p next to it, named
+// p + DetachedExtension.
+func SignFile(p string, s Signer) error {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	sig, err := s.DetachSign(b)
+	if err != nil {
+		return fmt.Errorf("error signing %s: %w", p, err)
+	}
+	return writeFileAtomic(p+DetachedExtension, sig)
+}
+
+// VerifyFile checks the detached signature of the file at p written by
+// SignFile.
+func VerifyFile(p string, v Verifier) error {
+	sig, err := os.ReadFile(p + DetachedExtension)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", p, ErrUnsigned)
+		}
+		return err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	if err := v.VerifyDetached(b, sig); err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	return nil
+}
+
+func writeFileAtomic(p string, b []byte) (retErr error) {
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// Dearmor returns the binary signature in an ASCII armored one, either an
+// OpenPGP or a PEM armor. Signatures which are not armored are returned as
+// they are.
+func Dearmor(sig []byte) ([]byte, error) {
+	if isPEMSignature(sig) {
+		return decodePEMSignature(sig)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(sig)), pgpArmorBegin) {
+		return sig, nil
+	}
+	return decodePGPArmor(sig)
+}
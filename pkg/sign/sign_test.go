@@ -0,0 +1,350 @@
+package sign
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/archive/archivetest"
+)
+
+// testGPG returns a signer with a new key in a temporary gpg home, and a
+// file with its public key, or nil if gpg is not installed.
+func testGPG(t *testing.T) (*GPG, string) {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		return nil, ""
+	}
+
+	// gpg-agent's socket path must be short.
+	home, err := os.MkdirTemp("/tmp", "gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "all").Run()
+		os.RemoveAll(home)
+	})
+
+	cmd := exec.Command("gpg", "--homedir", home, "--batch", "--passphrase", "", "--quick-gen-key", "sign-test@example.com", "ed25519", "sign", "never")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot generate a gpg key: %v: %s", err, out)
+	}
+
+	pub := filepath.Join(t.TempDir(), "key.asc")
+	cmd = exec.Command("gpg", "--homedir", home, "--batch", "--armor", "--output", pub, "--export", "sign-test@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("cannot export the gpg key: %v: %s", err, out)
+	}
+	return &GPG{KeyID: "sign-test@example.com", Homedir: home}, pub
+}
+
+func testPackages(t *testing.T, s Signer, v, other Verifier) {
+	t.Helper()
+	deb, rpm := archivetest.WritePackages(t)
+
+	for _, p := range []string{deb, rpm} {
+		unsigned, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyPackage(p, Options{Verifier: v}); !errors.Is(err, ErrUnsigned) {
+			t.Errorf("%s: expected ErrUnsigned, got %v", p, err)
+		}
+
+		opts := Options{Signer: s, Verifier: v, Time: time.Unix(1700000000, 0)}
+		if err := SignPackage(p, opts); err != nil {
+			t.Fatal(err)
+		}
+		// Signing again replaces the signature.
+		if err := SignPackage(p, opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyPackage(p, opts); err != nil {
+			t.Error(err)
+		}
+		if err := VerifyPackage(p, Options{Verifier: other}); err == nil {
+			t.Errorf("%s: expected an error verifying with another key", p)
+		}
+
+		// The package is still readable, with the same contents.
+		a, err := archive.ReadPackage(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f, ok := a.File("/usr/bin/runc"); !ok || f.Size != 6 {
+			t.Errorf("%s: unexpected contents after signing: %+v", p, a.Files)
+		}
+
+		signed, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(signed, unsigned) {
+			t.Fatalf("%s: not changed by signing", p)
+		}
+
+		// Corrupt a byte of the payload, at the end of the rpm, or of the
+		// data.tar, before the signature at the end of the deb.
+		i := len(unsigned) - 10
+		signed[i] ^= 0xff
+		if err := os.WriteFile(p, signed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyPackage(p, opts); err == nil {
+			t.Errorf("%s: expected an error for a corrupted package", p)
+		}
+	}
+}
+
+func TestFileKey(t *testing.T) {
+	k, err := GenerateFileKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateFileKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The public key alone verifies.
+	pem, err := k.MarshalPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(pub, pem, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadVerifier(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testPackages(t, k, v, other)
+
+	msg, err := k.ClearSign([]byte("Release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := v.VerifyClearSigned(msg); err != nil || string(data) != "Release\n" {
+		t.Errorf("expected the signed data back, got %q: %v", data, err)
+	}
+}
+
+func TestGPG(t *testing.T) {
+	s, pub := testGPG(t)
+	if s == nil {
+		t.Skip("gpg not installed")
+	}
+	other, err := GenerateFileKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadVerifier(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(*GPG); !ok {
+		t.Fatalf("expected a gpg verifier, got %T", v)
+	}
+
+	testPackages(t, s, v, other)
+
+	p := filepath.Join(t.TempDir(), "provenance.json")
+	if err := os.WriteFile(p, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(p, v); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("expected ErrUnsigned, got %v", err)
+	}
+	if err := SignFile(p, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(p, v); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuthenticode(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, data := range map[string]string{"docker/dockerd.exe": "MZ", "docker/README.md": "readme"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "moby-engine-24.0.9+azure-u1.amd64.zip")
+	if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Authenticode{
+		Sign:   []string{"sh", "-c", `cat "$1" > "$2" && printf SIGNED >> "$2"`, "sh", "{in}", "{out}"},
+		Verify: []string{"sh", "-c", `[ "$(tail -c 6 "$1")" = SIGNED ]`, "sh", "{in}"},
+	}
+	opts := Options{Authenticode: a}
+	if err := VerifyPackage(p, opts); err == nil {
+		t.Error("expected an error verifying an unsigned zip")
+	}
+	if err := SignPackage(p, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPackage(p, opts); err != nil {
+		t.Error(err)
+	}
+
+	contents, err := archive.ReadPackage(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := contents.Data("/docker/dockerd.exe"); string(b) != "MZSIGNED" {
+		t.Errorf("expected the signed executable, got %q", b)
+	}
+	if b, _ := contents.Data("/docker/README.md"); string(b) != "readme" {
+		t.Errorf("expected the README unchanged, got %q", b)
+	}
+}
+
+func TestCompareSigned(t *testing.T) {
+	k, err := GenerateFileKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deb, rpm := archivetest.WritePackages(t)
+
+	for _, p := range []string{deb, rpm} {
+		signed := filepath.Join(t.TempDir(), filepath.Base(p))
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(signed, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := SignPackage(signed, Options{Signer: k}); err != nil {
+			t.Fatal(err)
+		}
+		if err := CompareSigned(p, signed); err != nil {
+			t.Error(err)
+		}
+
+		// Signing the package from another build is refused, even though
+		// the signature is valid.
+		b[len(b)-10] ^= 0xff
+		other := filepath.Join(t.TempDir(), filepath.Base(p))
+		if err := os.WriteFile(other, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := SignPackage(other, Options{Signer: k}); err != nil {
+			t.Fatal(err)
+		}
+		if err := CompareSigned(p, other); err == nil {
+			t.Errorf("%s: expected an error for a different package", p)
+		}
+	}
+}
+
+func TestCompareSignedDebOrigin(t *testing.T) {
+	deb, _ := archivetest.WritePackages(t)
+	b, err := os.ReadFile(deb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := archive.ReadAr(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signers other than dpkg-sig append their own members, e.g. debsigs.
+	buf := bytes.NewBufferString("!<arch>\n")
+	for _, m := range append(members, archive.ArMember{Name: "_gpgorigin", Mode: 0o644, Data: []byte("signature")}) {
+		if err := archive.WriteArMember(buf, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signed := filepath.Join(t.TempDir(), filepath.Base(deb))
+	if err := os.WriteFile(signed, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompareSigned(deb, signed); err != nil {
+		t.Error(err)
+	}
+}
+
+// testPE returns a minimal PE32+ executable with code, signed with cert if
+// it is not nil, the way signtool appends the certificate table.
+func testPE(code, cert []byte) []byte {
+	const opt = 0x40 + 24
+	b := make([]byte, opt+112+16*8)
+	copy(b, "MZ")
+	binary.LittleEndian.PutUint32(b[0x3c:], 0x40)
+	copy(b[0x40:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(b[opt:], 0x20b)
+	b = append(b, code...)
+	if cert == nil {
+		return b
+	}
+
+	b = append(b, make([]byte, (8-len(b)%8)%8)...)
+	binary.LittleEndian.PutUint32(b[opt+64:], 0x1234)
+	binary.LittleEndian.PutUint32(b[opt+112+4*8:], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[opt+112+4*8+4:], uint32(len(cert)))
+	return append(b, cert...)
+}
+
+func TestCompareSignedZip(t *testing.T) {
+	write := func(files map[string][]byte) string {
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+		for name, data := range files {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(data)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(t.TempDir(), "moby-engine-24.0.9+azure-u1.amd64.zip")
+		if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	unsigned := write(map[string][]byte{"dockerd.exe": testPE([]byte("code"), nil), "README.md": []byte("readme")})
+	for _, tc := range []struct {
+		name   string
+		files  map[string][]byte
+		expect bool
+	}{
+		{"signed", map[string][]byte{"dockerd.exe": testPE([]byte("code"), []byte("certificate")), "README.md": []byte("readme")}, true},
+		{"unsigned", map[string][]byte{"dockerd.exe": testPE([]byte("code"), nil), "README.md": []byte("readme")}, true},
+		{"other executable", map[string][]byte{"dockerd.exe": testPE([]byte("evil"), []byte("certificate")), "README.md": []byte("readme")}, false},
+		{"other file", map[string][]byte{"dockerd.exe": testPE([]byte("code"), []byte("certificate")), "README.md": []byte("evil")}, false},
+		{"extra file", map[string][]byte{"dockerd.exe": testPE([]byte("code"), nil), "README.md": []byte("readme"), "evil.exe": nil}, false},
+		{"missing file", map[string][]byte{"dockerd.exe": testPE([]byte("code"), nil)}, false},
+	} {
+		err := CompareSigned(unsigned, write(tc.files))
+		if tc.expect && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.expect && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+const (
+	// Packages are uploaded as a stream of blocks, several at a time.
+	azureBlockSize   = 8 * 1024 * 1024
+	azureConcurrency = 4
+)
+
+// AzureBlob stores files as blobs in an Azure storage container.
+type AzureBlob struct {
+	client    *azblob.Client
+	account   string
+	container string
+}
+
+// NewAzureBlob returns a backend for the container in the storage account,
+// authenticated with the default Azure credential chain.
+func NewAzureBlob(account, container string) (*AzureBlob, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	client, err := azblob.NewClient(serviceURL, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AzureBlob{client: client, account: account, container: container}, nil
+}
+
+func (a *AzureBlob) Put(ctx context.Context, name string, r io.Reader, size int64, metadata map[string]string) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+
+	md := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		v := v
+		md[k] = &v
+	}
+
+	_, err = a.client.UploadStream(ctx, a.container, name, r, &azblob.UploadStreamOptions{
+		BlockSize:   azureBlockSize,
+		Concurrency: azureConcurrency,
+		Metadata:    md,
+	})
+	return err
+}
+
+func (a *AzureBlob) Stat(ctx context.Context, name string) (*Properties, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.ServiceClient().NewContainerClient(a.container).NewBlobClient(name).GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, fmt.Errorf("%s: %w", name, ErrNotExist)
+		}
+		return nil, err
+	}
+
+	props := &Properties{Metadata: make(map[string]string, len(resp.Metadata))}
+	if resp.ContentLength != nil {
+		props.Size = *resp.ContentLength
+	}
+	// The keys come back from the service as HTTP headers, with their case
+	// changed.
+	for k, v := range resp.Metadata {
+		if v != nil {
+			props.Metadata[strings.ToLower(k)] = *v
+		}
+	}
+	return props, nil
+}
+
+func (a *AzureBlob) List(ctx context.Context, prefix string) ([]Object, error) {
+	pager := a.client.NewListBlobsFlatPager(a.container, &azblob.ListBlobsFlatOptions{
+		Prefix:  &prefix,
+		Include: azblob.ListBlobsInclude{Metadata: true},
+	})
+
+	var objs []Object
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", a, err)
+		}
+		for _, item := range resp.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+			obj := Object{Name: *item.Name, Properties: Properties{Metadata: make(map[string]string, len(item.Metadata))}}
+			if item.Properties != nil && item.Properties.ContentLength != nil {
+				obj.Size = *item.Properties.ContentLength
+			}
+			for k, v := range item.Metadata {
+				if v != nil {
+					obj.Metadata[strings.ToLower(k)] = *v
+				}
+			}
+			objs = append(objs, obj)
+		}
+	}
+
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Name < objs[j].Name })
+	return objs, nil
+}
+
+func (a *AzureBlob) String() string {
+	return fmt.Sprintf("https://%s.blob.core.windows.net/%s", a.account, a.container)
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MetadataExtension is appended to the name of a file stored in a local
+// directory to get the name of the JSON file holding its metadata.
+const MetadataExtension = ".metadata.json"
+
+// LocalDir stores files in a directory on disk, laid out the same way as
+// in a storage container, so it can be served or copied as a mirror of it.
+type LocalDir struct {
+	root string
+}
+
+// NewLocalDir returns a backend storing files under root, which is created
+// if needed.
+func NewLocalDir(root string) (*LocalDir, error) {
+	if root == "" {
+		return nil, fmt.Errorf("no directory given for local storage")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalDir{root: root}, nil
+}
+
+func (l *LocalDir) path(name string) (string, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(name)), nil
+}
+
+// Put writes the file to a temporary file next to its destination and
+// renames it into place, so a partial upload is never seen at name.
+func (l *LocalDir) Put(ctx context.Context, name string, r io.Reader, size int64, metadata map[string]string) error {
+	p, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	md, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p+MetadataExtension, func(w io.Writer) error {
+		_, err := w.Write(append(md, '\n'))
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(p, func(w io.Writer) error {
+		n, err := io.Copy(w, r)
+		if err != nil {
+			return err
+		}
+		if n != size {
+			return fmt.Errorf("%s: expected %d bytes, got %d", name, size, n)
+		}
+		return nil
+	})
+}
+
+func (l *LocalDir) Stat(ctx context.Context, name string) (*Properties, error) {
+	p, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s: not a regular file", p)
+	}
+
+	props := &Properties{Size: fi.Size(), Metadata: map[string]string{}}
+	b, err := os.ReadFile(p + MetadataExtension)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return props, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &props.Metadata); err != nil {
+		return nil, fmt.Errorf("error reading metadata of %s: %w", p, err)
+	}
+	return props, nil
+}
+
+// List walks the directory for files, skipping metadata and the temporary
+// files of uploads in progress.
+func (l *LocalDir) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objs []Object
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(p, MetadataExtension) || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		props, err := l.Stat(ctx, name)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, Object{Name: name, Properties: *props})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Name < objs[j].Name })
+	return objs, nil
+}
+
+func (l *LocalDir) String() string {
+	return l.root
+}
+
+func writeFileAtomic(p string, write func(io.Writer) error) (retErr error) {
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion  = "us-east-1"
+	s3MetadataPrefix = "X-Amz-Meta-"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	// s3EmptyBody is the sha256 sum of an empty request body.
+	s3EmptyBody  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3TimeFormat = "20060102T150405Z"
+)
+
+// S3Config configures an S3 compatible backend.
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g.
+	// https://s3.us-west-2.amazonaws.com or http://localhost:9000.
+	Endpoint string
+	Bucket   string
+	// Region defaults to us-east-1, which most S3 compatible services
+	// accept whatever region they are in.
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// S3ConfigFromEnv returns the config for the bucket at endpoint, with the
+// region and credentials taken from the usual AWS environment variables.
+func S3ConfigFromEnv(endpoint, bucket string) S3Config {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return S3Config{
+		Endpoint:        endpoint,
+		Bucket:          bucket,
+		Region:          region,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// S3 stores files as objects in a bucket of an S3 compatible service.
+// Requests use path style addressing and are signed with AWS signature
+// version 4.
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage needs an endpoint and a bucket")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("no credentials for s3 storage")
+	}
+	if cfg.Region == "" {
+		cfg.Region = s3DefaultRegion
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %q", cfg.Endpoint)
+	}
+
+	return &S3{cfg: cfg, endpoint: u}, nil
+}
+
+func (s *S3) objectURL(name string) *url.URL {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket + "/" + name
+	u.Path = p
+	u.RawPath = s3EscapePath(p)
+	return &u
+}
+
+func (s *S3) Put(ctx context.Context, name string, r io.Reader, size int64, metadata map[string]string) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(name).String(), io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	for k, v := range metadata {
+		req.Header.Set(s3MetadataPrefix+k, v)
+	}
+	s.sign(req, s3UnsignedBody, time.Now())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("error uploading %s to %s: %s: %s", name, s, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, name string) (*Properties, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL(name).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, s3EmptyBody, time.Now())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", name, ErrNotExist)
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("error getting properties of %s from %s: %s", name, s, resp.Status)
+	}
+
+	props := &Properties{Size: resp.ContentLength, Metadata: map[string]string{}}
+	for k, v := range resp.Header {
+		if strings.HasPrefix(k, s3MetadataPrefix) && len(v) > 0 {
+			props.Metadata[strings.ToLower(strings.TrimPrefix(k, s3MetadataPrefix))] = v[0]
+		}
+	}
+	return props, nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key  string
+		Size int64
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List lists the bucket with ListObjectsV2. The listing does not include
+// metadata, so every object found is then fetched with Stat.
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket
+	u.RawPath = s3EscapePath(u.Path)
+
+	var objs []Object
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		s.sign(req, s3EmptyBody, time.Now())
+
+		resp, err := s.cfg.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		if resp.StatusCode/100 != 2 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			return nil, fmt.Errorf("error listing %s: %s: %s", s, resp.Status, strings.TrimSpace(string(body)))
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", s, err)
+		}
+
+		for _, c := range result.Contents {
+			props, err := s.Stat(ctx, c.Key)
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, Object{Name: c.Key, Properties: *props})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Name < objs[j].Name })
+	return objs, nil
+}
+
+func (s *S3) String() string {
+	return strings.TrimSuffix(s.cfg.Endpoint, "/") + "/" + s.cfg.Bucket
+}
+
+// sign adds the AWS signature version 4 authorization header to req,
+// signing the host and every header already set on it.
+func (s *S3) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format(s3TimeFormat)
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := new(strings.Builder)
+	for _, k := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", k, strings.TrimSpace(headers[k]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.cfg.Region)
+	reqHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(reqHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + s.cfg.SecretAccessKey)
+	for _, part := range []string{date, s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3EscapePath escapes p the way S3 expects in the canonical request, which
+// is stricter than url.PathEscape: '+' in particular must be escaped, and
+// package versions such as 1.1.11+azure contain one.
+func s3EscapePath(p string) string {
+	return s3Escape(p, false)
+}
+
+func s3Escape(s string, escapeSlash bool) string {
+	b := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
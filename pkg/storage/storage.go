@@ -0,0 +1,62 @@
+// Package storage stores released packages. Packages are stored at the path
+// given by archive.Spec.StoragePath, along with metadata such as their sha256
+// sum, in an Azure storage container, an S3 compatible bucket or a local
+// directory.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Sha256Key is the metadata key the sha256 sum of a stored file is kept
+// under.
+const Sha256Key = "sha256"
+
+// ErrNotExist is returned by Backend.Stat for files which are not stored.
+var ErrNotExist = fs.ErrNotExist
+
+// Properties describes a stored file.
+type Properties struct {
+	Size int64
+	// Metadata keys are lower case.
+	Metadata map[string]string
+}
+
+// Object is a stored file, as returned by Backend.List.
+type Object struct {
+	Name string
+	Properties
+}
+
+// Backend stores files by path.
+type Backend interface {
+	// Put stores size bytes read from r at name, replacing anything
+	// already stored there, along with the metadata.
+	Put(ctx context.Context, name string, r io.Reader, size int64, metadata map[string]string) error
+	// Stat returns the properties of the file stored at name, or an error
+	// wrapping ErrNotExist if there is none.
+	Stat(ctx context.Context, name string) (*Properties, error)
+	// List returns every file stored under a name starting with prefix,
+	// which is not necessarily a directory, sorted by name.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// String describes where files are stored, for logging.
+	String() string
+}
+
+// cleanName checks name is a relative path which stays inside the storage
+// root, and returns it cleaned.
+func cleanName(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("invalid storage path: %q", name)
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid storage path: %q", name)
+	}
+	return clean, nil
+}
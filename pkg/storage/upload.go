@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	DefaultRetries    = 3
+	DefaultRetryDelay = 2 * time.Second
+)
+
+// UploadOptions configures PutFile.
+type UploadOptions struct {
+	// Retries is how many more times a failed upload is attempted.
+	Retries int
+	// RetryDelay is how long to wait before the first retry. It doubles
+	// for every retry after that.
+	RetryDelay time.Duration
+	// Progress, if set, is called as the file is read, with the number of
+	// bytes uploaded so far and the size of the file. It is called again
+	// from zero when an upload is retried.
+	Progress func(done, total int64)
+}
+
+// errHashMismatch is returned when the file changed between being hashed
+// and being uploaded. Retrying would not help.
+var errHashMismatch = errors.New("file changed while uploading")
+
+// HashFile returns the sha256 sum and the size of the file at p, reading it
+// as a stream rather than into memory.
+func HashFile(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), n, nil
+}
+
+// PutFile streams the file at p to name, with its sha256 sum, which should
+// come from HashFile, as metadata. The file is hashed again as it is
+// uploaded, so that a file which changed after it was hashed is reported
+// rather than published under the wrong sum. Failed uploads are retried
+// with exponential backoff.
+func PutFile(ctx context.Context, b Backend, name, p, sha256Sum string, opts UploadOptions) error {
+	delay := opts.RetryDelay
+	if delay == 0 {
+		delay = DefaultRetryDelay
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = putFile(ctx, b, name, p, sha256Sum, opts.Progress)
+		if err == nil || errors.Is(err, errHashMismatch) || ctx.Err() != nil || attempt >= opts.Retries {
+			break
+		}
+
+		fmt.Fprintf(os.Stderr, "error uploading %s, retrying in %s: %v\n", name, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+	return err
+}
+
+func putFile(ctx context.Context, b Backend, name, p, sha256Sum string, progress func(done, total int64)) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	r := &progressReader{r: io.TeeReader(f, h), total: fi.Size(), progress: progress}
+	if err := b.Put(ctx, name, r, fi.Size(), map[string]string{Sha256Key: sha256Sum}); err != nil {
+		return err
+	}
+
+	if got := fmt.Sprintf("%x", h.Sum(nil)); got != sha256Sum {
+		return fmt.Errorf("%s: %w: expected sha256 %s, uploaded %s", p, errHashMismatch, sha256Sum, got)
+	}
+	return nil
+}
+
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress func(done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Action is what uploading a file to a backend would do.
+type Action string
+
+const (
+	// ActionUpload stores a file which is not stored yet.
+	ActionUpload Action = "upload"
+	// ActionSkip leaves a file which is already stored with the same
+	// sha256 sum alone.
+	ActionSkip Action = "skip"
+	// ActionOverwrite replaces a stored file with a different sha256 sum.
+	ActionOverwrite Action = "overwrite"
+	// ActionConflict refuses to replace a stored file with a different
+	// sha256 sum.
+	ActionConflict Action = "conflict"
+)
+
+// ErrConflict is returned for a file already stored with a different sha256
+// sum than the one being uploaded.
+var ErrConflict = errors.New("already stored with a different sha256 sum")
+
+// Plan checks what is stored at name and decides what uploading a file with
+// the sha256 sum should do. A file stored without a sha256 sum is treated as
+// different. Stored files are only replaced if force is set.
+func Plan(ctx context.Context, b Backend, name, sha256 string, force bool) (Action, *Properties, error) {
+	props, err := b.Stat(ctx, name)
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return ActionUpload, nil, nil
+		}
+		return "", nil, fmt.Errorf("error checking %s: %w", name, err)
+	}
+
+	if props.Metadata[Sha256Key] == sha256 {
+		return ActionSkip, props, nil
+	}
+	if force {
+		return ActionOverwrite, props, nil
+	}
+	return ActionConflict, props, nil
+}
+
+// Verify checks the file stored at name has the expected size and sha256 sum
+// metadata, after it has been uploaded.
+func Verify(ctx context.Context, b Backend, name, sha256 string, size int64) error {
+	props, err := b.Stat(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error verifying %s: %w", name, err)
+	}
+	if got := props.Metadata[Sha256Key]; got != sha256 {
+		return fmt.Errorf("error verifying %s: expected sha256 %s, got %q", name, sha256, got)
+	}
+	if props.Size != size {
+		return fmt.Errorf("error verifying %s: expected %d bytes, got %d", name, size, props.Size)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package testresults
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+// Report holds the results of one bats suite run against the packages built
+// from a spec.
+type Report struct {
+	Spec  archive.Spec `json:"spec"`
+	Suite string       `json:"suite"`
+	// Runner is how the suite was run, e.g. "dagger" or "make".
+	Runner   string        `json:"runner,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	// Error is set if the suite could not be run, or did not finish.
+	Error   string   `json:"error,omitempty"`
+	Results []Result `json:"results"`
+}
+
+// Counts returns the number of passed, failed and skipped tests. A report
+// with an error and no failed tests counts one failure for the error.
+func (r *Report) Counts() (passed, failed, skipped int) {
+	for _, res := range r.Results {
+		switch res.Status {
+		case StatusPassed:
+			passed++
+		case StatusFailed:
+			failed++
+		case StatusSkipped:
+			skipped++
+		}
+	}
+	if r.Error != "" && failed == 0 {
+		failed++
+	}
+	return passed, failed, skipped
+}
+
+// Failed reports whether any test failed, or the suite did not finish.
+func (r *Report) Failed() bool {
+	_, failed, _ := r.Counts()
+	return failed > 0
+}
+
+// Basename is the name the report files are written under, without an
+// extension. It matches the name bats used for its own JUnit reports.
+func (r *Report) Basename() string {
+	return "TestReport-" + r.Suite
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes the report as JUnit XML. The suite is named after the
+// spec, so results for the same test on different distros and arches are
+// told apart.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	name := fmt.Sprintf("%s %s %s %s", r.Spec.Pkg, r.Spec.Distro, r.Spec.Arch, r.Suite)
+	passed, failed, skipped := r.Counts()
+
+	suite := junitTestSuite{
+		Name:      name,
+		Tests:     passed + failed + skipped,
+		Skipped:   skipped,
+		Time:      seconds(r.Duration),
+		Timestamp: r.Started.UTC().Format(time.RFC3339),
+		Properties: []junitProperty{
+			{"package", r.Spec.Pkg},
+			{"distro", r.Spec.Distro},
+			{"arch", r.Spec.Arch},
+			{"tag", r.Spec.Tag},
+			{"revision", r.Spec.Revision},
+			{"commit", r.Spec.Commit},
+		},
+	}
+
+	for _, res := range r.Results {
+		tc := junitTestCase{Name: res.Name, ClassName: name, Time: seconds(res.Duration)}
+		switch res.Status {
+		case StatusFailed:
+			tc.Failure = &junitMessage{Message: "failed", Body: res.Output}
+			suite.Failures++
+		case StatusSkipped:
+			tc.Skipped = &junitMessage{Message: res.Output}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if r.Error != "" {
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      r.Suite,
+			ClassName: name,
+			Error:     &junitMessage{Message: r.Error},
+		})
+		suite.Tests++
+		suite.Errors++
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteFiles writes the report to dir as JUnit XML and JSON, and returns the
+// paths written.
+func (r *Report) WriteFiles(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	base := filepath.Join(dir, r.Basename())
+
+	f, err := os.Create(base + ".xml")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := r.WriteJUnit(f); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := writeJSON(base+".json", r); err != nil {
+		return nil, err
+	}
+
+	return []string{base + ".xml", base + ".json"}, nil
+}
+
+func writeJSON(filename string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0o644)
+}
+
+// SpecSummary is the outcome of one suite in a Summary.
+type SpecSummary struct {
+	Spec     archive.Spec  `json:"spec"`
+	Suite    string        `json:"suite"`
+	Passed   int           `json:"passed"`
+	Failed   int           `json:"failed"`
+	Skipped  int           `json:"skipped"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	// Failures lists the names of the failed tests.
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Summary totals the results of several reports.
+type Summary struct {
+	Passed  int           `json:"passed"`
+	Failed  int           `json:"failed"`
+	Skipped int           `json:"skipped"`
+	Specs   []SpecSummary `json:"specs"`
+}
+
+// Summarize totals the reports. Specs are sorted by package, distro, arch
+// and suite.
+func Summarize(reports []*Report) *Summary {
+	s := &Summary{Specs: []SpecSummary{}}
+
+	for _, r := range reports {
+		passed, failed, skipped := r.Counts()
+		ss := SpecSummary{
+			Spec:     r.Spec,
+			Suite:    r.Suite,
+			Passed:   passed,
+			Failed:   failed,
+			Skipped:  skipped,
+			Duration: r.Duration,
+			Error:    r.Error,
+		}
+		for _, res := range r.Results {
+			if res.Status == StatusFailed {
+				ss.Failures = append(ss.Failures, res.Name)
+			}
+		}
+
+		s.Passed += passed
+		s.Failed += failed
+		s.Skipped += skipped
+		s.Specs = append(s.Specs, ss)
+	}
+
+	sort.Slice(s.Specs, func(i, j int) bool {
+		a, b := s.Specs[i], s.Specs[j]
+		for _, p := range [][2]string{
+			{a.Spec.Pkg, b.Spec.Pkg},
+			{a.Spec.Distro, b.Spec.Distro},
+			{a.Spec.Arch, b.Spec.Arch},
+		} {
+			if p[0] != p[1] {
+				return p[0] < p[1]
+			}
+		}
+		return a.Suite < b.Suite
+	})
+
+	return s
+}
+
+// WriteFile writes the summary as JSON.
+func (s *Summary) WriteFile(filename string) error {
+	return writeJSON(filename, s)
+}
@@ -0,0 +1,117 @@
+// Package testresults turns the output of the bats test suites into per test
+// results, and writes them as JUnit XML and JSON.
+package testresults
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// Result is the outcome of a single test.
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Duration time.Duration `json:"duration"`
+	// Output is the diagnostic output bats prints for the test: the
+	// failed assertion and the output of the test for failures, and the
+	// reason for skipped tests.
+	Output string `json:"output,omitempty"`
+}
+
+var (
+	tapPlan   = regexp.MustCompile(`^1\.\.(\d+)$`)
+	tapResult = regexp.MustCompile(`^(ok|not ok) (\d+)(?: (.*))?$`)
+	tapSkip   = regexp.MustCompile(`(?i) # skip\b ?(.*)$`)
+	tapTiming = regexp.MustCompile(` in (\d+)ms$`)
+)
+
+// ParseTAP parses the TAP output of bats, as produced by `bats --tap -T`.
+// Comment lines and any other output following a result are attached to it
+// as its output. Tests which were planned but never reported, for example
+// because the suite was killed, are returned as failures.
+func ParseTAP(r io.Reader) ([]Result, error) {
+	var (
+		results []Result
+		planned = -1
+		current *Result
+	)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+
+		if m := tapPlan.FindStringSubmatch(line); m != nil && len(results) == 0 {
+			planned, _ = strconv.Atoi(m[1])
+			continue
+		}
+
+		if m := tapResult.FindStringSubmatch(line); m != nil {
+			results = append(results, parseResult(m[1] == "ok", m[3]))
+			current = &results[len(results)-1]
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "#"), " ")
+		}
+		if current.Output != "" {
+			current.Output += "\n"
+		}
+		current.Output += line
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := len(results); i < planned; i++ {
+		results = append(results, Result{
+			Name:   fmt.Sprintf("test %d", i+1),
+			Status: StatusFailed,
+			Output: "test did not run: the suite exited early",
+		})
+	}
+
+	for i := range results {
+		results[i].Output = strings.TrimRight(results[i].Output, "\n")
+	}
+	return results, nil
+}
+
+func parseResult(ok bool, desc string) Result {
+	res := Result{Status: StatusFailed}
+	if ok {
+		res.Status = StatusPassed
+	}
+
+	if m := tapSkip.FindStringSubmatchIndex(desc); m != nil {
+		res.Status = StatusSkipped
+		res.Output = strings.TrimSuffix(strings.TrimPrefix(desc[m[2]:m[3]], "("), ")")
+		desc = desc[:m[0]]
+	}
+
+	if m := tapTiming.FindStringSubmatch(desc); m != nil {
+		ms, _ := strconv.Atoi(m[1])
+		res.Duration = time.Duration(ms) * time.Millisecond
+		desc = strings.TrimSuffix(desc, m[0])
+	}
+
+	res.Name = strings.TrimSpace(desc)
+	return res
+}
@@ -0,0 +1,77 @@
+package testresults
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+const tapOutput = `1..4
+ok 1 test docker run hello world in 1532ms
+not ok 2 test containerd run hello world in 40012ms
+# (in test file /opt/moby/test.sh, line 22)
+#   ` + "`assert_output --partial \"hello from azl\"'" + ` failed
+# -- output does not contain substring --
+ok 3 validate engine version # skip no engine version specified to compare against
+`
+
+func TestParseTAP(t *testing.T) {
+	results, err := ParseTAP(strings.NewReader(tapOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d: %+v", len(results), results)
+	}
+
+	want := []Result{
+		{Name: "test docker run hello world", Status: StatusPassed, Duration: 1532 * time.Millisecond},
+		{Name: "test containerd run hello world", Status: StatusFailed, Duration: 40012 * time.Millisecond},
+		{Name: "validate engine version", Status: StatusSkipped, Output: "no engine version specified to compare against"},
+		{Name: "test 4", Status: StatusFailed},
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Name != w.Name || got.Status != w.Status || got.Duration != w.Duration {
+			t.Errorf("result %d: expected %+v, got %+v", i, w, got)
+		}
+		if w.Output != "" && got.Output != w.Output {
+			t.Errorf("result %d: expected output %q, got %q", i, w.Output, got.Output)
+		}
+	}
+
+	if out := results[1].Output; !strings.HasPrefix(out, "(in test file /opt/moby/test.sh, line 22)") || !strings.Contains(out, "output does not contain substring") {
+		t.Errorf("unexpected failure output: %q", out)
+	}
+
+	r := &Report{
+		Spec:    archive.Spec{Pkg: "moby-engine", Distro: "jammy", Arch: "amd64"},
+		Suite:   "test.sh",
+		Results: results,
+	}
+	if passed, failed, skipped := r.Counts(); passed != 1 || failed != 2 || skipped != 1 {
+		t.Errorf("unexpected counts: %d passed, %d failed, %d skipped", passed, failed, skipped)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := r.WriteJUnit(buf); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if s := suites.Suites[0]; s.Tests != 4 || s.Failures != 2 || s.Skipped != 1 || s.Cases[1].Failure == nil {
+		t.Errorf("unexpected junit suite: %+v", s)
+	}
+
+	sum := Summarize([]*Report{r, {Spec: archive.Spec{Pkg: "moby-engine", Distro: "bionic"}, Suite: "test.sh", Error: "vm did not boot"}})
+	if sum.Failed != 3 || sum.Specs[0].Spec.Distro != "bionic" || len(sum.Specs[1].Failures) != 2 {
+		t.Errorf("unexpected summary: %+v", sum)
+	}
+}
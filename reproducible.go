@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"dagger.io/dagger"
+	"github.com/Azure/moby-packaging/pkg/archive"
+)
+
+var errNotReproducible = errors.New("build is not reproducible")
+
+// buildReproducible builds spec twice, each time with caches of its own, and
+// compares the packages produced. The packages from the first build are
+// exported to the output directory as usual; the second build only lives
+// long enough to be compared.
+func buildReproducible(ctx context.Context, client *dagger.Client, spec *archive.Spec, outDir string) (string, []archive.Difference, error) {
+	dir, err := build(ctx, client, spec, outDir, "verify-a")
+	if err != nil {
+		return "", nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "moby-verify-")
+	if err != nil {
+		return dir, nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	other, err := build(ctx, client, spec, tmp, "verify-b")
+	if err != nil {
+		return dir, nil, fmt.Errorf("error in second build: %w", err)
+	}
+
+	diffs, err := compareBuilds(dir, other)
+	if err != nil {
+		return dir, nil, err
+	}
+
+	for _, d := range diffs {
+		fmt.Fprintf(os.Stderr, "%s %s/%s: %s\n", spec.Pkg, spec.Distro, spec.Arch, d)
+	}
+	if len(diffs) > 0 {
+		return dir, diffs, errNotReproducible
+	}
+	return dir, nil, nil
+}
+
+// compareBuilds compares every package in dir a with the package of the same
+// name in dir b. Differences are reported with the package filename prefixed
+// to the member, and packages only present on one side are reported too.
+func compareBuilds(a, b string) ([]archive.Difference, error) {
+	var diffs []archive.Difference
+
+	for _, pattern := range []string{"*.deb", "*.rpm", "*.zip"} {
+		matches, err := filepath.Glob(filepath.Join(a, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pa := range matches {
+			name := filepath.Base(pa)
+
+			pb := filepath.Join(b, name)
+			if _, err := os.Stat(pb); err != nil {
+				diffs = append(diffs, archive.Difference{Member: name, Field: "present", A: "yes", B: "no"})
+				continue
+			}
+
+			ca, err := archive.ReadPackage(pa)
+			if err != nil {
+				return nil, err
+			}
+			cb, err := archive.ReadPackage(pb)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, d := range archive.ComparePackages(ca, cb) {
+				d.Member = name + ":" + d.Member
+				diffs = append(diffs, d)
+			}
+		}
+
+		extra, err := filepath.Glob(filepath.Join(b, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, pb := range extra {
+			name := filepath.Base(pb)
+			if _, err := os.Stat(filepath.Join(a, name)); err != nil {
+				diffs = append(diffs, archive.Difference{Member: name, Field: "present", A: "no", B: "yes"})
+			}
+		}
+	}
+
+	return diffs, nil
+}
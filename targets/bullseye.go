@@ -2,28 +2,29 @@ package targets
 
 import (
 	"context"
-	"path"
 
 	"dagger.io/dagger"
 	"github.com/Azure/moby-packaging/pkg/apt"
 )
 
 var (
-	BullseyeRef            = path.Join(MirrorPrefix(), "buildpack-deps:bullseye")
+	BullseyeRef            = distro("bullseye").ImageRef(MirrorPrefix())
 	BullseyeAptCacheKey    = "bullseye-apt-cache"
 	BullseyeAptLibCacheKey = "bullseye-apt-lib-cache"
 )
 
 func Bullseye(ctx context.Context, client *dagger.Client, platform dagger.Platform, goVersion string) (*Target, error) {
+	d := distro("bullseye")
+
 	c := client.Container(dagger.ContainerOpts{Platform: platform}).From(BullseyeRef)
-	c = apt.Install(c, client.CacheVolume(BullseyeAptCacheKey), client.CacheVolume(BullseyeAptLibCacheKey), BaseDebPackages...)
+	c = apt.Install(c, client.CacheVolume(BullseyeAptCacheKey), client.CacheVolume(BullseyeAptLibCacheKey), d.BasePackages...)
 
 	buildPlatform, err := client.DefaultPlatform(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	t := &Target{client: client, c: c, platform: platform, name: "bullseye", pkgKind: "deb", buildPlatform: buildPlatform, goVersion: goVersion}
+	t := &Target{client: client, c: c, platform: platform, name: d.Name, pkgKind: string(d.Kind), buildPlatform: buildPlatform, goVersion: goVersion}
 
 	t, err = t.WithPlatformEnvs().InstallGo(ctx, goVersion)
 	if err != nil {
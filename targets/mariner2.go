@@ -7,18 +7,20 @@ import (
 	"github.com/Azure/moby-packaging/pkg/tdnf"
 )
 
-const Mariner2Ref = "mcr.microsoft.com/cbl-mariner/base/core:2.0"
+var Mariner2Ref = distro("mariner2").ImageRef(MirrorPrefix())
 
 func Mariner2(ctx context.Context, client *dagger.Client, platform dagger.Platform, goVersion string) (*Target, error) {
+	d := distro("mariner2")
+
 	c := client.Container(dagger.ContainerOpts{Platform: platform}).From(Mariner2Ref)
-	c = tdnf.Install(c, BaseMarinerPackages...)
+	c = tdnf.Install(c, d.BasePackages...)
 
 	buildPlatform, err := client.DefaultPlatform(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	t := &Target{client: client, c: c, platform: platform, name: "mariner2", pkgKind: "rpm", buildPlatform: buildPlatform, goVersion: goVersion}
+	t := &Target{client: client, c: c, platform: platform, name: d.Name, pkgKind: string(d.Kind), buildPlatform: buildPlatform, goVersion: goVersion}
 
 	t, err = t.WithPlatformEnvs().InstallGo(ctx, goVersion)
 	if err != nil {
@@ -2,23 +2,24 @@ package targets
 
 import (
 	"context"
-	"path"
 
 	"dagger.io/dagger"
 )
 
 var (
-	Rhel8Ref = path.Join(MirrorPrefix(), "almalinux:8")
+	Rhel8Ref = distro("rhel8").ImageRef(MirrorPrefix())
 )
 
 func Rhel8(ctx context.Context, client *dagger.Client, platform dagger.Platform, goVersion string) (*Target, error) {
+	d := distro("rhel8")
+
 	c := client.Container(dagger.ContainerOpts{Platform: platform}).From(Rhel8Ref).
 		WithExec([]string{"bash", "-c", `
         yum -y install dnf-plugins-core
         yum config-manager --set-enabled powertools
         yum install -y gcc-toolset-12-binutils
         `})
-	c = YumInstall(c, BaseRPMPackages...)
+	c = YumInstall(c, d.BasePackages...)
 	c = c.WithEnvVariable("GCC_VERSION", "12").
 		WithEnvVariable("GCC_ENV_VILE", "/opt/rh/gcc-toolset-12/enable")
 
@@ -27,7 +28,7 @@ func Rhel8(ctx context.Context, client *dagger.Client, platform dagger.Platform,
 		return nil, err
 	}
 
-	t := &Target{client: client, c: c, platform: platform, name: "rhel8", pkgKind: "rpm", buildPlatform: buildPlatform, goVersion: goVersion}
+	t := &Target{client: client, c: c, platform: platform, name: d.Name, pkgKind: string(d.Kind), buildPlatform: buildPlatform, goVersion: goVersion}
 
 	t, err = t.WithPlatformEnvs().InstallGo(ctx, goVersion)
 	if err != nil {
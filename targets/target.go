@@ -3,25 +3,18 @@ package targets
 import (
 	"context"
 	"fmt"
-	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	buildx "github.com/Azure/moby-packaging/packages/moby-buildx"
-	cli "github.com/Azure/moby-packaging/packages/moby-cli"
-	compose "github.com/Azure/moby-packaging/packages/moby-compose"
-	containerd "github.com/Azure/moby-packaging/packages/moby-containerd"
-	shim "github.com/Azure/moby-packaging/packages/moby-containerd-shim-systemd"
-	engine "github.com/Azure/moby-packaging/packages/moby-engine"
-	runc "github.com/Azure/moby-packaging/packages/moby-runc"
-	tini "github.com/Azure/moby-packaging/packages/moby-tini"
+	"github.com/Azure/moby-packaging/packages"
 	"github.com/Azure/moby-packaging/pkg/apt"
 	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/mirror"
 
 	"dagger.io/dagger"
 )
 
-type GoVersionFunc = func(*archive.Spec) string
-
 func (t *Target) AptInstall(pkgs ...string) *Target {
 	c := apt.Install(t.c, t.client.CacheVolume(t.name+"-apt-cache"), t.client.CacheVolume(t.name+"-apt-lib-cache"), pkgs...)
 	return t.update(c)
@@ -34,6 +27,8 @@ type Target struct {
 	client    *dagger.Client
 	pkgKind   string
 	goVersion string
+	cacheID   string
+	cacheBust string
 
 	buildPlatform dagger.Platform
 }
@@ -45,11 +40,7 @@ func (t *Target) update(c *dagger.Container) *Target {
 }
 
 func MirrorPrefix() string {
-	prefix, ok := os.LookupEnv("MIRROR_PREFIX")
-	if !ok {
-		prefix = "mcr.microsoft.com/mirror/docker/library"
-	}
-	return prefix
+	return mirror.Prefix()
 }
 
 type MakeTargetFunc func(context.Context, *dagger.Client, dagger.Platform, string) (*Target, error)
@@ -68,123 +59,80 @@ var targets = map[string]MakeTargetFunc{
 	"mariner2": Mariner2,
 }
 
-func GetTarget(ctx context.Context, distro string, client *dagger.Client, platform dagger.Platform, goVersion string) (*Target, error) {
-	f, ok := targets[distro]
-	if !ok {
-		panic("unknown distro: " + distro)
+func init() {
+	for _, d := range archive.Distros() {
+		if _, ok := targets[d.Name]; !ok {
+			panic("no build target for distro: " + d.Name)
+		}
+	}
+	for name := range targets {
+		distro(name)
 	}
-	return f(ctx, client, platform, goVersion)
 }
 
-var (
-	BaseWinPackages = []string{
-		"binutils-mingw-w64",
-		"g++-mingw-w64-x86-64",
-		"gcc",
-		"git",
-		"make",
-		"pkg-config",
-		"quilt",
-		"zip",
+// distro returns the descriptor for a distro we have a target for. Targets
+// are only defined for known distros, so a failed lookup is a bug.
+func distro(name string) archive.Distro {
+	d, err := archive.LookupDistro(name)
+	if err != nil {
+		panic(err)
 	}
+	return d
+}
 
-	BaseDebPackages = []string{
-		"build-essential",
-		"cmake",
-		"dh-make",
-		"devscripts",
-		"dh-apparmor",
-		"dpkg-dev",
-		"equivs",
-		"fakeroot",
-		"libbtrfs-dev",
-		"libdevmapper-dev",
-		"libltdl-dev",
-		"libseccomp-dev",
-		"quilt",
+// BaseRef returns the image the target for a distro is built from.
+func BaseRef(name string) (string, error) {
+	d, err := archive.LookupDistro(name)
+	if err != nil {
+		return "", err
 	}
+	return d.ImageRef(MirrorPrefix()), nil
+}
 
-	BaseBionicPackages = []string{
-		"bash",
-		"build-essential",
-		"cmake",
-		"dh-make",
-		"devscripts",
-		"dh-apparmor",
-		"dpkg-dev",
-		"equivs",
-		"fakeroot",
-		"libdevmapper-dev",
-		"libltdl-dev",
-		"libseccomp-dev",
-		"quilt",
+func GetTarget(ctx context.Context, distro string, client *dagger.Client, platform dagger.Platform, goVersion string) (*Target, error) {
+	f, ok := targets[distro]
+	if !ok {
+		return nil, fmt.Errorf("unknown distro: %q", distro)
 	}
+	return f(ctx, client, platform, goVersion)
+}
 
-	BaseMarinerPackages = []string{
-		"bash",
-		"binutils",
-		"build-essential",
-		"ca-certificates",
-		"cmake",
-		"device-mapper-devel",
-		"diffutils",
-		"dnf-utils",
-		"file",
-		"gcc",
-		"git",
-		"glibc-static",
-		"libffi-devel",
-		"libseccomp-devel",
-		"libtool",
-		"libtool-ltdl-devel",
-		"make",
-		"patch",
-		"pkgconfig",
-		"pkgconfig(systemd)",
-		"rpm-build",
-		"rpmdevtools",
-		"selinux-policy-devel",
-		"systemd-devel",
-		"tar",
-		"which",
-		"yum-utils",
-	}
+// WithIsolatedCache makes the build use go build and module caches of its
+// own, named after id, and forces the build steps to run again instead of
+// being served from the dagger cache. Building the same spec with two
+// different ids yields two independent builds, which is how we check that
+// packages are reproducible. The ids should be fixed, as every id creates
+// cache volumes which are kept by the engine.
+func (t *Target) WithIsolatedCache(id string) *Target {
+	tgt := *t
+	tgt.cacheID = id
+	tgt.cacheBust = strconv.FormatInt(time.Now().UnixNano(), 10)
+	return &tgt
+}
 
-	BaseRPMPackages = []string{
-		"bash",
-		"ca-certificates",
-		"cmake",
-		"device-mapper-devel",
-		"gcc",
-		"git",
-		"glibc-static",
-		"libseccomp-devel",
-		"libtool",
-		"libtool-ltdl-devel",
-		"make",
-		"make",
-		"patch",
-		"pkgconfig",
-		"pkgconfig(systemd)",
-		"rpmdevtools",
-		"selinux-policy-devel",
-		"systemd-devel",
-		"tar",
-		"which",
-		"yum-utils",
+// Images returns the refs, resolved to a digest, of the base image of the
+// target and of the image the Go toolchain is taken from.
+func (t *Target) Images(ctx context.Context) ([]string, error) {
+	// Windows packages are cross compiled, so the images are pulled for the
+	// build platform.
+	platform := t.platform
+	if t.pkgKind == string(archive.PkgKindWin) {
+		platform = t.buildPlatform
 	}
 
-	GetGoVersionForPackage = map[string]GoVersionFunc{
-		"moby-buildx":                  buildx.GoVersion,
-		"moby-cli":                     cli.GoVersion,
-		"moby-compose":                 compose.GoVersion,
-		"moby-containerd":              containerd.GoVersion,
-		"moby-containerd-shim-systemd": shim.GoVersion,
-		"moby-engine":                  engine.GoVersion,
-		"moby-runc":                    runc.GoVersion,
-		"moby-tini":                    tini.GoVersion,
+	var refs []string
+	for _, ref := range []string{
+		distro(t.name).ImageRef(MirrorPrefix()),
+		fmt.Sprintf("%s:%s", GoRepo, t.goVersion),
+	} {
+		resolved, err := t.client.Container(dagger.ContainerOpts{Platform: platform}).From(ref).ImageRef(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving %s: %w", ref, err)
+		}
+		refs = append(refs, resolved)
 	}
-)
+	return refs, nil
+}
 
 func (t *Target) Container() *dagger.Container {
 	return t.c
@@ -194,6 +142,10 @@ func (t *Target) WithExec(args []string, opts ...dagger.ContainerWithExecOpts) *
 	return t.update(t.c.WithExec(args, opts...))
 }
 
+func (t *Target) GoVersion() string {
+	return t.goVersion
+}
+
 func (t *Target) PkgKind() string {
 	return t.pkgKind
 }
@@ -242,39 +194,23 @@ func (t *Target) goMD2Man() *dagger.File {
 }
 
 type Packager interface {
-	Package(*dagger.Client, *dagger.Container, *archive.Spec) *dagger.Directory
+	Package(*dagger.Client, *dagger.Container, *archive.Spec) (*dagger.Directory, error)
 }
 
-func (t *Target) Packager(projectName, distro, version string) (Packager, error) {
-	var mappings map[string]archive.Archive
-	switch projectName {
-	case "moby-engine":
-		mappings = engine.Archives
-	case "moby-cli":
-		mappings = cli.Archives
-	case "moby-containerd":
-		ls, err := containerd.Archives(version)
-		if err != nil {
-			return nil, err
-		}
-		mappings = ls
-	case "moby-containerd-shim-systemd":
-		mappings = shim.Archives
-	case "moby-runc":
-		mappings = runc.Archives
-	case "moby-compose":
-		mappings = compose.Archives
-	case "moby-buildx":
-		mappings = buildx.Archives
-	case "moby-tini":
-		mappings = tini.Archives
-	default:
-		return nil, fmt.Errorf("unsupported project: %s", projectName)
+func (t *Target) Packager(spec *archive.Spec) (Packager, error) {
+	project, err := packages.Get(spec.Pkg)
+	if err != nil {
+		return nil, err
 	}
 
-	a, ok := mappings[distro]
+	mappings, err := project.Archives(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := mappings[spec.Distro]
 	if !ok {
-		return nil, fmt.Errorf("unsupported distro: %s", distro)
+		return nil, fmt.Errorf("unsupported distro for %s: %s", spec.Pkg, spec.Distro)
 	}
 
 	switch t.PkgKind() {
@@ -307,10 +243,27 @@ func (t *Target) getCommitTime(projectName string, sourceDir *dagger.Directory)
 func (t *Target) Make(project *archive.Spec, projectDir, hackCrossDir *dagger.Directory) (*dagger.Directory, error) {
 	md2man := t.goMD2Man()
 
-	source := t.getSource(project)
+	p, err := packages.Get(project.Pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := p.Source(t.client, project)
+	if err != nil {
+		return nil, err
+	}
 	commitTime := t.getCommitTime(project.Pkg, source)
 
-	build := t.c.
+	c := t.c
+	if t.cacheID != "" {
+		c = c.
+			WithMountedCache("/root/.cache/go-build", t.client.CacheVolume(t.name+"-go-build-cache-"+string(t.platform)+"-"+t.cacheID)).
+			WithMountedCache("/go/pkg/mod", t.client.CacheVolume(GoModCacheKey+"-"+t.cacheID)).
+			WithEnvVariable("BUILD_CACHE_ID", t.cacheID).
+			WithEnvVariable("BUILD_CACHE_BUST", t.cacheBust)
+	}
+
+	build := c.
 		WithDirectory("/build", projectDir).
 		WithDirectory("/build/hack/cross", hackCrossDir).
 		WithDirectory("/build/src", source).
@@ -325,11 +278,11 @@ func (t *Target) Make(project *archive.Spec, projectDir, hackCrossDir *dagger.Di
 		WithExec(t.applyPatchesCommand()).
 		WithExec([]string{"/usr/bin/make", t.PkgKind()})
 
-	packager, err := t.Packager(project.Pkg, project.Distro, project.Tag)
+	packager, err := t.Packager(project)
 	if err != nil {
 		return nil, err
 	}
-	return packager.Package(t.client, build, project), nil
+	return packager.Package(t.client, build, project)
 }
 
 func WithPlatformEnvs(c *dagger.Container, build, target dagger.Platform) *dagger.Container {
@@ -39,7 +39,7 @@ func TestApt(t *testing.T) {
 	}
 
 	eg, ctx := errgroup.WithContext(ctx)
-	for _, pkg := range BaseDebPackages {
+	for _, pkg := range distro("jammy").BasePackages {
 		pkg := pkg
 		eg.Go(func() error {
 			c := c.WithExec([]string{"/usr/bin/dpkg", "-s", pkg})
@@ -0,0 +1,156 @@
+#!/usr/bin/env bats
+load 'test_helper/bats-support/load'
+load 'test_helper/bats-assert/load'
+
+# Upgrade path tests. The tests in this file depend on each other and must run
+# in order: the previous release of ${UPGRADE_PACKAGE} is installed and its
+# services started, then it is upgraded in place to the candidate build.
+#
+# Inputs, set by cmd/run_tests:
+#   UPGRADE_PACKAGE            name of the package under test
+#   UPGRADE_DIR                directory holding previous/ and candidate/, each
+#                              with the package file for that version
+#   UPGRADE_PREVIOUS_VERSION   package version of the previous release
+#   UPGRADE_CANDIDATE_VERSION  package version of the candidate
+#   UPGRADE_UNITS              systemd services shipped by the package
+#   UPGRADE_CONFFILES          config files which must survive the upgrade
+#   UPGRADE_CONFDIRS           config directories owned by the package
+
+: ${UPGRADE_DIR:=/var/upgrade}
+: ${UPGRADE_UNITS:=}
+: ${UPGRADE_CONFFILES:=}
+: ${UPGRADE_CONFDIRS:=}
+
+STATE_DIR="${BATS_FILE_TMPDIR:-/tmp}/upgrade"
+MARKER="# moby-packaging upgrade test"
+
+pkg_file() {
+    ls "${UPGRADE_DIR}/${1}/"*.deb "${UPGRADE_DIR}/${1}/"*.rpm 2>/dev/null | head -n1
+}
+
+install_file() {
+    if [ -n "$(command -v apt-get)" ]; then
+        DEBIAN_FRONTEND=noninteractive apt-get install -y --allow-downgrades "${1}"
+        return $?
+    fi
+    if [ -n "$(command -v tdnf)" ]; then
+        tdnf install -y --nogpgcheck "${1}"
+        return $?
+    fi
+    yum install -y --nogpgcheck "${1}"
+}
+
+installed_version() {
+    if [ -n "$(command -v dpkg-query)" ]; then
+        dpkg-query -W -f='${Version}' "${1}"
+        return $?
+    fi
+    rpm -q --qf '%{VERSION}-%{RELEASE}' "${1}"
+}
+
+owned_files() {
+    if [ -n "$(command -v dpkg-query)" ]; then
+        dpkg-query -L "${1}"
+        return $?
+    fi
+    rpm -ql "${1}"
+}
+
+invocation_id() {
+    systemctl show -p InvocationID --value "${1}"
+}
+
+setup_file() {
+    mkdir -p "${STATE_DIR}"
+    if [ -n "$(command -v apt-get)" ]; then
+        apt-get update
+    fi
+}
+
+@test "install previous release" {
+    f="$(pkg_file previous)"
+    [ -n "${f}" ] || fail "no package in ${UPGRADE_DIR}/previous"
+
+    run install_file "${f}"
+    assert_success
+
+    run installed_version "${UPGRADE_PACKAGE}"
+    assert_output "${UPGRADE_PREVIOUS_VERSION}"
+}
+
+@test "services running before upgrade" {
+    for unit in ${UPGRADE_UNITS}; do
+        systemctl start "${unit}"
+        run systemctl is-active "${unit}"
+        assert_output "active"
+        invocation_id "${unit}" >"${STATE_DIR}/${unit}.id"
+    done
+}
+
+@test "record state before upgrade" {
+    owned_files "${UPGRADE_PACKAGE}" | sort >"${STATE_DIR}/files.previous"
+
+    for f in ${UPGRADE_CONFFILES}; do
+        [ -f "${f}" ] || continue
+        echo "${MARKER}" >>"${f}"
+    done
+    for d in ${UPGRADE_CONFDIRS}; do
+        mkdir -p "${d}"
+        echo "${MARKER}" >"${d}/upgrade-test.local"
+    done
+}
+
+@test "upgrade to candidate" {
+    f="$(pkg_file candidate)"
+    [ -n "${f}" ] || fail "no package in ${UPGRADE_DIR}/candidate"
+
+    run install_file "${f}"
+    assert_success
+
+    run installed_version "${UPGRADE_PACKAGE}"
+    assert_output "${UPGRADE_CANDIDATE_VERSION}"
+}
+
+@test "services restarted by upgrade" {
+    for unit in ${UPGRADE_UNITS}; do
+        run systemctl is-active "${unit}"
+        assert_output "active"
+
+        run systemctl is-enabled "${unit}"
+        assert_success
+
+        before="$(cat "${STATE_DIR}/${unit}.id")"
+        run invocation_id "${unit}"
+        refute_output "${before}"
+    done
+}
+
+@test "config preserved across upgrade" {
+    for f in ${UPGRADE_CONFFILES}; do
+        [ -f "${f}" ] || continue
+        run grep -qxF "${MARKER}" "${f}"
+        assert_success
+    done
+    for d in ${UPGRADE_CONFDIRS}; do
+        run cat "${d}/upgrade-test.local"
+        assert_output "${MARKER}"
+    done
+}
+
+@test "no orphaned files after upgrade" {
+    owned_files "${UPGRADE_PACKAGE}" | sort >"${STATE_DIR}/files.candidate"
+
+    # Files which were owned by the previous release but not by the candidate
+    # must have been removed, except for config the admin may have changed.
+    orphans=()
+    for f in $(comm -23 "${STATE_DIR}/files.previous" "${STATE_DIR}/files.candidate"); do
+        case " ${UPGRADE_CONFFILES} " in
+        *" ${f} "*) continue ;;
+        esac
+        if [ -f "${f}" ] || [ -L "${f}" ]; then
+            orphans+=("${f}")
+        fi
+    done
+
+    [ "${#orphans[@]}" -eq 0 ] || fail "files left behind by the previous release: ${orphans[*]}"
+}
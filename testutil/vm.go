@@ -0,0 +1,270 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/Azure/moby-packaging/pkg/archive"
+	"github.com/Azure/moby-packaging/pkg/mirror"
+	"github.com/Azure/moby-packaging/targets"
+)
+
+const (
+	// DefaultVMTimeout bounds how long the VM may run, including boot,
+	// package installation and the test suite.
+	DefaultVMTimeout = 45 * time.Minute
+
+	vmMemory = "4096"
+	vmCPUs   = "2"
+
+	guestTestDir = "/opt/moby"
+	guestPkgDir  = "/var/pkg"
+	guestUnit    = "moby-vm-test.service"
+)
+
+// guestRunner runs inside the VM once it has booted. The results are written
+// as a tar stream straight onto the second disk, so they can be read back
+// without mounting the guest filesystem.
+const guestRunner = `#!/bin/sh
+set -x
+. ` + guestTestDir + `/vm.env
+
+# Static config for qemu user networking.
+ip link set lo up
+ip link set eth0 up
+ip addr add 10.0.2.15/24 dev eth0
+ip route add default via 10.0.2.2
+rm -f /etc/resolv.conf
+echo "nameserver 10.0.2.3" >/etc/resolv.conf
+
+ec=0
+cd ` + guestTestDir + `
+if [ "${VM_INSTALL}" = "1" ]; then
+    ./install.sh ` + guestPkgDir + ` || ec=$?
+fi
+if [ "${ec}" -eq 0 ]; then
+    bats --tap -T "` + guestTestDir + `/${VM_SUITE}" >"TestReport-${VM_SUITE}.tap"
+    ec=$?
+    cat "TestReport-${VM_SUITE}.tap"
+fi
+
+echo "${ec}" >exit-code
+tar -cf /dev/vdb exit-code $(ls TestReport-*.tap 2>/dev/null)
+sync
+systemctl --no-block poweroff
+`
+
+const guestUnitFile = `[Unit]
+Description=moby-packaging integration tests
+
+[Service]
+Type=oneshot
+ExecStart=` + guestTestDir + `/vm-run.sh
+StandardOutput=journal+console
+StandardError=journal+console
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// hostRunner boots the VM in the qemu container. KVM is used when the
+// engine exposes it, otherwise qemu falls back to TCG, which is much slower
+// but works anywhere.
+const hostRunner = `
+set -e
+[ -c /dev/kvm ] || mknod /dev/kvm c 10 232 2>/dev/null || true
+
+kernel="$(ls /boot/vmlinuz-*-kvm | sort -V | tail -n1)"
+truncate -s 64M /tmp/results.img
+
+ec=0
+timeout --kill-after=30s "${VM_TIMEOUT}" qemu-system-x86_64 \
+    -accel kvm -accel tcg -cpu max -m "${VM_MEMORY}" -smp "${VM_CPUS}" \
+    -nographic -no-reboot \
+    -kernel "${kernel}" \
+    -append "root=/dev/vda rw console=ttyS0 net.ifnames=0 init=/lib/systemd/systemd" \
+    -drive file=/tmp/rootfs.qcow2,format=qcow2,if=virtio \
+    -drive file=/tmp/results.img,format=raw,if=virtio \
+    -netdev user,id=net0 -device virtio-net-pci,netdev=net0 || ec=$?
+
+mkdir -p /results
+if ! tar -C /results -xf /tmp/results.img exit-code; then
+    echo "no test results from the VM (qemu exited with ${ec})" >&2
+    exit 1
+fi
+tar -C /results -xf /tmp/results.img
+`
+
+// VMTest runs a bats suite from the tests directory against built packages
+// in a VM booted from the test image of the spec's distro.
+type VMTest struct {
+	Spec *archive.Spec
+	// Tests is the tests directory of this repo.
+	Tests *dagger.Directory
+	// Packages is copied to /var/pkg in the guest.
+	Packages *dagger.Directory
+	// Dirs are extra directories to copy into the guest, keyed by path.
+	Dirs map[string]*dagger.Directory
+	// Suite is the bats file to run. The test image has test.sh and
+	// upgrade.sh.
+	Suite string
+	// Install runs install.sh on /var/pkg before the suite.
+	Install bool
+	// Env is set for the install script and the suite.
+	Env map[string]string
+	// Timeout defaults to DefaultVMTimeout.
+	Timeout time.Duration
+}
+
+// VMResult holds the outcome of a VMTest.
+type VMResult struct {
+	// ExitCode is the exit code of the install script or, if that
+	// succeeded, of bats.
+	ExitCode int
+	// Reports holds the TAP output of bats, in TestReport-<suite>.tap.
+	Reports *dagger.Directory
+}
+
+// TestImage builds the test image for a distro from tests/Dockerfile, using
+// the same base image as the build target for the distro.
+func TestImage(tests *dagger.Directory, spec *archive.Spec) (*dagger.Container, error) {
+	ref, err := targets.BaseRef(spec.Distro)
+	if err != nil {
+		return nil, err
+	}
+
+	return tests.DockerBuild(dagger.DirectoryDockerBuildOpts{
+		Target:   spec.Distro + "-test",
+		Platform: dagger.Platform("linux/" + spec.Arch),
+		BuildArgs: []dagger.BuildArg{
+			{Name: "MIRROR", Value: mirror.Prefix() + "/"},
+			{Name: strings.ToUpper(spec.Distro) + "_IMG", Value: ref},
+		},
+	}), nil
+}
+
+// Rootfs returns the root filesystem of the VM: the test image plus the
+// kernel modules of the qemu image's kernel, the tools the guest runner
+// needs, and a unit which runs the tests on boot.
+func (t *VMTest) Rootfs(qemuCtr *dagger.Container) (*dagger.Directory, error) {
+	d, err := archive.LookupDistro(t.Spec.Distro)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := TestImage(t.Tests, t.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d.PackageManager {
+	case archive.PackageManagerApt:
+		c = c.WithExec([]string{"/bin/sh", "-ec", "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y iproute2 kmod"})
+	case archive.PackageManagerYum:
+		c = c.WithExec([]string{"yum", "install", "-y", "iproute", "kmod"})
+	case archive.PackageManagerTdnf:
+		c = c.WithExec([]string{"tdnf", "install", "-y", "iproute", "kmod"})
+	default:
+		return nil, fmt.Errorf("no package manager for %s", d.Name)
+	}
+
+	c = c.
+		WithDirectory("/lib/modules", qemuCtr.Directory("/lib/modules")).
+		WithNewFile(guestTestDir+"/vm-run.sh", guestRunner, dagger.ContainerWithNewFileOpts{Permissions: 0o755}).
+		WithNewFile(guestTestDir+"/vm.env", t.envFile()).
+		WithNewFile("/etc/systemd/system/"+guestUnit, guestUnitFile).
+		WithExec([]string{"/bin/sh", "-ec", "mkdir -p /etc/systemd/system/multi-user.target.wants && ln -sf /etc/systemd/system/" + guestUnit + " /etc/systemd/system/multi-user.target.wants/" + guestUnit})
+
+	if t.Packages != nil {
+		c = c.WithDirectory(guestPkgDir, t.Packages)
+	}
+	for p, dir := range t.Dirs {
+		c = c.WithDirectory(p, dir)
+	}
+
+	return c.Rootfs(), nil
+}
+
+// envFile renders the environment of the test as a shell script.
+func (t *VMTest) envFile() string {
+	env := map[string]string{
+		"VM_SUITE":   t.Suite,
+		"VM_INSTALL": "0",
+		"TARGETARCH": t.Spec.Arch,
+	}
+	if t.Install {
+		env["VM_INSTALL"] = "1"
+	}
+	for k, v := range t.Env {
+		env[k] = v
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := new(strings.Builder)
+	for _, k := range keys {
+		fmt.Fprintf(b, "export %s='%s'\n", k, strings.ReplaceAll(env[k], "'", `'\''`))
+	}
+	return b.String()
+}
+
+// Run boots the VM and runs the suite. The VM is always run, even if an
+// identical run was done before, so that flaky tests are not hidden by the
+// cache. Only amd64 guests are supported, on an amd64 engine.
+func (t *VMTest) Run(ctx context.Context, client *dagger.Client) (*VMResult, error) {
+	if t.Spec.Arch != "amd64" {
+		return nil, fmt.Errorf("vm tests are not supported on %s", t.Spec.Arch)
+	}
+	platform, err := client.DefaultPlatform(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(string(platform), "/amd64") {
+		return nil, fmt.Errorf("vm tests need an amd64 engine, got %s", platform)
+	}
+
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = DefaultVMTimeout
+	}
+
+	qemuCtr := NewQemuImg(ctx, client)
+	rootfs, err := t.Rootfs(qemuCtr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := qemuCtr.
+		WithFile("/tmp/rootfs.qcow2", QcowFromDir(ctx, rootfs, qemuCtr)).
+		WithEnvVariable("VM_TIMEOUT", strconv.Itoa(int(timeout.Seconds()))+"s").
+		WithEnvVariable("VM_MEMORY", vmMemory).
+		WithEnvVariable("VM_CPUS", vmCPUs).
+		WithEnvVariable("VM_RUN", time.Now().UTC().Format(time.RFC3339Nano)).
+		WithExec([]string{"/bin/sh", "-c", hostRunner}, dagger.ContainerWithExecOpts{
+			InsecureRootCapabilities: true,
+		})
+
+	out, err := c.File("/results/exit-code").Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error running %s vm: %w", t.Spec.Distro, err)
+	}
+
+	ec, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return nil, fmt.Errorf("bad exit code from vm: %q", out)
+	}
+
+	return &VMResult{
+		ExitCode: ec,
+		Reports:  c.Directory("/results").WithoutFile("exit-code"),
+	}, nil
+}